@@ -0,0 +1,122 @@
+package auth
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// HeaderAuthorization is the header, or the metadata key in lower case, carrying bearer tokens
+	HeaderAuthorization = "Authorization"
+
+	bearerPrefix = "Bearer "
+)
+
+var (
+	// DefaultTokenTTL is the lifetime of the tokens of HMACCredentials
+	DefaultTokenTTL = 5 * time.Minute
+)
+
+// BearerToken returns the token of an Authorization value as "Bearer {token}"
+func BearerToken(authorization string) (string, bool) {
+	if len(authorization) <= len(bearerPrefix) || !strings.EqualFold(authorization[:len(bearerPrefix)], bearerPrefix) {
+		return "", false
+	}
+	return strings.TrimSpace(authorization[len(bearerPrefix):]), true
+}
+
+// TokenCredentials sends a static bearer token. It implements credentials.PerRPCCredentials of gRPC.
+// The token is refused over insecure connections unless AllowInsecure is set.
+type TokenCredentials struct {
+	Token string
+	// AllowInsecure sends the token over insecure connections, where anyone on the path can read it
+	AllowInsecure bool
+}
+
+// GetRequestMetadata implements credentials.PerRPCCredentials
+func (c TokenCredentials) GetRequestMetadata(ctx context.Context, uri ...string) (map[string]string, error) {
+	return map[string]string{strings.ToLower(HeaderAuthorization): bearerPrefix + c.Token}, nil
+}
+
+// RequireTransportSecurity implements credentials.PerRPCCredentials
+func (c TokenCredentials) RequireTransportSecurity() bool {
+	return !c.AllowInsecure
+}
+
+// HMACCredentials sends HS256 tokens signed by Secret, which are renewed before they expire.
+// It implements credentials.PerRPCCredentials of gRPC. The tokens are refused over insecure
+// connections unless AllowInsecure is set.
+type HMACCredentials struct {
+	Secret   []byte
+	Subject  string
+	Scopes   []string
+	Issuer   string
+	Audience string
+	// TTL of tokens, DefaultTokenTTL if it is not positive
+	TTL time.Duration
+	// AllowInsecure sends tokens over insecure connections, where anyone on the path can read them
+	AllowInsecure bool
+
+	mu     sync.Mutex
+	token  string
+	expiry time.Time
+}
+
+// NewHMACCredentials returns HMACCredentials of subject with scopes
+func NewHMACCredentials(secret []byte, subject string, scopes ...string) *HMACCredentials {
+	return &HMACCredentials{Secret: secret, Subject: subject, Scopes: scopes}
+}
+
+// Token returns a token valid for at least half of TTL
+func (c *HMACCredentials) Token() (string, error) {
+	ttl := c.TTL
+	if ttl <= 0 {
+		ttl = DefaultTokenTTL
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	if len(c.token) > 0 && now.Add(ttl/2).Before(c.expiry) {
+		return c.token, nil
+	}
+
+	expiry := now.Add(ttl)
+	claims := Claims{
+		"sub": c.Subject,
+		"iat": now.Unix(),
+		"exp": expiry.Unix(),
+	}
+	if len(c.Scopes) > 0 {
+		claims["scope"] = strings.Join(c.Scopes, " ")
+	}
+	if len(c.Issuer) > 0 {
+		claims["iss"] = c.Issuer
+	}
+	if len(c.Audience) > 0 {
+		claims["aud"] = c.Audience
+	}
+	token, err := Sign(HS256, "", c.Secret, claims)
+	if err != nil {
+		return "", err
+	}
+	c.token, c.expiry = token, expiry
+	return token, nil
+}
+
+// GetRequestMetadata implements credentials.PerRPCCredentials
+func (c *HMACCredentials) GetRequestMetadata(ctx context.Context, uri ...string) (map[string]string, error) {
+	token, err := c.Token()
+	if err != nil {
+		return nil, err
+	}
+	return map[string]string{strings.ToLower(HeaderAuthorization): bearerPrefix + token}, nil
+}
+
+// RequireTransportSecurity implements credentials.PerRPCCredentials
+func (c *HMACCredentials) RequireTransportSecurity() bool {
+	return !c.AllowInsecure
+}
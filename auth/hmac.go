@@ -0,0 +1,186 @@
+package auth
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// HeaderTimestamp is the header of the unix time of signed requests
+	HeaderTimestamp = "X-Timestamp"
+	// HeaderNonce is the header of the random nonce of signed requests
+	HeaderNonce = "X-Nonce"
+	// HeaderSignature is the header of the base64 HMAC-SHA256 of signed requests
+	HeaderSignature = "X-Signature"
+
+	maxNonceLen = 64
+)
+
+var (
+	// DefaultMaxSkew is the max difference of the timestamp of signed requests from now
+	DefaultMaxSkew = 5 * time.Minute
+
+	// ErrInvalidSignature is returned for requests without valid signatures
+	ErrInvalidSignature = errors.New("auth: invalid signature")
+	// ErrClockSkew is returned for requests whose timestamp is too far from now
+	ErrClockSkew = errors.New("auth: timestamp is out of range")
+	// ErrReplay is returned for requests whose nonce is seen already
+	ErrReplay = errors.New("auth: replayed nonce")
+)
+
+// StringToSign returns the canonical request signed by HMACSigner: the method, the escaped path,
+// the query sorted by key and value, the hex SHA-256 of the body, the timestamp and the nonce,
+// separated by newlines
+func StringToSign(method, path, rawQuery string, body []byte, timestamp, nonce string) string {
+	hash := sha256.Sum256(body)
+	if len(path) == 0 {
+		path = "/"
+	}
+	return strings.Join([]string{
+		strings.ToUpper(method),
+		path,
+		canonicalQuery(rawQuery),
+		hex.EncodeToString(hash[:]),
+		timestamp,
+		nonce,
+	}, "\n")
+}
+
+func canonicalQuery(rawQuery string) string {
+	query, _ := url.ParseQuery(rawQuery)
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var buf strings.Builder
+	for _, k := range keys {
+		values := query[k]
+		sort.Strings(values)
+		for _, v := range values {
+			if buf.Len() > 0 {
+				buf.WriteByte('&')
+			}
+			buf.WriteString(url.QueryEscape(k))
+			buf.WriteByte('=')
+			buf.WriteString(url.QueryEscape(v))
+		}
+	}
+	return buf.String()
+}
+
+// Signature returns the base64 HMAC-SHA256 of the string to sign
+func Signature(secret []byte, stringToSign string) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(stringToSign))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// HMACSigner signs requests by Secret, setting HeaderTimestamp, HeaderNonce and HeaderSignature.
+// It implements util.RequestSigner.
+type HMACSigner struct {
+	Secret []byte
+}
+
+// Sign sets the signature headers of req. The body is read and replaced by a replayable copy.
+func (s HMACSigner) Sign(req *http.Request) error {
+	body, err := readBody(req)
+	if err != nil {
+		return err
+	}
+
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+	ts := strconv.FormatInt(time.Now().Unix(), 10)
+	n := hex.EncodeToString(nonce)
+
+	req.Header.Set(HeaderTimestamp, ts)
+	req.Header.Set(HeaderNonce, n)
+	req.Header.Set(HeaderSignature, Signature(s.Secret, StringToSign(req.Method, req.URL.EscapedPath(), req.URL.RawQuery, body, ts, n)))
+	return nil
+}
+
+// readBody returns the body of req, which is replaced by a copy that can be read again
+func readBody(req *http.Request) ([]byte, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, nil
+	}
+	body, err := ioutil.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	req.Body = ioutil.NopCloser(bytes.NewReader(body))
+	req.GetBody = func() (io.ReadCloser, error) {
+		return ioutil.NopCloser(bytes.NewReader(body)), nil
+	}
+	return body, nil
+}
+
+// HMACVerifier verifies the requests of HMACSigner
+type HMACVerifier struct {
+	Secret []byte
+	// MaxSkew is DefaultMaxSkew if it is not positive
+	MaxSkew time.Duration
+	// Nonces remembers nonces for twice MaxSkew. Replays are not blocked if it is nil.
+	Nonces NonceStore
+}
+
+// Verify checks the signature, timestamp and nonce of a request, whose body is read already
+func (v *HMACVerifier) Verify(req *http.Request, body []byte) error {
+	ts := req.Header.Get(HeaderTimestamp)
+	nonce := req.Header.Get(HeaderNonce)
+	sig := req.Header.Get(HeaderSignature)
+	if len(ts) == 0 || len(nonce) == 0 || len(sig) == 0 {
+		return ErrNoCredentials
+	}
+	if len(nonce) > maxNonceLen {
+		return fmt.Errorf("%w: nonce is too long", ErrInvalidSignature)
+	}
+
+	expected := Signature(v.Secret, StringToSign(req.Method, req.URL.EscapedPath(), req.URL.RawQuery, body, ts, nonce))
+	if !hmac.Equal([]byte(expected), []byte(sig)) {
+		return ErrInvalidSignature
+	}
+
+	maxSkew := v.MaxSkew
+	if maxSkew <= 0 {
+		maxSkew = DefaultMaxSkew
+	}
+	unix, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return fmt.Errorf("%w: timestamp %q", ErrInvalidSignature, ts)
+	}
+	if skew := time.Since(time.Unix(unix, 0)); skew > maxSkew || skew < -maxSkew {
+		return ErrClockSkew
+	}
+
+	if v.Nonces == nil {
+		return nil
+	}
+	seen, err := v.Nonces.Seen(nonce, 2*maxSkew)
+	if err != nil {
+		return err
+	}
+	if seen {
+		return ErrReplay
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+package auth
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStringToSign(t *testing.T) {
+	// the query is sorted by key and value
+	s := StringToSign("post", "/a%20b", "b=2&a=3&a=1", []byte("{}"), "100", "n")
+	assert.Equal(t, "POST\n/a%20b\na=1&a=3&b=2\n44136fa355b3678a1146ad16f7e8649e94fb4fc21fe77e8310c060f61caaff8a\n100\nn", s)
+}
+
+func TestHMACSigner(t *testing.T) {
+	secret := []byte("secret")
+	v := &HMACVerifier{Secret: secret, Nonces: NewMemoryNonceStore()}
+
+	signed := func() (*http.Request, []byte) {
+		req := httptest.NewRequest(http.MethodPost, "/orders?b=2&a=1", bytes.NewBufferString(`{"id":1}`))
+		assert.NoError(t, HMACSigner{Secret: secret}.Sign(req))
+		body, _ := ioutil.ReadAll(req.Body)
+		return req, body
+	}
+
+	req, body := signed()
+	assert.Equal(t, `{"id":1}`, string(body))
+	assert.NoError(t, v.Verify(req, body))
+	assert.Equal(t, ErrReplay, v.Verify(req, body))
+
+	req, body = signed()
+	assert.Equal(t, ErrInvalidSignature, v.Verify(req, []byte(`{"id":2}`)))
+	req.URL.RawQuery = "a=1&b=3"
+	assert.Equal(t, ErrInvalidSignature, (&HMACVerifier{Secret: secret}).Verify(req, body))
+	req, body = signed()
+	assert.Equal(t, ErrInvalidSignature, (&HMACVerifier{Secret: []byte("other")}).Verify(req, body))
+	assert.Equal(t, ErrNoCredentials, v.Verify(httptest.NewRequest(http.MethodGet, "/", nil), nil))
+
+	// old timestamps are rejected even if they are signed
+	req = httptest.NewRequest(http.MethodGet, "/", nil)
+	ts := strconv.FormatInt(time.Now().Add(-time.Hour).Unix(), 10)
+	req.Header.Set(HeaderTimestamp, ts)
+	req.Header.Set(HeaderNonce, "n")
+	req.Header.Set(HeaderSignature, Signature(secret, StringToSign(http.MethodGet, "/", "", nil, ts, "n")))
+	assert.Equal(t, ErrClockSkew, v.Verify(req, nil))
+}
+
+func TestMemoryNonceStore(t *testing.T) {
+	s := NewMemoryNonceStore()
+	seen, _ := s.Seen("a", 10*time.Millisecond)
+	assert.False(t, seen)
+	seen, _ = s.Seen("a", 10*time.Millisecond)
+	assert.True(t, seen)
+
+	time.Sleep(20 * time.Millisecond)
+	seen, _ = s.Seen("a", 10*time.Millisecond)
+	assert.False(t, seen)
+}
@@ -0,0 +1,266 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// DefaultJWKSRefresh is the time keys of a JWKS are cached
+	DefaultJWKSRefresh = time.Hour
+	// JWKSMinReload is the min interval of reloading a JWKS for unknown key IDs
+	JWKSMinReload = 30 * time.Second
+
+	// ErrKeyNotFound is returned when no key in a JWKS matches a token
+	ErrKeyNotFound = errors.New("auth: key not found")
+)
+
+// JWKS is the KeySource of a JSON Web Key Set read from a file or an http(s) URL. Keys are cached
+// for Refresh, and reloaded earlier for an unknown key ID. Keys are loaded by one caller at a time
+// without holding the cache, and at most once per JWKSMinReload, failed or not.
+// The cached keys are kept if reloading fails.
+type JWKS struct {
+	// Source is a file path or a URL
+	Source string
+	// Refresh is DefaultJWKSRefresh if it is not positive
+	Refresh time.Duration
+	// Client fetches URLs, a client with a 10s timeout by default
+	Client *http.Client
+
+	mu     sync.Mutex
+	keys   []jwk
+	loaded time.Time
+	// tried is the time of the last load, err its error
+	tried time.Time
+	err   error
+	// loading is closed when the load in flight is done
+	loading chan struct{}
+}
+
+type jwk struct {
+	Kid string `json:"kid"`
+	Kty string `json:"kty"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+	// RSA
+	N string `json:"n"`
+	E string `json:"e"`
+	// EC
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+
+	key crypto.PublicKey
+}
+
+// NewJWKS returns the JWKS of source, a file path or a URL
+func NewJWKS(source string, refresh time.Duration) *JWKS {
+	return &JWKS{Source: source, Refresh: refresh}
+}
+
+// Key implements KeySource. Without kid, the only key suitable for alg is returned.
+func (s *JWKS) Key(alg, kid string) (crypto.PublicKey, error) {
+	refresh := s.Refresh
+	if refresh <= 0 {
+		refresh = DefaultJWKSRefresh
+	}
+
+	s.mu.Lock()
+	stale := s.keys == nil || time.Since(s.loaded) > refresh
+	s.mu.Unlock()
+	if stale {
+		if err := s.reload(); err != nil && !s.cached() {
+			return nil, err
+		}
+	}
+
+	key, err := s.find(alg, kid)
+	if err == nil {
+		return key, nil
+	}
+	// the keys may be rotated
+	if s.reload() != nil {
+		return nil, err
+	}
+	return s.find(alg, kid)
+}
+
+func (s *JWKS) cached() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.keys != nil
+}
+
+// reload loads the keys unless the last load is within JWKSMinReload. Callers during a load
+// wait for it. The error of the last load is returned.
+func (s *JWKS) reload() error {
+	s.mu.Lock()
+	if ch := s.loading; ch != nil {
+		s.mu.Unlock()
+		<-ch
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		return s.err
+	}
+	if !s.tried.IsZero() && time.Since(s.tried) < JWKSMinReload {
+		defer s.mu.Unlock()
+		return s.err
+	}
+	ch := make(chan struct{})
+	s.loading = ch
+	s.tried = time.Now()
+	s.mu.Unlock()
+
+	keys, err := s.load()
+
+	s.mu.Lock()
+	if err == nil {
+		s.keys = keys
+		s.loaded = time.Now()
+	}
+	s.err = err
+	s.loading = nil
+	s.mu.Unlock()
+	close(ch)
+	return err
+}
+
+func (s *JWKS) find(alg, kid string) (crypto.PublicKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var found crypto.PublicKey
+	for _, k := range s.keys {
+		if len(kid) > 0 && k.Kid != kid || !k.suits(alg) {
+			continue
+		}
+		if len(kid) > 0 {
+			return k.key, nil
+		}
+		if found != nil {
+			return nil, fmt.Errorf("%w: tokens without kid are ambiguous", ErrKeyNotFound)
+		}
+		found = k.key
+	}
+	if found == nil {
+		return nil, fmt.Errorf("%w: kid %q of %s", ErrKeyNotFound, kid, alg)
+	}
+	return found, nil
+}
+
+// load reads the keys of Source
+func (s *JWKS) load() ([]jwk, error) {
+	data, err := s.read()
+	if err != nil {
+		return nil, fmt.Errorf("auth: jwks %s: %v", s.Source, err)
+	}
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("auth: jwks %s: %v", s.Source, err)
+	}
+
+	keys := make([]jwk, 0, len(set.Keys))
+	for _, k := range set.Keys {
+		// keys of encryption and unsupported types are skipped
+		if k.Use == "enc" {
+			continue
+		}
+		if key, err := k.publicKey(); err == nil {
+			k.key = key
+			keys = append(keys, k)
+		}
+	}
+	return keys, nil
+}
+
+func (s *JWKS) read() ([]byte, error) {
+	if !strings.HasPrefix(s.Source, "http://") && !strings.HasPrefix(s.Source, "https://") {
+		return ioutil.ReadFile(s.Source)
+	}
+
+	client := s.Client
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	resp, err := client.Get(s.Source)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("status %d", resp.StatusCode)
+	}
+	return ioutil.ReadAll(resp.Body)
+}
+
+// suits reports whether k verifies tokens of alg
+func (k jwk) suits(alg string) bool {
+	if len(k.Alg) > 0 && k.Alg != alg {
+		return false
+	}
+	switch k.key.(type) {
+	case *rsa.PublicKey:
+		return alg == RS256
+	case *ecdsa.PublicKey:
+		return alg == ES256
+	}
+	return false
+}
+
+func (k jwk) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		if !e.IsInt64() || e.Int64() > 1<<31-1 {
+			return nil, errors.New("auth: invalid RSA exponent")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		if k.Crv != "P-256" {
+			return nil, fmt.Errorf("auth: unsupported curve %q", k.Crv)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		curve := elliptic.P256()
+		if !curve.IsOnCurve(x, y) {
+			return nil, errors.New("auth: invalid EC point")
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	}
+	return nil, fmt.Errorf("auth: unsupported key type %q", k.Kty)
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(b), nil
+}
@@ -0,0 +1,97 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func encodeBigInt(i *big.Int) string {
+	return base64.RawURLEncoding.EncodeToString(i.Bytes())
+}
+
+func TestJWKS(t *testing.T) {
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	keys := []map[string]string{
+		{"kid": "rsa", "kty": "RSA", "n": encodeBigInt(rsaKey.N), "e": encodeBigInt(big.NewInt(int64(rsaKey.E)))},
+	}
+
+	var fetches int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&fetches, 1)
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": keys})
+	}))
+	defer server.Close()
+
+	jwks := NewJWKS(server.URL, time.Hour)
+	v := &JWTVerifier{Keys: jwks}
+	claims := Claims{"sub": "alice", "exp": time.Now().Add(time.Minute).Unix()}
+
+	rs, _ := Sign(RS256, "rsa", rsaKey, claims)
+	_, err := v.Verify(rs)
+	assert.NoError(t, err)
+	_, err = v.Verify(rs)
+	assert.NoError(t, err)
+	assert.EqualValues(t, 1, atomic.LoadInt32(&fetches))
+
+	// a new key is found by reloading, which is limited by JWKSMinReload
+	keys = append(keys, map[string]string{"kid": "ec", "kty": "EC", "crv": "P-256", "x": encodeBigInt(ecKey.X), "y": encodeBigInt(ecKey.Y)})
+	es, _ := Sign(ES256, "ec", ecKey, claims)
+	_, err = v.Verify(es)
+	assert.Error(t, err)
+
+	jwks.tried = time.Now().Add(-JWKSMinReload)
+	_, err = v.Verify(es)
+	assert.NoError(t, err)
+	assert.EqualValues(t, 2, atomic.LoadInt32(&fetches))
+
+	// tokens without kid use the only key suitable for the alg
+	es, _ = Sign(ES256, "", ecKey, claims)
+	_, err = v.Verify(es)
+	assert.NoError(t, err)
+}
+
+func TestJWKSUnreachable(t *testing.T) {
+	var fetches int32
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&fetches, 1)
+		<-release
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	jwks := NewJWKS(server.URL, time.Hour)
+	// concurrent callers share one fetch
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := jwks.Key(RS256, "rsa")
+			assert.Error(t, err)
+		}()
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	assert.EqualValues(t, 1, atomic.LoadInt32(&fetches))
+
+	// failures are not retried within JWKSMinReload
+	_, err := jwks.Key(RS256, "rsa")
+	assert.Error(t, err)
+	assert.EqualValues(t, 1, atomic.LoadInt32(&fetches))
+}
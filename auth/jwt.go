@@ -0,0 +1,330 @@
+package auth
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"strings"
+	"time"
+)
+
+const (
+	// HS256 is HMAC with SHA-256, keyed by a shared secret
+	HS256 = "HS256"
+	// RS256 is RSASSA-PKCS1-v1_5 with SHA-256
+	RS256 = "RS256"
+	// ES256 is ECDSA with P-256 and SHA-256
+	ES256 = "ES256"
+)
+
+var (
+	// ErrInvalidToken is returned for malformed tokens and invalid signatures
+	ErrInvalidToken = errors.New("auth: invalid token")
+	// ErrTokenExpired is returned for tokens after exp or before nbf
+	ErrTokenExpired = errors.New("auth: token is expired or not valid yet")
+	// ErrInvalidClaims is returned for tokens of another issuer or audience
+	ErrInvalidClaims = errors.New("auth: invalid claims")
+)
+
+// Claims of a JWT
+type Claims map[string]interface{}
+
+// String returns the string claim of name
+func (c Claims) String(name string) string {
+	s, _ := c[name].(string)
+	return s
+}
+
+// Strings returns a claim which is a string or an array of strings
+func (c Claims) Strings(name string) []string {
+	switch v := c[name].(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		var list []string
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				list = append(list, s)
+			}
+		}
+		return list
+	}
+	return nil
+}
+
+// Time returns a NumericDate claim, as exp
+func (c Claims) Time(name string) (time.Time, bool) {
+	switch v := c[name].(type) {
+	case json.Number:
+		if f, err := v.Float64(); err == nil {
+			return time.Unix(int64(f), 0), true
+		}
+	case float64:
+		return time.Unix(int64(v), 0), true
+	case int64:
+		return time.Unix(v, 0), true
+	case int:
+		return time.Unix(int64(v), 0), true
+	}
+	return time.Time{}, false
+}
+
+// Scopes returns the space-separated scope claim, or the scp array
+func (c Claims) Scopes() []string {
+	if s := c.String("scope"); len(s) > 0 {
+		return strings.Fields(s)
+	}
+	return c.Strings("scp")
+}
+
+// KeySource returns the keys verifying asymmetric tokens
+type KeySource interface {
+	// Key returns the public key of alg with the key ID kid, which may be empty
+	Key(alg, kid string) (crypto.PublicKey, error)
+}
+
+// PublicKey is the KeySource of a single key
+type PublicKey struct {
+	crypto.PublicKey
+}
+
+// Key implements KeySource
+func (k PublicKey) Key(alg, kid string) (crypto.PublicKey, error) {
+	return k.PublicKey, nil
+}
+
+// LoadPublicKey reads a PEM encoded RSA or ECDSA public key, or a certificate
+func LoadPublicKey(file string) (crypto.PublicKey, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	return ParsePublicKey(data)
+}
+
+// ParsePublicKey parses a PEM encoded RSA or ECDSA public key, or a certificate
+func ParsePublicKey(data []byte) (crypto.PublicKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("auth: no PEM block")
+	}
+	if block.Type == "CERTIFICATE" {
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		return cert.PublicKey, nil
+	}
+	if key, err := x509.ParsePKIXPublicKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	return x509.ParsePKCS1PublicKey(block.Bytes)
+}
+
+var _ Verifier = &JWTVerifier{}
+
+// JWTVerifier verifies HS256 tokens by Secret, and RS256 and ES256 tokens by Keys
+type JWTVerifier struct {
+	Secret []byte
+	Keys   KeySource
+	// Issuer and Audience are checked if they are not empty
+	Issuer   string
+	Audience string
+	// Leeway of exp and nbf for clock skew
+	Leeway time.Duration
+	// AllowNoExpiry accepts tokens without exp, which never expire
+	AllowNoExpiry bool
+}
+
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid,omitempty"`
+	Typ string `json:"typ,omitempty"`
+}
+
+// Verify returns the Principal of token
+func (v *JWTVerifier) Verify(token string) (*Principal, error) {
+	claims, err := v.Parse(token)
+	if err != nil {
+		return nil, err
+	}
+	return &Principal{
+		Subject: claims.String("sub"),
+		Scopes:  claims.Scopes(),
+		Method:  Token,
+		Claims:  claims,
+	}, nil
+}
+
+// Parse verifies the signature and claims of token, and returns the claims
+func (v *JWTVerifier) Parse(token string) (Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("%w: malformed", ErrInvalidToken)
+	}
+
+	var header jwtHeader
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("%w: header: %v", ErrInvalidToken, err)
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("%w: signature: %v", ErrInvalidToken, err)
+	}
+	if err := v.verifySignature(header, parts[0]+"."+parts[1], sig); err != nil {
+		return nil, err
+	}
+
+	var claims Claims
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("%w: claims: %v", ErrInvalidToken, err)
+	}
+	if err := v.validate(claims); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+func (v *JWTVerifier) verifySignature(header jwtHeader, signed string, sig []byte) error {
+	digest := sha256.Sum256([]byte(signed))
+
+	switch header.Alg {
+	case HS256:
+		if len(v.Secret) == 0 {
+			return fmt.Errorf("%w: %s is not accepted", ErrInvalidToken, header.Alg)
+		}
+		mac := hmac.New(sha256.New, v.Secret)
+		mac.Write([]byte(signed))
+		if !hmac.Equal(mac.Sum(nil), sig) {
+			return fmt.Errorf("%w: bad signature", ErrInvalidToken)
+		}
+		return nil
+	case RS256, ES256:
+		if v.Keys == nil {
+			return fmt.Errorf("%w: %s is not accepted", ErrInvalidToken, header.Alg)
+		}
+		key, err := v.Keys.Key(header.Alg, header.Kid)
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidToken, err)
+		}
+		if verifyAsymmetric(header.Alg, key, digest[:], sig) {
+			return nil
+		}
+		return fmt.Errorf("%w: bad signature", ErrInvalidToken)
+	}
+	// none and the others
+	return fmt.Errorf("%w: unsupported alg %q", ErrInvalidToken, header.Alg)
+}
+
+func verifyAsymmetric(alg string, key crypto.PublicKey, digest, sig []byte) bool {
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		return alg == RS256 && rsa.VerifyPKCS1v15(k, crypto.SHA256, digest, sig) == nil
+	case *ecdsa.PublicKey:
+		if alg != ES256 || len(sig) != 64 {
+			return false
+		}
+		r := new(big.Int).SetBytes(sig[:32])
+		s := new(big.Int).SetBytes(sig[32:])
+		return ecdsa.Verify(k, digest, r, s)
+	}
+	return false
+}
+
+func (v *JWTVerifier) validate(claims Claims) error {
+	now := time.Now()
+	exp, ok := claims.Time("exp")
+	if !ok && !v.AllowNoExpiry {
+		return fmt.Errorf("%w: no exp", ErrInvalidClaims)
+	}
+	if ok && !now.Before(exp.Add(v.Leeway)) {
+		return ErrTokenExpired
+	}
+	if nbf, ok := claims.Time("nbf"); ok && now.Add(v.Leeway).Before(nbf) {
+		return ErrTokenExpired
+	}
+	if len(v.Issuer) > 0 && claims.String("iss") != v.Issuer {
+		return fmt.Errorf("%w: issuer %q", ErrInvalidClaims, claims.String("iss"))
+	}
+	if len(v.Audience) > 0 {
+		for _, aud := range claims.Strings("aud") {
+			if aud == v.Audience {
+				return nil
+			}
+		}
+		return fmt.Errorf("%w: audience %q", ErrInvalidClaims, claims.Strings("aud"))
+	}
+	return nil
+}
+
+// Sign returns a token of claims signed by key: the secret []byte for HS256, *rsa.PrivateKey
+// for RS256 and *ecdsa.PrivateKey for ES256. kid may be empty.
+func Sign(alg, kid string, key interface{}, claims Claims) (string, error) {
+	header, err := json.Marshal(jwtHeader{Alg: alg, Kid: kid, Typ: "JWT"})
+	if err != nil {
+		return "", err
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signed))
+
+	var sig []byte
+	switch k := key.(type) {
+	case []byte:
+		if alg != HS256 {
+			return "", fmt.Errorf("auth: a secret could not sign %s", alg)
+		}
+		mac := hmac.New(sha256.New, k)
+		mac.Write([]byte(signed))
+		sig = mac.Sum(nil)
+	case *rsa.PrivateKey:
+		if alg != RS256 {
+			return "", fmt.Errorf("auth: an RSA key could not sign %s", alg)
+		}
+		if sig, err = rsa.SignPKCS1v15(rand.Reader, k, crypto.SHA256, digest[:]); err != nil {
+			return "", err
+		}
+	case *ecdsa.PrivateKey:
+		if alg != ES256 {
+			return "", fmt.Errorf("auth: an ECDSA key could not sign %s", alg)
+		}
+		r, s, err := ecdsa.Sign(rand.Reader, k, digest[:])
+		if err != nil {
+			return "", err
+		}
+		// r and s are padded to 32 bytes
+		sig = make([]byte, 64)
+		rb, sb := r.Bytes(), s.Bytes()
+		copy(sig[32-len(rb):32], rb)
+		copy(sig[64-len(sb):], sb)
+	default:
+		return "", fmt.Errorf("auth: unsupported key %T", key)
+	}
+
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig), nil
+}
+
+func decodeSegment(seg string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return err
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	return dec.Decode(v)
+}
@@ -0,0 +1,93 @@
+package auth
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJWTVerifier(t *testing.T) {
+	secret := []byte("secret")
+	claims := Claims{"sub": "alice", "scope": "read write", "exp": time.Now().Add(time.Minute).Unix(), "iss": "me", "aud": []string{"you"}}
+
+	token, err := Sign(HS256, "", secret, claims)
+	assert.NoError(t, err)
+	v := &JWTVerifier{Secret: secret, Issuer: "me", Audience: "you"}
+	p, err := v.Verify(token)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "alice", p.Subject)
+		assert.Equal(t, []string{"read", "write"}, p.Scopes)
+		assert.True(t, p.HasScopes("read"))
+		assert.False(t, p.HasScopes("read", "admin"))
+	}
+
+	_, err = (&JWTVerifier{Secret: []byte("other")}).Verify(token)
+	assert.True(t, errors.Is(err, ErrInvalidToken))
+	_, err = (&JWTVerifier{Secret: secret, Audience: "them"}).Verify(token)
+	assert.True(t, errors.Is(err, ErrInvalidClaims))
+
+	claims["exp"] = time.Now().Add(-time.Minute).Unix()
+	expired, _ := Sign(HS256, "", secret, claims)
+	_, err = v.Verify(expired)
+	assert.Equal(t, ErrTokenExpired, err)
+	_, err = (&JWTVerifier{Secret: secret, Leeway: 2 * time.Minute}).Verify(expired)
+	assert.NoError(t, err)
+
+	// tokens without exp are refused unless AllowNoExpiry
+	delete(claims, "exp")
+	forever, _ := Sign(HS256, "", secret, claims)
+	_, err = (&JWTVerifier{Secret: secret}).Verify(forever)
+	assert.True(t, errors.Is(err, ErrInvalidClaims))
+	_, err = (&JWTVerifier{Secret: secret, AllowNoExpiry: true}).Verify(forever)
+	assert.NoError(t, err)
+
+	// asymmetric tokens are refused without keys, and the alg must match the key
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	claims["exp"] = time.Now().Add(time.Minute).Unix()
+	rs, err := Sign(RS256, "k1", rsaKey, claims)
+	assert.NoError(t, err)
+	es, err := Sign(ES256, "", ecKey, claims)
+	assert.NoError(t, err)
+
+	_, err = v.Verify(rs)
+	assert.True(t, errors.Is(err, ErrInvalidToken))
+	_, err = (&JWTVerifier{Keys: PublicKey{&rsaKey.PublicKey}}).Verify(rs)
+	assert.NoError(t, err)
+	_, err = (&JWTVerifier{Keys: PublicKey{&ecKey.PublicKey}}).Verify(es)
+	assert.NoError(t, err)
+	_, err = (&JWTVerifier{Keys: PublicKey{&ecKey.PublicKey}}).Verify(rs)
+	assert.True(t, errors.Is(err, ErrInvalidToken))
+}
+
+func TestHMACCredentials(t *testing.T) {
+	creds := NewHMACCredentials([]byte("secret"), "svc", "read")
+	md, err := creds.GetRequestMetadata(context.Background())
+	assert.NoError(t, err)
+
+	token, ok := BearerToken(md["authorization"])
+	assert.True(t, ok)
+	p, err := (&JWTVerifier{Secret: []byte("secret")}).Verify(token)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "svc", p.Subject)
+		assert.Equal(t, []string{"read"}, p.Scopes)
+	}
+
+	// the token is cached
+	again, _ := creds.Token()
+	assert.Equal(t, token, again)
+
+	// tokens require TLS unless insecure connections are allowed
+	assert.True(t, creds.RequireTransportSecurity())
+	creds.AllowInsecure = true
+	assert.False(t, creds.RequireTransportSecurity())
+	assert.True(t, TokenCredentials{Token: "token"}.RequireTransportSecurity())
+	assert.False(t, TokenCredentials{Token: "token", AllowInsecure: true}.RequireTransportSecurity())
+}
@@ -0,0 +1,17 @@
+package auth
+
+import (
+	"crypto/x509"
+)
+
+// CertificatePrincipal returns the Principal of a verified client certificate. Its Subject is
+// the first URI SAN, as a SPIFFE ID, or the first DNS SAN, or the common name.
+func CertificatePrincipal(cert *x509.Certificate) *Principal {
+	subject := cert.Subject.CommonName
+	if len(cert.URIs) > 0 {
+		subject = cert.URIs[0].String()
+	} else if len(cert.DNSNames) > 0 {
+		subject = cert.DNSNames[0]
+	}
+	return &Principal{Subject: subject, Method: MTLS}
+}
@@ -0,0 +1,74 @@
+package auth
+
+import (
+	"sync"
+	"time"
+
+	redis "gopkg.in/redis.v5"
+)
+
+// NonceStore remembers the nonces of signed requests to block replays
+type NonceStore interface {
+	// Seen remembers nonce for ttl, and reports whether it is remembered already
+	Seen(nonce string, ttl time.Duration) (bool, error)
+}
+
+// MemoryNonceStore remembers nonces in the process. Expired nonces are pruned as new ones are added.
+type MemoryNonceStore struct {
+	mu     sync.Mutex
+	nonces map[string]time.Time
+	pruned time.Time
+}
+
+// NewMemoryNonceStore returns a MemoryNonceStore
+func NewMemoryNonceStore() *MemoryNonceStore {
+	return &MemoryNonceStore{nonces: make(map[string]time.Time)}
+}
+
+// Seen implements NonceStore
+func (s *MemoryNonceStore) Seen(nonce string, ttl time.Duration) (bool, error) {
+	now := time.Now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// expired nonces are pruned at most once per ttl
+	if now.Sub(s.pruned) > ttl {
+		for n, expiry := range s.nonces {
+			if now.After(expiry) {
+				delete(s.nonces, n)
+			}
+		}
+		s.pruned = now
+	}
+
+	if expiry, ok := s.nonces[nonce]; ok && now.Before(expiry) {
+		return true, nil
+	}
+	s.nonces[nonce] = now.Add(ttl)
+	return false, nil
+}
+
+// RedisNonceStore remembers nonces in redis, shared by the instances of a service
+type RedisNonceStore struct {
+	Client *redis.Client
+	// Prefix of keys, "nonce:" by default
+	Prefix string
+}
+
+// NewRedisNonceStore returns a RedisNonceStore
+func NewRedisNonceStore(client *redis.Client, prefix string) *RedisNonceStore {
+	if len(prefix) == 0 {
+		prefix = "nonce:"
+	}
+	return &RedisNonceStore{Client: client, Prefix: prefix}
+}
+
+// Seen implements NonceStore
+func (s *RedisNonceStore) Seen(nonce string, ttl time.Duration) (bool, error) {
+	added, err := s.Client.SetNX(s.Prefix+nonce, 1, ttl).Result()
+	if err != nil {
+		return false, err
+	}
+	return !added, nil
+}
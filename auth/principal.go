@@ -0,0 +1,74 @@
+// Package auth verifies the identity of callers, by bearer tokens or mTLS certificates,
+// and carries the resulting Principal in the context.
+package auth
+
+import (
+	"context"
+	"errors"
+)
+
+const (
+	// None requires no authentication
+	None = "none"
+	// Token requires a bearer token
+	Token = "token"
+	// MTLS requires a verified client certificate
+	MTLS = "mtls"
+	// Any requires a bearer token or a verified client certificate
+	Any = "any"
+)
+
+var (
+	// ErrNoCredentials is returned when the caller presents no token or certificate
+	ErrNoCredentials = errors.New("auth: no credentials")
+)
+
+type principalKey struct{}
+
+// Verifier verifies bearer tokens
+type Verifier interface {
+	// Verify returns the Principal of token
+	Verify(token string) (*Principal, error)
+}
+
+// Principal is the authenticated caller
+type Principal struct {
+	// Subject is the sub claim of tokens, or the identity of certificates
+	Subject string
+	Scopes  []string
+	// Method is Token or MTLS
+	Method string
+	// Claims of the token, nil for certificates
+	Claims Claims
+}
+
+// HasScopes reports whether p has all the scopes
+func (p *Principal) HasScopes(scopes ...string) bool {
+	for _, s := range scopes {
+		found := false
+		for _, scope := range p.Scopes {
+			if scope == s {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// WithPrincipal returns a copy of ctx carrying p
+func WithPrincipal(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// PrincipalFromContext returns the Principal in ctx
+func PrincipalFromContext(ctx context.Context) (*Principal, bool) {
+	if ctx == nil {
+		return nil, false
+	}
+	p, ok := ctx.Value(principalKey{}).(*Principal)
+	return p, ok
+}
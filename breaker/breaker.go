@@ -0,0 +1,267 @@
+// Package breaker stops calls to a failing dependency. A circuit opens when the ratio of failures
+// in a rolling window is too high, rejects calls for a cool-down, then lets probes through half-open
+// and closes again when they succeed.
+package breaker
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// State of a circuit
+type State int
+
+const (
+	Closed State = iota
+	HalfOpen
+	Open
+)
+
+func (s State) String() string {
+	switch s {
+	case Closed:
+		return "closed"
+	case HalfOpen:
+		return "half_open"
+	case Open:
+		return "open"
+	}
+	return "unknown"
+}
+
+const buckets = 10
+
+var (
+	// ErrOpen is returned for calls rejected by an open circuit
+	ErrOpen = errors.New("breaker: circuit is open")
+	// ErrTooManyProbes is returned for calls over HalfOpenRequests of a half-open circuit
+	ErrTooManyProbes = errors.New("breaker: too many probes of half-open circuit")
+)
+
+// Settings of breakers. Zero fields take the defaults.
+type Settings struct {
+	// FailureRatio in Window opens the circuit, 0.5 by default
+	FailureRatio float64
+	// MinRequests in Window before the circuit could open, 20 by default
+	MinRequests int
+	// Window of counting failures, 10s by default
+	Window time.Duration
+	// CoolDown of the open circuit before it is half-open, 5s by default
+	CoolDown time.Duration
+	// HalfOpenRequests are the probes of the half-open circuit, which closes if all of them succeed. 1 by default.
+	HalfOpenRequests int
+	// OnStateChange is called after the circuit of name changes
+	OnStateChange func(name string, from, to State)
+}
+
+func (s Settings) withDefaults() Settings {
+	if s.FailureRatio <= 0 {
+		s.FailureRatio = 0.5
+	}
+	if s.MinRequests <= 0 {
+		s.MinRequests = 20
+	}
+	if s.Window <= 0 {
+		s.Window = 10 * time.Second
+	}
+	if s.CoolDown <= 0 {
+		s.CoolDown = 5 * time.Second
+	}
+	if s.HalfOpenRequests <= 0 {
+		s.HalfOpenRequests = 1
+	}
+	return s
+}
+
+type counts struct {
+	requests, failures int
+}
+
+// Breaker is the circuit breaker of a dependency
+type Breaker struct {
+	name     string
+	settings Settings
+
+	mu    sync.Mutex
+	state State
+	// generation changes with state, results of calls of older generations are ignored
+	generation uint64
+	buckets    [buckets]counts
+	bucket     int64
+	openedAt   time.Time
+	probes     int
+	succeeded  int
+	changes    []change
+}
+
+type change struct {
+	from, to State
+}
+
+// New returns a closed Breaker of name
+func New(name string, settings Settings) *Breaker {
+	return &Breaker{name: name, settings: settings.withDefaults()}
+}
+
+// Name of b
+func (b *Breaker) Name() string {
+	return b.name
+}
+
+// State of b
+func (b *Breaker) State() State {
+	b.mu.Lock()
+	defer b.unlock()
+	b.refresh(time.Now())
+	return b.state
+}
+
+// Allow returns ErrOpen or ErrTooManyProbes if the call is rejected, or the function to report
+// whether the allowed call succeeds
+func (b *Breaker) Allow() (func(success bool), error) {
+	now := time.Now()
+
+	b.mu.Lock()
+	defer b.unlock()
+	b.refresh(now)
+
+	switch b.state {
+	case Open:
+		return nil, ErrOpen
+	case HalfOpen:
+		if b.probes >= b.settings.HalfOpenRequests {
+			return nil, ErrTooManyProbes
+		}
+		b.probes++
+	}
+
+	generation := b.generation
+	return func(success bool) {
+		b.mu.Lock()
+		defer b.unlock()
+		if b.generation == generation {
+			b.report(time.Now(), success)
+		}
+	}, nil
+}
+
+// Do calls fn if it is allowed, and counts errors of fn as failures
+func (b *Breaker) Do(fn func() error) error {
+	done, err := b.Allow()
+	if err != nil {
+		return err
+	}
+	err = fn()
+	done(err == nil)
+	return err
+}
+
+func (b *Breaker) report(now time.Time, success bool) {
+	switch b.state {
+	case HalfOpen:
+		if !success {
+			b.setState(Open, now)
+			return
+		}
+		if b.succeeded++; b.succeeded >= b.settings.HalfOpenRequests {
+			b.setState(Closed, now)
+		}
+	case Closed:
+		b.advance(now)
+		c := &b.buckets[b.bucket%buckets]
+		c.requests++
+		if success {
+			return
+		}
+		c.failures++
+
+		var total counts
+		for _, c := range b.buckets {
+			total.requests += c.requests
+			total.failures += c.failures
+		}
+		if total.requests >= b.settings.MinRequests &&
+			float64(total.failures) >= b.settings.FailureRatio*float64(total.requests) {
+			b.setState(Open, now)
+		}
+	}
+}
+
+// refresh turns an open circuit half-open after the cool-down
+func (b *Breaker) refresh(now time.Time) {
+	if b.state == Open && now.Sub(b.openedAt) >= b.settings.CoolDown {
+		b.setState(HalfOpen, now)
+	}
+}
+
+// advance clears the buckets passed since the last count
+func (b *Breaker) advance(now time.Time) {
+	bucket := now.UnixNano() / int64(b.settings.Window/buckets)
+	if bucket-b.bucket >= buckets {
+		b.buckets = [buckets]counts{}
+	} else {
+		for i := b.bucket + 1; i <= bucket; i++ {
+			b.buckets[i%buckets] = counts{}
+		}
+	}
+	b.bucket = bucket
+}
+
+func (b *Breaker) setState(state State, now time.Time) {
+	if b.state == state {
+		return
+	}
+	b.changes = append(b.changes, change{from: b.state, to: state})
+	b.state = state
+	b.generation++
+	b.buckets = [buckets]counts{}
+	b.probes, b.succeeded = 0, 0
+	if state == Open {
+		b.openedAt = now
+	}
+}
+
+// unlock unlocks b and notifies the state changes
+func (b *Breaker) unlock() {
+	changes := b.changes
+	b.changes = nil
+	b.mu.Unlock()
+
+	if b.settings.OnStateChange != nil {
+		for _, c := range changes {
+			b.settings.OnStateChange(b.name, c.from, c.to)
+		}
+	}
+}
+
+// Group holds a breaker per target, created on first use
+type Group struct {
+	settings Settings
+
+	mu       sync.RWMutex
+	breakers map[string]*Breaker
+}
+
+// NewGroup returns a Group of breakers with settings
+func NewGroup(settings Settings) *Group {
+	return &Group{settings: settings, breakers: make(map[string]*Breaker)}
+}
+
+// Get returns the breaker of name
+func (g *Group) Get(name string) *Breaker {
+	g.mu.RLock()
+	b, ok := g.breakers[name]
+	g.mu.RUnlock()
+	if ok {
+		return b
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if b, ok = g.breakers[name]; !ok {
+		b = New(name, g.settings)
+		g.breakers[name] = b
+	}
+	return b
+}
@@ -0,0 +1,69 @@
+package breaker
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBreaker(t *testing.T) {
+	var changes []string
+	b := New("db", Settings{
+		FailureRatio: 0.5,
+		MinRequests:  4,
+		CoolDown:     20 * time.Millisecond,
+		OnStateChange: func(name string, from, to State) {
+			changes = append(changes, name+":"+from.String()+">"+to.String())
+		},
+	})
+	fail := func() error { return errors.New("down") }
+	ok := func() error { return nil }
+
+	// the ratio is not considered before MinRequests
+	assert.Error(t, b.Do(fail))
+	assert.Error(t, b.Do(fail))
+	assert.NoError(t, b.Do(ok))
+	assert.Equal(t, Closed, b.State())
+	assert.Error(t, b.Do(fail))
+	assert.Equal(t, Open, b.State())
+	assert.Equal(t, ErrOpen, b.Do(ok))
+
+	// a probe is allowed after the cool-down, and reopens the circuit if it fails
+	time.Sleep(20 * time.Millisecond)
+	assert.Equal(t, HalfOpen, b.State())
+	done, err := b.Allow()
+	assert.NoError(t, err)
+	_, err = b.Allow()
+	assert.Equal(t, ErrTooManyProbes, err)
+	done(false)
+	assert.Equal(t, Open, b.State())
+
+	time.Sleep(20 * time.Millisecond)
+	assert.NoError(t, b.Do(ok))
+	assert.Equal(t, Closed, b.State())
+
+	assert.Equal(t, []string{
+		"db:closed>open", "db:open>half_open", "db:half_open>open", "db:open>half_open", "db:half_open>closed",
+	}, changes)
+}
+
+func TestBreakerIgnoresOldCalls(t *testing.T) {
+	b := New("db", Settings{MinRequests: 1, CoolDown: time.Hour})
+	slow, _ := b.Allow()
+	assert.Error(t, b.Do(func() error { return errors.New("down") }))
+	assert.Equal(t, Open, b.State())
+
+	// the result of a call allowed before the circuit opened does not count
+	slow(true)
+	assert.Equal(t, Open, b.State())
+}
+
+func TestGroup(t *testing.T) {
+	g := NewGroup(Settings{MinRequests: 1})
+	assert.Same(t, g.Get("a"), g.Get("a"))
+	g.Get("a").Do(func() error { return errors.New("down") })
+	assert.Equal(t, Open, g.Get("a").State())
+	assert.Equal(t, Closed, g.Get("b").State())
+}
@@ -0,0 +1,45 @@
+package breaker
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var _ prometheus.Collector = &Metrics{}
+
+// Metrics of the state of breakers, labelled by name. OnStateChange is the hook of Settings.
+type Metrics struct {
+	state   *prometheus.GaugeVec
+	changes *prometheus.CounterVec
+}
+
+// NewMetrics returns the Metrics of breakers
+func NewMetrics() *Metrics {
+	return &Metrics{
+		state: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "circuit_breaker_state",
+			Help: "state of circuit breakers, 0 closed, 1 half-open and 2 open",
+		}, []string{"name"}),
+		changes: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "circuit_breaker_state_changes_total",
+			Help: "total number of state changes of circuit breakers",
+		}, []string{"name", "from", "to"}),
+	}
+}
+
+// OnStateChange records a state change
+func (m *Metrics) OnStateChange(name string, from, to State) {
+	m.state.WithLabelValues(name).Set(float64(to))
+	m.changes.WithLabelValues(name, from.String(), to.String()).Inc()
+}
+
+// Describe implements prometheus.Collector
+func (m *Metrics) Describe(ch chan<- *prometheus.Desc) {
+	m.state.Describe(ch)
+	m.changes.Describe(ch)
+}
+
+// Collect implements prometheus.Collector
+func (m *Metrics) Collect(ch chan<- prometheus.Metric) {
+	m.state.Collect(ch)
+	m.changes.Collect(ch)
+}
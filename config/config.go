@@ -2,6 +2,7 @@ package config
 
 import (
 	"fmt"
+	"time"
 )
 
 const (
@@ -13,17 +14,48 @@ const (
 
 	RotateByDay  = "day"
 	RotateBySize = "size"
+
+	RoleMaster  = "master"
+	RoleReplica = "replica"
+
+	DriverMySQL = "mysql"
+
+	BackendEtcd = "etcd"
+	BackendFile = "file"
+	BackendDNS  = "dns"
+
+	ExporterStdout = "stdout"
+	ExporterMemory = "memory"
+
+	LimiterTokenBucket   = "token_bucket"
+	LimiterSlidingWindow = "sliding_window"
+	LimiterLocal         = "local"
+	LimiterRedis         = "redis"
 )
 
 // AppConfig for application
 type AppConfig struct {
-	Name  string
-	Mode  string
-	Host  string
-	Port  int
-	Log   LogConfig
-	Mysql MysqlConfig
-	Redis RedisConfig
+	Name string
+	Mode string
+	Host string
+	Port int
+	// MetricsAddr serves the metrics at /metrics if it is not empty, as ":9090"
+	MetricsAddr string
+	Log         LogConfig
+	Mysql       MysqlConfig
+	Redis       RedisConfig
+	Discovery   DiscoveryConfig
+	// GrpcClients are the [[grpc_client]] sections
+	GrpcClients []GrpcClientConfig
+	// HTTPClients are the [[http_client]] sections
+	HTTPClients []HTTPClientConfig
+	// GrpcAuth is the [grpc_auth] section of the gRPC server
+	GrpcAuth GrpcAuthConfig
+	// JWT is the [jwt] section verifying the tokens of web requests
+	JWT JWTConfig
+	// RateLimit is the [ratelimit] section
+	RateLimit RateLimitConfig
+	Otel      OtelConfig
 }
 
 type sessionConfig struct {
@@ -48,11 +80,19 @@ type MysqlConfig struct {
 	Instances []MysqlInstance
 	InitMySQL bool
 	Ping      bool
+	Metrics   bool
+	// Trace emits a trace span for every statement
+	Trace bool
+	// SlowThreshold enables the slow query log when it is positive
+	SlowThreshold time.Duration
+	// RedactArgs hides the values of args in the slow query log
+	RedactArgs bool
 }
 
 // MysqlInstance represents a single instance of mysql server
 type MysqlInstance struct {
 	Name     string `json:"name"`
+	Driver   string `json:"driver"`
 	Host     string `json:"host"`
 	User     string `json:"user"`
 	Pwd      string `json:"password"`
@@ -67,10 +107,35 @@ func (inst MysqlInstance) String() string {
 	return fmt.Sprintf("%s:%s@tcp(%s:%d)/%s?charset=utf8&%s", inst.User, inst.Pwd, inst.Host, inst.Port, inst.Db, inst.Option)
 }
 
+// DriverName returns the database/sql driver of the instance, mysql by default
+func (inst MysqlInstance) DriverName() string {
+	if len(inst.Driver) == 0 {
+		return DriverMySQL
+	}
+	return inst.Driver
+}
+
+// DSN returns the data source name for DriverName. Drivers other than mysql use Db as the DSN.
+func (inst MysqlInstance) DSN() string {
+	if inst.DriverName() == DriverMySQL {
+		return inst.String()
+	}
+	return inst.Db
+}
+
+// Role returns RoleReplica for read-only instances and RoleMaster otherwise
+func (inst MysqlInstance) Role() string {
+	if inst.ReadOnly {
+		return RoleReplica
+	}
+	return RoleMaster
+}
+
 // RedisConfig for redis
 type RedisConfig struct {
 	InitRedis bool
 	Ping      bool
+	Metrics   bool
 	RedisInstance
 }
 
@@ -81,9 +146,229 @@ type RedisInstance struct {
 	Pwd  string `json:"password"`
 	Port int    `json:"port"`
 	Db   int    `json:"database"`
+	// ReadOnly is a replica
+	ReadOnly bool `json:"read_only"`
 }
 
 // Address returns the address of redis server
 func (inst RedisInstance) Address() string {
 	return fmt.Sprintf("%s:%d", inst.Host, inst.Port)
 }
+
+// Role returns RoleReplica for read-only instances and RoleMaster otherwise
+func (inst RedisInstance) Role() string {
+	if inst.ReadOnly {
+		return RoleReplica
+	}
+	return RoleMaster
+}
+
+// DiscoveryConfig for registering the app at registry
+type DiscoveryConfig struct {
+	Enable bool
+	// Backend is one of etcd, file and dns, etcd by default. The app is not registered with dns,
+	// whose records are maintained outside of the app and carry the weight of SRV records only.
+	Backend   string
+	Endpoints []string
+	Prefix    string
+	// TTL in second of the registered key
+	TTL int
+	// Name of the service, app name by default
+	Name string
+	// Host advertised to clients, app host or the local IP by default
+	Host     string
+	Version  string
+	Zone     string
+	Protocol string
+	Weight   int
+	Tags     []string
+	Metadata map[string]string
+
+	// File listing the instances, for file backend
+	File string
+	// Domain appended to the service name, for dns backend
+	Domain string
+	// SRV is the service label of SRV records, as "grpc" in "_grpc._tcp.{name}.{Domain}".
+	// A records are looked up if it is empty.
+	SRV string
+	// DNSPort is the port of the instances of A records, unless targets have one as "hello:8080"
+	DNSPort int
+	// Refresh is the interval of reading File or looking up DNS
+	Refresh time.Duration
+}
+
+// BackendName returns Backend, or etcd if it is empty
+func (c DiscoveryConfig) BackendName() string {
+	if len(c.Backend) == 0 {
+		return BackendEtcd
+	}
+	return c.Backend
+}
+
+// GrpcClientConfig for a gRPC client
+type GrpcClientConfig struct {
+	// Name to get the client by
+	Name string
+	// Target is a service name resolved by discovery, an address as "127.0.0.1:8080",
+	// or a gRPC target with scheme as "dns:///hello:8080"
+	Target string
+	// Balancer is the load balancing policy, weighted_round_robin by default
+	Balancer string
+	// Timeout of calls without deadline
+	Timeout time.Duration
+	// MethodTimeouts overrides Timeout by full method name, as "/pkg.Service/Method"
+	MethodTimeouts map[string]time.Duration `mapstructure:"method_timeouts"`
+	// Retries of calls failing with RetryCodes, Unavailable by default
+	Retries    int
+	RetryCodes []string `mapstructure:"retry_codes"`
+	// RetryMethods are the idempotent methods to retry, as "/pkg.Service/Method" or "/pkg.Service/*".
+	// They are required by Retries, so writes are never sent twice by omission.
+	RetryMethods []string `mapstructure:"retry_methods"`
+	// RetryBackoff is the first backoff between retries, it doubles after every retry
+	RetryBackoff time.Duration `mapstructure:"retry_backoff"`
+
+	TLS bool
+	// CAFile verifies the server, system roots are used if it is empty
+	CAFile string `mapstructure:"ca_file"`
+	// CertFile and KeyFile are the client certificate
+	CertFile   string `mapstructure:"cert_file"`
+	KeyFile    string `mapstructure:"key_file"`
+	ServerName string `mapstructure:"server_name"`
+
+	// Token is a static bearer token sent with every call
+	Token string
+	// AuthSecret signs HS256 tokens of AuthSubject with AuthScopes, if Token is empty
+	AuthSecret  string   `mapstructure:"auth_secret"`
+	AuthSubject string   `mapstructure:"auth_subject"`
+	AuthScopes  []string `mapstructure:"auth_scopes"`
+	// AuthInsecure sends the tokens without TLS, they are refused on insecure connections by default
+	AuthInsecure bool `mapstructure:"auth_insecure"`
+
+	// Breaker of the target, the [grpc_client.breaker] section
+	Breaker BreakerConfig
+}
+
+// BreakerConfig for circuit breakers. Zero fields take the defaults of breaker.Settings.
+type BreakerConfig struct {
+	Enable bool
+	// FailureRatio in Window opens the circuit
+	FailureRatio float64 `mapstructure:"failure_ratio"`
+	// MinRequests in Window before the circuit could open
+	MinRequests int `mapstructure:"min_requests"`
+	Window      time.Duration
+	// CoolDown of the open circuit before probes are allowed
+	CoolDown time.Duration `mapstructure:"cool_down"`
+	// HalfOpenRequests are the probes closing the circuit if they succeed
+	HalfOpenRequests int `mapstructure:"half_open_requests"`
+}
+
+// HTTPClientConfig for a util.HTTPClient with its own transport. Zero fields take the defaults
+// of http.DefaultTransport.
+type HTTPClientConfig struct {
+	// Name to get the client by
+	Name string
+	// Timeout of requests including reading the body, none if it is zero
+	Timeout time.Duration
+
+	MaxIdleConns        int `mapstructure:"max_idle_conns"`
+	MaxIdleConnsPerHost int `mapstructure:"max_idle_conns_per_host"`
+	// MaxConnsPerHost limits the connections to a host, including the ones in use
+	MaxConnsPerHost       int           `mapstructure:"max_conns_per_host"`
+	IdleConnTimeout       time.Duration `mapstructure:"idle_conn_timeout"`
+	DialTimeout           time.Duration `mapstructure:"dial_timeout"`
+	KeepAlive             time.Duration `mapstructure:"keep_alive"`
+	TLSHandshakeTimeout   time.Duration `mapstructure:"tls_handshake_timeout"`
+	ResponseHeaderTimeout time.Duration `mapstructure:"response_header_timeout"`
+	// Proxy is a URL, or "direct" for no proxy. The proxy of environment is used if it is empty.
+	Proxy        string
+	DisableHTTP2 bool `mapstructure:"disable_http2"`
+
+	// CAFile verifies servers, system roots are used if it is empty
+	CAFile string `mapstructure:"ca_file"`
+	// CertFile and KeyFile are the client certificate
+	CertFile           string `mapstructure:"cert_file"`
+	KeyFile            string `mapstructure:"key_file"`
+	InsecureSkipVerify bool   `mapstructure:"insecure_skip_verify"`
+
+	// MaxAttempts retries idempotent requests if it is over 1
+	MaxAttempts  int           `mapstructure:"max_attempts"`
+	RetryBackoff time.Duration `mapstructure:"retry_backoff"`
+	// Breaker of every host, the [http_client.breaker] section
+	Breaker BreakerConfig
+}
+
+// GrpcAuthConfig for authenticating the calls of the gRPC server
+type GrpcAuthConfig struct {
+	Enable bool
+	// JWT verifies bearer tokens, its keys are in the [grpc_auth] section
+	JWT JWTConfig `mapstructure:",squash"`
+	// Default auth of methods not in Methods: none, token, mtls or any. token by default.
+	Default string
+	// Scopes required by Default
+	Scopes []string
+	// Methods are the [[grpc_auth.method]] sections
+	Methods []GrpcMethodAuth `mapstructure:"method"`
+
+	// TLS serves with CertFile and KeyFile. Client certificates are verified by ClientCAFile for mTLS.
+	TLS          bool
+	CertFile     string `mapstructure:"cert_file"`
+	KeyFile      string `mapstructure:"key_file"`
+	ClientCAFile string `mapstructure:"client_ca_file"`
+}
+
+// JWTConfig for verifying JWT bearer tokens
+type JWTConfig struct {
+	// Secret verifies HS256 tokens
+	Secret string
+	// PublicKeyFile verifies RS256 and ES256 tokens, a PEM public key or certificate
+	PublicKeyFile string `mapstructure:"public_key_file"`
+	// JWKS is a file or URL of a JSON Web Key Set verifying RS256 and ES256 tokens, instead of PublicKeyFile
+	JWKS string `mapstructure:"jwks"`
+	// JWKSRefresh is the time the keys of JWKS are cached, an hour by default
+	JWKSRefresh time.Duration `mapstructure:"jwks_refresh"`
+	// Issuer and Audience of tokens are checked if they are not empty
+	Issuer   string
+	Audience string
+	// Leeway of exp and nbf for clock skew
+	Leeway time.Duration
+	// AllowNoExpiry accepts tokens without exp
+	AllowNoExpiry bool `mapstructure:"allow_no_expiry"`
+}
+
+// GrpcMethodAuth is the auth of a method
+type GrpcMethodAuth struct {
+	// Name is the full method name as "/pkg.Service/Method", or "/pkg.Service/*" for all methods of the service
+	Name string
+	// Auth is none, token, mtls or any, the Default of [grpc_auth] if it is empty
+	Auth   string
+	Scopes []string
+}
+
+// RateLimitConfig for a rate limiter of Limit requests per Period
+type RateLimitConfig struct {
+	// Algorithm is token_bucket or sliding_window, token_bucket by default
+	Algorithm string
+	// Backend is local or redis, local by default. The redis of the app is shared by instances.
+	Backend string
+	Limit   int
+	Period  time.Duration
+	// Burst of token buckets, Limit by default
+	Burst int
+	// Prefix of redis keys
+	Prefix string
+}
+
+// OtelConfig for the OpenTelemetry tracer provider
+type OtelConfig struct {
+	Enable bool
+	// Exporter is stdout or memory, stdout by default. An exporter set as "otel.exporter"
+	// in the app is used instead.
+	Exporter string
+	// File the stdout exporter writes to, stdout if it is empty
+	File string
+	// ServiceName is the service.name of spans, app name by default
+	ServiceName string
+	// SampleRatio of the traces started by this service: none if it is 0, and all if it is at least 1
+	// or unset. Traces of callers follow the decision of the caller.
+	SampleRatio *float64
+}
@@ -1,10 +1,11 @@
 package main
 
 import (
+	"log"
+
 	"github.com/silentred/toolkit/example/grpc/proto"
 	"github.com/silentred/toolkit/interceptor"
 	"github.com/silentred/toolkit/service"
-	"github.com/silentred/toolkit/service/discovery"
 	"golang.org/x/net/context"
 	"google.golang.org/grpc"
 )
@@ -19,14 +20,43 @@ func (s *helloSvc) SayHello(ctx context.Context, in *proto.HelloReq) (*proto.Hel
 
 func main() {
 	app := service.NewGrpcApp(nil)
-	app.RegisterHook(service.ServiceHook, initService)
 	app.Initialize()
 
+	// metrics are served at app.metricsAddr
+	metrics, err := service.GrpcServerMetrics(app)
+	if err != nil {
+		log.Fatal(err)
+	}
+
 	// create grpc server
-	chain := interceptor.UnaryInterceptorChain(interceptor.NewRecovery(app.DefaultLogger()),
-		interceptor.NewLogInterceptor(app.DefaultLogger()))
-	opt := grpc.UnaryInterceptor(chain)
-	s := grpc.NewServer(opt)
+	unary := []grpc.UnaryServerInterceptor{interceptor.NewTracingInterceptor(), interceptor.NewRequestIDInterceptor(),
+		interceptor.NewRecovery(app.DefaultLogger()),
+		interceptor.NewLogInterceptor(app.DefaultLogger()), metrics.UnaryServerInterceptor()}
+	stream := []grpc.StreamServerInterceptor{interceptor.NewStreamTracingInterceptor(), interceptor.NewStreamRequestIDInterceptor(),
+		interceptor.NewStreamRecovery(app.DefaultLogger()),
+		interceptor.NewStreamLogInterceptor(app.DefaultLogger()), metrics.StreamServerInterceptor()}
+
+	// calls are authenticated as configured in [grpc_auth]
+	authenticator, err := service.GrpcServerAuth(app)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if authenticator != nil {
+		unary = append(unary, authenticator.UnaryServerInterceptor())
+		stream = append(stream, authenticator.StreamServerInterceptor())
+	}
+	opts := []grpc.ServerOption{
+		grpc.UnaryInterceptor(interceptor.UnaryInterceptorChain(unary...)),
+		grpc.StreamInterceptor(interceptor.StreamInterceptorChain(stream...)),
+	}
+	creds, err := service.GrpcServerCredentials(app)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if creds != nil {
+		opts = append(opts, grpc.Creds(creds))
+	}
+	s := grpc.NewServer(opts...)
 
 	// register
 	hello := &helloSvc{}
@@ -37,13 +67,3 @@ func main() {
 
 	app.ListenAndServe()
 }
-
-func initService(app service.Application) error {
-	s := discovery.NewService("hello", "127.0.0.1", app.GetConfig().Port)
-	p := discovery.NewEtcdPublisher([]string{"http://localhost:2379"}, 10)
-	app.Inject(p)
-	p.Register(s)
-	go p.Heartbeat(s)
-
-	return nil
-}
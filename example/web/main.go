@@ -2,11 +2,13 @@ package main
 
 import (
 	"flag"
+	"fmt"
 
 	redis "gopkg.in/redis.v5"
 
 	"github.com/labstack/echo/v4"
 
+	"github.com/silentred/toolkit/filter"
 	"github.com/silentred/toolkit/service"
 )
 
@@ -31,6 +33,11 @@ func initService(app service.Application) error {
 
 func initRoute(app service.Application) error {
 	if web, ok := app.(service.WebApplication); ok {
+		limiter, err := service.RateLimiter(app)
+		if err != nil {
+			return err
+		}
+		web.GetRouter().Use(filter.Tracing(), filter.RequestID(), filter.Logger(app.DefaultLogger()), filter.RateLimit(limiter))
 		web.GetRouter().GET("/", func(ctx echo.Context) error {
 			var ret string
 			if _, ok := app.Get("mysql").(*service.MysqlManager); ok {
@@ -46,6 +53,22 @@ func initRoute(app service.Application) error {
 			ret += "hello world \n"
 			return ctx.String(200, ret)
 		})
+
+		// routes of /api require tokens verified by [jwt]
+		verifier, err := service.JWTVerifier(app)
+		if err != nil {
+			return err
+		}
+		api := web.GetRouter().Group("/api", filter.JWTWithConfig(filter.JWTConfig{
+			Verifier: verifier,
+			Claims:   map[string]string{"sub": "user"},
+		}), filter.RateLimitWithConfig(filter.RateLimitConfig{Limiter: limiter, Key: filter.KeyByPrincipal}))
+		api.GET("/me", func(ctx echo.Context) error {
+			return ctx.String(200, fmt.Sprintf("%v", ctx.Get("user")))
+		})
+		api.DELETE("/cache", func(ctx echo.Context) error {
+			return ctx.NoContent(204)
+		}, filter.RequireScopes("admin"))
 	}
 	return nil
 }
@@ -0,0 +1,135 @@
+package filter
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"github.com/silentred/toolkit/auth"
+	"github.com/silentred/toolkit/util"
+)
+
+const (
+	// PrincipalKey is the key of the *auth.Principal in the echo context
+	PrincipalKey = "principal"
+)
+
+var (
+	ErrUnauthorized      = util.NewError(400401, "unauthorized")
+	ErrInsufficientScope = util.NewError(400402, "insufficient scope")
+)
+
+type (
+	// JWTConfig defines the config for JWT middleware.
+	JWTConfig struct {
+		// Skipper defines a function to skip middleware.
+		Skipper Skipper
+		// Verifier verifies the bearer token of the Authorization header
+		Verifier auth.Verifier
+		// QueryParam is the query param of the token when there is no Authorization header,
+		// as for websockets. Tokens in queries are not accepted if it is empty.
+		QueryParam string
+		// Claims maps claim names to keys of the echo context, as {"sub": "user_id"}
+		Claims map[string]string
+		// Scopes required of all routes. Routes may require more with RequireScopes.
+		Scopes []string
+		// Logger logs rejected tokens, optional
+		Logger util.Logger
+	}
+)
+
+// JWT middleware verifies the bearer token of requests, and stores the principal in the context
+// of the request and as PrincipalKey in the echo context.
+func JWT(verifier auth.Verifier) echo.MiddlewareFunc {
+	return JWTWithConfig(JWTConfig{Verifier: verifier})
+}
+
+// JWTWithConfig returns a JWT middleware with config.
+func JWTWithConfig(config JWTConfig) echo.MiddlewareFunc {
+	if config.Skipper == nil {
+		config.Skipper = DefaultSkipper
+	}
+	if config.Verifier == nil {
+		panic("filter: JWT middleware requires a verifier")
+	}
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if config.Skipper(c) {
+				return next(c)
+			}
+
+			token, ok := bearerToken(c, config.QueryParam)
+			if !ok {
+				return unauthorized(c, "")
+			}
+			p, err := config.Verifier.Verify(token)
+			if err != nil {
+				if config.Logger != nil {
+					config.Logger.Infof("reject token of %s %s: %v", c.Request().Method, c.Path(), err)
+				}
+				return unauthorized(c, "invalid_token")
+			}
+
+			c.Set(PrincipalKey, p)
+			for claim, key := range config.Claims {
+				if v, ok := p.Claims[claim]; ok {
+					c.Set(key, v)
+				}
+			}
+			req := c.Request()
+			c.SetRequest(req.WithContext(auth.WithPrincipal(req.Context(), p)))
+
+			if !p.HasScopes(config.Scopes...) {
+				return insufficientScope(c, config.Scopes)
+			}
+			return next(c)
+		}
+	}
+}
+
+// RequireScopes middleware rejects requests whose principal, stored by JWT, lacks any of the scopes.
+// It is added to routes, as e.GET("/admin", handler, filter.RequireScopes("admin")).
+func RequireScopes(scopes ...string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			p, ok := c.Get(PrincipalKey).(*auth.Principal)
+			if !ok {
+				return unauthorized(c, "")
+			}
+			if !p.HasScopes(scopes...) {
+				return insufficientScope(c, scopes)
+			}
+			return next(c)
+		}
+	}
+}
+
+func bearerToken(c echo.Context, queryParam string) (string, bool) {
+	if value := c.Request().Header.Get(auth.HeaderAuthorization); len(value) > 0 {
+		return auth.BearerToken(value)
+	}
+	if len(queryParam) > 0 {
+		if token := c.QueryParam(queryParam); len(token) > 0 {
+			return token, true
+		}
+	}
+	return "", false
+}
+
+// unauthorized responds 401 with the WWW-Authenticate header of RFC 6750
+func unauthorized(c echo.Context, reason string) error {
+	challenge := "Bearer"
+	if len(reason) > 0 {
+		challenge += fmt.Sprintf(" error=%q", reason)
+	}
+	c.Response().Header().Set(echo.HeaderWWWAuthenticate, challenge)
+	return c.JSON(http.StatusUnauthorized, ErrUnauthorized)
+}
+
+func insufficientScope(c echo.Context, scopes []string) error {
+	c.Response().Header().Set(echo.HeaderWWWAuthenticate,
+		fmt.Sprintf("Bearer error=\"insufficient_scope\", scope=%q", strings.Join(scopes, " ")))
+	return c.JSON(http.StatusForbidden, ErrInsufficientScope)
+}
@@ -0,0 +1,56 @@
+package filter
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/silentred/toolkit/auth"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJWT(t *testing.T) {
+	verifier := &auth.JWTVerifier{Secret: []byte("secret"), Issuer: "test"}
+
+	e := echo.New()
+	e.Use(JWTWithConfig(JWTConfig{Verifier: verifier, Claims: map[string]string{"sub": "user"}}))
+	e.GET("/me", func(c echo.Context) error {
+		p, _ := auth.PrincipalFromContext(c.Request().Context())
+		return c.String(http.StatusOK, c.Get("user").(string)+" "+p.Subject)
+	})
+	e.GET("/admin", func(c echo.Context) error {
+		return c.NoContent(http.StatusOK)
+	}, RequireScopes("admin"))
+
+	get := func(path string, claims auth.Claims) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if claims != nil {
+			token, err := auth.Sign(auth.HS256, "", []byte("secret"), claims)
+			assert.NoError(t, err)
+			req.Header.Set(echo.HeaderAuthorization, "Bearer "+token)
+		}
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	exp := time.Now().Add(time.Minute).Unix()
+	rec := get("/me", auth.Claims{"sub": "alice", "iss": "test", "exp": exp})
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "alice alice", rec.Body.String())
+
+	rec = get("/me", nil)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.Equal(t, "Bearer", rec.Header().Get(echo.HeaderWWWAuthenticate))
+	rec = get("/me", auth.Claims{"sub": "alice", "iss": "other", "exp": exp})
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	rec = get("/me", auth.Claims{"sub": "alice", "iss": "test", "exp": time.Now().Add(-time.Minute).Unix()})
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+
+	rec = get("/admin", auth.Claims{"sub": "alice", "iss": "test", "exp": exp, "scope": "read"})
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	rec = get("/admin", auth.Claims{"sub": "alice", "iss": "test", "exp": exp, "scope": "read admin"})
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
@@ -84,6 +84,8 @@ func LoggerWithConfig(config LoggerConfig) echo.MiddlewareFunc {
 				"bytes_in":    cl,
 				"bytes_out":   strconv.FormatInt(res.Size, 10),
 			}
+			// RequestID may run inside, and replace the request
+			util.AddRequestID(json, c.Request().Context())
 
 			config.Logger.Infoj(json)
 			return
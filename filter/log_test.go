@@ -0,0 +1,34 @@
+package filter
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	elog "github.com/labstack/gommon/log"
+	cfg "github.com/silentred/toolkit/config"
+	"github.com/silentred/toolkit/util"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoggerRequestID(t *testing.T) {
+	var buf bytes.Buffer
+	logger := util.NewLogger("test", elog.DEBUG, cfg.LogConfig{Providor: cfg.ProvidorStdOut})
+	logger.SetOutput(&buf)
+
+	// Logger is outermost, RequestID replaces the request inside it
+	e := echo.New()
+	e.Use(LoggerWithConfig(LoggerConfig{Logger: logger}), RequestID())
+	e.GET("/", func(c echo.Context) error {
+		return c.NoContent(http.StatusOK)
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set(util.HeaderRequestID, "req-1")
+	e.ServeHTTP(httptest.NewRecorder(), req)
+
+	assert.Contains(t, buf.String(), "request_id=`req-1`")
+	assert.Contains(t, buf.String(), "trace_id=`")
+}
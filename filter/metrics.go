@@ -1,6 +1,7 @@
 package filter
 
 import (
+	"sync"
 	"time"
 
 	"github.com/labstack/echo/v4"
@@ -18,6 +19,8 @@ var (
 		Name: "req_duration_us",
 		Help: "latency of request in microsecond",
 	}, []string{"service"})
+
+	registerOnce sync.Once
 )
 
 // func init() {
@@ -30,8 +33,11 @@ var (
 // }
 
 func GetPrometheusLogHandler() echo.HandlerFunc {
-	prometheus.MustRegister(reqCount)
-	prometheus.MustRegister(reqDuration)
+	// registered once, getting the handler again does not panic
+	registerOnce.Do(func() {
+		prometheus.MustRegister(reqCount)
+		prometheus.MustRegister(reqDuration)
+	})
 
 	handler := func(e echo.Context) error {
 		promhttp.Handler().ServeHTTP(e.Response().Writer, e.Request())
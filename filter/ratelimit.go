@@ -0,0 +1,106 @@
+package filter
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/silentred/toolkit/auth"
+	"github.com/silentred/toolkit/ratelimit"
+	"github.com/silentred/toolkit/util"
+)
+
+const (
+	HeaderRateLimitLimit     = "X-RateLimit-Limit"
+	HeaderRateLimitRemaining = "X-RateLimit-Remaining"
+	// HeaderRateLimitReset is the seconds until the limit is fully available again
+	HeaderRateLimitReset = "X-RateLimit-Reset"
+)
+
+var (
+	ErrTooManyRequests = util.NewError(400429, "too many requests")
+)
+
+type (
+	// RateLimitConfig defines the config for RateLimit middleware.
+	RateLimitConfig struct {
+		// Skipper defines a function to skip middleware.
+		Skipper Skipper
+		Limiter ratelimit.Limiter
+		// Key of requests to limit, KeyByIP by default
+		Key func(echo.Context) string
+		// Logger logs the errors of the limiter, which allows requests, optional
+		Logger util.Logger
+	}
+)
+
+// KeyByIP keys requests by the real IP of the client
+func KeyByIP(c echo.Context) string {
+	return "ip:" + c.RealIP()
+}
+
+// KeyByPrincipal keys requests by the subject of the principal stored by JWT, or by IP without principal
+func KeyByPrincipal(c echo.Context) string {
+	if p, ok := c.Get(PrincipalKey).(*auth.Principal); ok {
+		return "sub:" + p.Subject
+	}
+	return KeyByIP(c)
+}
+
+// KeyByRoute keys requests by the method and the route, as "GET /users/:id"
+func KeyByRoute(c echo.Context) string {
+	return "route:" + c.Request().Method + " " + c.Path()
+}
+
+// RateLimit middleware limits requests by the IP of clients, with the X-RateLimit headers. Requests
+// over the limit are answered 429 with Retry-After.
+func RateLimit(limiter ratelimit.Limiter) echo.MiddlewareFunc {
+	return RateLimitWithConfig(RateLimitConfig{Limiter: limiter})
+}
+
+// RateLimitWithConfig returns a RateLimit middleware with config.
+func RateLimitWithConfig(config RateLimitConfig) echo.MiddlewareFunc {
+	if config.Skipper == nil {
+		config.Skipper = DefaultSkipper
+	}
+	if config.Key == nil {
+		config.Key = KeyByIP
+	}
+	if config.Limiter == nil {
+		panic("filter: RateLimit middleware requires a limiter")
+	}
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if config.Skipper(c) {
+				return next(c)
+			}
+
+			res, err := config.Limiter.Allow(config.Key(c))
+			if err != nil {
+				// requests are not blocked by a broken limiter
+				if config.Logger != nil {
+					config.Logger.Errorf("rate limit: %v", err)
+				}
+				return next(c)
+			}
+
+			header := c.Response().Header()
+			header.Set(HeaderRateLimitLimit, strconv.Itoa(res.Limit))
+			header.Set(HeaderRateLimitRemaining, strconv.Itoa(res.Remaining))
+			header.Set(HeaderRateLimitReset, seconds(res.ResetAfter))
+			if !res.Allowed {
+				header.Set("Retry-After", seconds(res.RetryAfter))
+				return c.JSON(http.StatusTooManyRequests, ErrTooManyRequests)
+			}
+			return next(c)
+		}
+	}
+}
+
+// seconds rounds d up to seconds
+func seconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
@@ -0,0 +1,35 @@
+package filter
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/silentred/toolkit/ratelimit"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRateLimit(t *testing.T) {
+	e := echo.New()
+	e.Use(RateLimitWithConfig(RateLimitConfig{Limiter: ratelimit.NewLocalSlidingWindow(ratelimit.PerMinute(2)), Key: KeyByRoute}))
+	e.GET("/hello", func(c echo.Context) error {
+		return c.NoContent(http.StatusOK)
+	})
+
+	get := func() *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/hello", nil))
+		return rec
+	}
+	rec := get()
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "2", rec.Header().Get(HeaderRateLimitLimit))
+	assert.Equal(t, "1", rec.Header().Get(HeaderRateLimitRemaining))
+	assert.Equal(t, http.StatusOK, get().Code)
+
+	rec = get()
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+	assert.Equal(t, "0", rec.Header().Get(HeaderRateLimitRemaining))
+	assert.NotEmpty(t, rec.Header().Get("Retry-After"))
+}
@@ -5,6 +5,8 @@ import (
 	"runtime"
 
 	"github.com/labstack/echo/v4"
+	"github.com/labstack/gommon/log"
+	"github.com/silentred/toolkit/util"
 )
 
 type (
@@ -76,7 +78,13 @@ func RecoverWithConfig(config RecoverConfig) echo.MiddlewareFunc {
 					stack := make([]byte, config.StackSize)
 					length := runtime.Stack(stack, !config.DisableStackAll)
 					if !config.DisablePrintStack {
-						c.Logger().Printf("[%s] %s %s\n", "PANIC RECOVER", err, stack[:length])
+						fields := log.JSON{
+							"message": "PANIC RECOVER",
+							"err":     err.Error(),
+							"stack":   string(stack[:length]),
+						}
+						util.AddRequestID(fields, c.Request().Context())
+						c.Logger().Printj(fields)
 					}
 					c.Error(err)
 				}
@@ -0,0 +1,36 @@
+package filter
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	elog "github.com/labstack/gommon/log"
+	"github.com/silentred/toolkit/util"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecoverRequestID(t *testing.T) {
+	var buf bytes.Buffer
+	e := echo.New()
+	logger := elog.New("test")
+	logger.SetOutput(&buf)
+	e.Logger = logger
+
+	// Recover is outermost, RequestID replaces the request inside it
+	e.Use(Recover(), RequestID())
+	e.GET("/", func(c echo.Context) error {
+		panic("broken")
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set(util.HeaderRequestID, "req-1")
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+	assert.Contains(t, buf.String(), `"request_id":"req-1"`)
+	assert.Contains(t, buf.String(), `"err":"broken"`)
+}
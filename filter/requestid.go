@@ -0,0 +1,23 @@
+package filter
+
+import (
+	"github.com/labstack/echo/v4"
+	"github.com/silentred/toolkit/util"
+)
+
+// RequestID middleware accepts the request ID and W3C trace-context of the caller, or generates them,
+// and stores them in the context of the request. The request ID is sent back in the X-Request-ID header.
+func RequestID() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			req := c.Request()
+			ctx := util.StartRequest(req.Context(), req.Header.Get(util.HeaderRequestID),
+				req.Header.Get(util.HeaderTraceparent), req.Header.Get(util.HeaderTracestate))
+			c.SetRequest(req.WithContext(ctx))
+
+			id := util.RequestIDFromContext(ctx)
+			c.Response().Header().Set(util.HeaderRequestID, id)
+			return next(c)
+		}
+	}
+}
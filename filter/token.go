@@ -1,11 +1,14 @@
 package filter
 
 import (
-	"crypto/md5"
-	"encoding/base64"
-	"fmt"
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"time"
 
 	"github.com/labstack/echo/v4"
+	"github.com/silentred/toolkit/auth"
 	"github.com/silentred/toolkit/util"
 )
 
@@ -16,37 +19,73 @@ var (
 type (
 	// TokenConfig defines the config for Auth middleware.
 	TokenConfig struct {
-		Logger util.Logger
+		// Skipper defines a function to skip middleware.
+		Skipper Skipper
+		Logger  util.Logger
+		// Secret of the HMAC-SHA256 signatures of requests, signed by auth.HMACSigner
 		Secret string
+		// MaxSkew of the timestamp of requests from now, auth.DefaultMaxSkew by default
+		MaxSkew time.Duration
+		// Nonces remembers nonces to block replays, in memory by default. Use auth.RedisNonceStore
+		// to share nonces between instances.
+		Nonces auth.NonceStore
 	}
 )
 
-// AuthToken middleware
+// AuthToken middleware verifies the signature of requests, signed by secret as auth.HMACSigner does,
+// and rejects requests with old timestamps or replayed nonces
 func AuthToken(logger util.Logger, secret string) echo.MiddlewareFunc {
 	config := TokenConfig{
 		Logger: logger,
 		Secret: secret,
 	}
-	return newTokenFilter(config)
+	return AuthTokenWithConfig(config)
 }
 
-func newTokenFilter(config TokenConfig) echo.MiddlewareFunc {
+// AuthTokenWithConfig returns an AuthToken middleware with config. The body of requests is read
+// into memory to be verified, so it should be limited by the BodyLimit middleware of echo.
+func AuthTokenWithConfig(config TokenConfig) echo.MiddlewareFunc {
+	if config.Skipper == nil {
+		config.Skipper = DefaultSkipper
+	}
+	if len(config.Secret) == 0 {
+		panic("filter: AuthToken middleware requires a secret")
+	}
+	if config.Nonces == nil {
+		config.Nonces = auth.NewMemoryNonceStore()
+	}
+	verifier := &auth.HMACVerifier{
+		Secret:  []byte(config.Secret),
+		MaxSkew: config.MaxSkew,
+		Nonces:  config.Nonces,
+	}
+
 	return func(next echo.HandlerFunc) echo.HandlerFunc {
 		return func(c echo.Context) (err error) {
-			// verify the token
-			var token = c.QueryParam("token")
-			var nonce = c.QueryParam("nonce")
-			var method = c.Request().Method
-			var ts = c.QueryParam("ts")
-			var hashStr = fmt.Sprintf("%s,%s,%s", method, nonce, ts)
-
-			bytes := md5.Sum(util.Slice(hashStr))
-			md5Str := fmt.Sprintf("%x", util.String(bytes[:]))
-			rightSign := base64.StdEncoding.EncodeToString(util.Slice(md5Str))
-
-			if rightSign != token {
-				config.Logger.Errorf("str:%s ; token:%s ; rightSign:%s", hashStr, token, rightSign)
-				return c.JSON(200, ErrToken)
+			if config.Skipper(c) {
+				return next(c)
+			}
+
+			req := c.Request()
+			var body []byte
+			if req.Body != nil {
+				if body, err = ioutil.ReadAll(req.Body); err != nil {
+					return err
+				}
+				req.Body.Close()
+				req.Body = ioutil.NopCloser(bytes.NewReader(body))
+			}
+
+			if err = verifier.Verify(req, body); err != nil {
+				if config.Logger != nil {
+					config.Logger.Infof("reject signature of %s %s: %v", req.Method, req.URL.Path, err)
+				}
+				if errors.Is(err, auth.ErrNoCredentials) || errors.Is(err, auth.ErrInvalidSignature) ||
+					errors.Is(err, auth.ErrClockSkew) || errors.Is(err, auth.ErrReplay) {
+					return c.JSON(http.StatusUnauthorized, ErrToken)
+				}
+				// the nonce store fails
+				return err
 			}
 
 			if err = next(c); err != nil {
@@ -0,0 +1,53 @@
+package filter
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	elog "github.com/labstack/gommon/log"
+	"github.com/silentred/toolkit/auth"
+	cfg "github.com/silentred/toolkit/config"
+	"github.com/silentred/toolkit/util"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAuthToken(t *testing.T) {
+	logger := util.NewLogger("test", elog.DEBUG, cfg.LogConfig{Providor: cfg.ProvidorStdOut})
+	logger.SetOutput(ioutil.Discard)
+
+	e := echo.New()
+	e.Use(AuthToken(logger, "secret"))
+	e.POST("/echo", func(c echo.Context) error {
+		body, _ := ioutil.ReadAll(c.Request().Body)
+		return c.Blob(http.StatusOK, echo.MIMEApplicationJSON, body)
+	})
+
+	post := func(signer util.RequestSigner) *http.Request {
+		req := httptest.NewRequest(http.MethodPost, "/echo?q=1", bytes.NewBufferString(`{"a":1}`))
+		if signer != nil {
+			assert.NoError(t, signer.Sign(req))
+		}
+		return req
+	}
+	serve := func(req *http.Request) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	req := post(auth.HMACSigner{Secret: []byte("secret")})
+	replay := req.Clone(req.Context())
+	rec := serve(req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, `{"a":1}`, rec.Body.String())
+
+	// unsigned, wrongly signed and replayed requests are rejected
+	assert.Equal(t, http.StatusUnauthorized, serve(post(nil)).Code)
+	assert.Equal(t, http.StatusUnauthorized, serve(post(auth.HMACSigner{Secret: []byte("other")})).Code)
+	replay.Body = ioutil.NopCloser(bytes.NewBufferString(`{"a":1}`))
+	assert.Equal(t, http.StatusUnauthorized, serve(replay).Code)
+}
@@ -0,0 +1,32 @@
+package filter
+
+import (
+	"github.com/labstack/echo/v4"
+	"github.com/silentred/toolkit/util"
+	semconv "go.opentelemetry.io/otel/semconv/v1.4.0"
+)
+
+// Tracing middleware starts a server span for every request, as a child of the caller in the
+// traceparent header. It should be used before RequestID, which keeps the trace of the span.
+func Tracing() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) (err error) {
+			req := c.Request()
+			route := c.Path()
+			ctx, span := util.StartServerSpan(req.Context(), "HTTP "+req.Method+" "+route,
+				req.Header.Get(util.HeaderTraceparent), req.Header.Get(util.HeaderTracestate),
+				semconv.HTTPServerAttributesFromHTTPRequest("", route, req)...)
+			c.SetRequest(req.WithContext(ctx))
+
+			if err = next(c); err != nil {
+				c.Error(err)
+			}
+
+			status := c.Response().Status
+			span.SetAttributes(semconv.HTTPAttributesFromHTTPStatusCode(status)...)
+			span.SetStatus(semconv.SpanStatusFromHTTPStatusCode(status))
+			util.EndSpan(span, err)
+			return nil
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package filter
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/silentred/toolkit/util"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestTracing(t *testing.T) {
+	spans := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(spans))
+	defer provider.Shutdown(context.Background())
+	otel.SetTracerProvider(provider)
+	defer otel.SetTracerProvider(trace.NewNoopTracerProvider())
+
+	e := echo.New()
+	e.Use(Tracing(), RequestID())
+	e.GET("/hello", func(c echo.Context) error {
+		return c.String(http.StatusOK, util.RequestIDFromContext(c.Request().Context()))
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/hello", nil)
+	req.Header.Set(util.HeaderTraceparent, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	// the server span is a child of the caller, and the request ID is its trace ID
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", rec.Body.String())
+	if got := spans.GetSpans(); assert.Len(t, got, 1) {
+		assert.Equal(t, "HTTP GET /hello", got[0].Name)
+		assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", got[0].SpanContext.TraceID().String())
+		assert.Equal(t, "00f067aa0ba902b7", got[0].Parent.SpanID().String())
+	}
+}
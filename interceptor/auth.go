@@ -0,0 +1,153 @@
+package interceptor
+
+import (
+	"strings"
+
+	"github.com/silentred/toolkit/auth"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+var mdAuthorization = strings.ToLower(auth.HeaderAuthorization)
+
+// MethodAuth is the authentication required by a method
+type MethodAuth struct {
+	// Auth is auth.None, auth.Token, auth.MTLS or auth.Any. An empty Auth is auth.Token,
+	// so methods are never left open by omission.
+	Auth string
+	// Scopes all required of the principal
+	Scopes []string
+}
+
+// AuthPolicy declares the authentication of methods
+type AuthPolicy struct {
+	// Default applies to methods not in Methods
+	Default MethodAuth
+	// Methods by full method name as "/pkg.Service/Method", or by service as "/pkg.Service/*"
+	Methods map[string]MethodAuth
+}
+
+// Lookup returns the MethodAuth of the full method name
+func (p AuthPolicy) Lookup(method string) MethodAuth {
+	if a, ok := p.Methods[method]; ok {
+		return a
+	}
+	if i := strings.LastIndex(method, "/"); i > 0 {
+		if a, ok := p.Methods[method[:i+1]+"*"]; ok {
+			return a
+		}
+	}
+	return p.Default
+}
+
+// Authenticator authenticates calls by bearer tokens in the authorization metadata, verified by
+// Verifier, or by the verified client certificate of mTLS. The principal is stored in the context.
+type Authenticator struct {
+	Verifier auth.Verifier
+	Policy   AuthPolicy
+}
+
+// NewAuthenticator returns an Authenticator
+func NewAuthenticator(verifier auth.Verifier, policy AuthPolicy) *Authenticator {
+	return &Authenticator{Verifier: verifier, Policy: policy}
+}
+
+// Authenticate returns a copy of ctx carrying the principal of the call of method. The error is
+// Unauthenticated without valid credentials, and PermissionDenied without the required scopes.
+func (a *Authenticator) Authenticate(ctx context.Context, method string) (context.Context, error) {
+	required := a.Policy.Lookup(method)
+
+	var (
+		p   *auth.Principal
+		err error
+	)
+	switch required.Auth {
+	case auth.None:
+		// the principal is still stored if there is one
+		if p, err = a.tokenPrincipal(ctx); err != nil || p == nil {
+			p = peerPrincipal(ctx)
+		}
+		if p == nil {
+			return ctx, nil
+		}
+		return auth.WithPrincipal(ctx, p), nil
+	case "", auth.Token:
+		p, err = a.tokenPrincipal(ctx)
+	case auth.MTLS:
+		p = peerPrincipal(ctx)
+	case auth.Any:
+		if p = peerPrincipal(ctx); p == nil {
+			p, err = a.tokenPrincipal(ctx)
+		}
+	default:
+		return ctx, status.Errorf(codes.Internal, "unknown auth %q of %s", required.Auth, method)
+	}
+
+	if err != nil {
+		return ctx, status.Error(codes.Unauthenticated, err.Error())
+	}
+	if p == nil {
+		return ctx, status.Error(codes.Unauthenticated, auth.ErrNoCredentials.Error())
+	}
+	if !p.HasScopes(required.Scopes...) {
+		return ctx, status.Errorf(codes.PermissionDenied, "%s requires scopes %v", method, required.Scopes)
+	}
+	return auth.WithPrincipal(ctx, p), nil
+}
+
+// UnaryServerInterceptor authenticates unary calls
+func (a *Authenticator) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		ctx, err := a.Authenticate(ctx, info.FullMethod)
+		if err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptor authenticates streams
+func (a *Authenticator) StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, err := a.Authenticate(ss.Context(), info.FullMethod)
+		if err != nil {
+			return err
+		}
+		return handler(srv, &contextStream{ServerStream: ss, ctx: ctx})
+	}
+}
+
+// tokenPrincipal returns the principal of the bearer token, or nil if there is no token
+func (a *Authenticator) tokenPrincipal(ctx context.Context) (*auth.Principal, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	value := firstValue(md, mdAuthorization)
+	if len(value) == 0 {
+		return nil, nil
+	}
+	token, ok := auth.BearerToken(value)
+	if !ok {
+		return nil, auth.ErrInvalidToken
+	}
+	if a.Verifier == nil {
+		return nil, auth.ErrNoCredentials
+	}
+	return a.Verifier.Verify(token)
+}
+
+// peerPrincipal returns the principal of the verified client certificate, or nil
+func peerPrincipal(ctx context.Context) *auth.Principal {
+	pr, ok := peer.FromContext(ctx)
+	if !ok {
+		return nil
+	}
+	info, ok := pr.AuthInfo.(credentials.TLSInfo)
+	if !ok || len(info.State.VerifiedChains) == 0 || len(info.State.VerifiedChains[0]) == 0 {
+		return nil
+	}
+	return auth.CertificatePrincipal(info.State.VerifiedChains[0][0])
+}
@@ -0,0 +1,133 @@
+package interceptor
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/silentred/toolkit/auth"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+func TestAuthPolicy(t *testing.T) {
+	policy := AuthPolicy{
+		Default: MethodAuth{Auth: auth.Token},
+		Methods: map[string]MethodAuth{
+			"/pkg.Svc/*":      {Auth: auth.MTLS},
+			"/pkg.Svc/Health": {Auth: auth.None},
+		},
+	}
+	assert.Equal(t, auth.None, policy.Lookup("/pkg.Svc/Health").Auth)
+	assert.Equal(t, auth.MTLS, policy.Lookup("/pkg.Svc/Get").Auth)
+	assert.Equal(t, auth.Token, policy.Lookup("/pkg.Other/Get").Auth)
+}
+
+func TestAuthenticator(t *testing.T) {
+	secret := []byte("secret")
+	a := NewAuthenticator(&auth.JWTVerifier{Secret: secret}, AuthPolicy{
+		Default: MethodAuth{Auth: auth.Token, Scopes: []string{"read"}},
+		Methods: map[string]MethodAuth{
+			"/pkg.Svc/Health": {Auth: auth.None},
+			"/pkg.Svc/Admin":  {Auth: auth.MTLS},
+			"/pkg.Svc/Any":    {Auth: auth.Any},
+		},
+	})
+
+	bearer := func(scopes ...string) context.Context {
+		md, _ := auth.NewHMACCredentials(secret, "alice", scopes...).GetRequestMetadata(context.Background())
+		return metadata.NewIncomingContext(context.Background(), metadata.New(md))
+	}
+	call := func(ctx context.Context, method string) (*auth.Principal, codes.Code) {
+		var p *auth.Principal
+		_, err := a.UnaryServerInterceptor()(ctx, nil, &grpc.UnaryServerInfo{FullMethod: method}, func(c context.Context, req interface{}) (interface{}, error) {
+			p, _ = auth.PrincipalFromContext(c)
+			return nil, nil
+		})
+		return p, status.Code(err)
+	}
+
+	p, code := call(bearer("read"), "/pkg.Svc/Get")
+	assert.Equal(t, codes.OK, code)
+	if assert.NotNil(t, p) {
+		assert.Equal(t, "alice", p.Subject)
+		assert.Equal(t, auth.Token, p.Method)
+	}
+	_, code = call(bearer(), "/pkg.Svc/Get")
+	assert.Equal(t, codes.PermissionDenied, code)
+	_, code = call(context.Background(), "/pkg.Svc/Get")
+	assert.Equal(t, codes.Unauthenticated, code)
+	bad := metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", "Bearer x.y.z"))
+	_, code = call(bad, "/pkg.Svc/Get")
+	assert.Equal(t, codes.Unauthenticated, code)
+
+	p, code = call(context.Background(), "/pkg.Svc/Health")
+	assert.Equal(t, codes.OK, code)
+	assert.Nil(t, p)
+
+	// tokens are not accepted for mtls methods
+	_, code = call(bearer("read"), "/pkg.Svc/Admin")
+	assert.Equal(t, codes.Unauthenticated, code)
+
+	mtls := peerContext(t, "spiffe://example.org/ns/default/sa/worker")
+	p, code = call(mtls, "/pkg.Svc/Admin")
+	assert.Equal(t, codes.OK, code)
+	if assert.NotNil(t, p) {
+		assert.Equal(t, "spiffe://example.org/ns/default/sa/worker", p.Subject)
+		assert.Equal(t, auth.MTLS, p.Method)
+	}
+	p, code = call(mtls, "/pkg.Svc/Any")
+	assert.Equal(t, codes.OK, code)
+	assert.NotNil(t, p)
+
+	// streams carry the principal in the context of the stream
+	err := a.StreamServerInterceptor()(nil, &fakeServerStream{ctx: bearer("read")}, &grpc.StreamServerInfo{FullMethod: "/pkg.Svc/Watch"}, func(srv interface{}, ss grpc.ServerStream) error {
+		p, _ = auth.PrincipalFromContext(ss.Context())
+		return nil
+	})
+	assert.NoError(t, err)
+	if assert.NotNil(t, p) {
+		assert.Equal(t, "alice", p.Subject)
+	}
+}
+
+func TestAuthenticatorEmptyPolicy(t *testing.T) {
+	// methods require tokens unless the auth is declared
+	a := NewAuthenticator(&auth.JWTVerifier{Secret: []byte("secret")}, AuthPolicy{})
+	_, err := a.Authenticate(context.Background(), "/pkg.Svc/Get")
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+}
+
+// peerContext returns a context of a peer verified by a self-signed certificate of uri
+func peerContext(t *testing.T, uri string) context.Context {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	u, _ := url.Parse(uri)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "worker"},
+		URIs:         []*url.URL{u},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	assert.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	assert.NoError(t, err)
+
+	info := credentials.TLSInfo{State: tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}}
+	return peer.NewContext(context.Background(), &peer.Peer{AuthInfo: info})
+}
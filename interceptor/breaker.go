@@ -0,0 +1,75 @@
+package interceptor
+
+import (
+	"github.com/silentred/toolkit/breaker"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// NewClientBreakerInterceptor returns an interceptor failing calls fast with Unavailable while the
+// circuit of the target in breakers is open. Calls failing with Unavailable, DeadlineExceeded,
+// Internal or Unknown are failures of the target.
+func NewClientBreakerInterceptor(breakers *breaker.Group) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		done, err := allowTarget(breakers, cc)
+		if err != nil {
+			return err
+		}
+		err = invoker(ctx, method, req, reply, cc, opts...)
+		done(!isTargetFailure(err))
+		return err
+	}
+}
+
+// NewStreamClientBreakerInterceptor returns the stream version of NewClientBreakerInterceptor,
+// which counts the failures of starting streams
+func NewStreamClientBreakerInterceptor(breakers *breaker.Group) grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		done, err := allowTarget(breakers, cc)
+		if err != nil {
+			return nil, err
+		}
+		stream, err := streamer(ctx, desc, cc, method, opts...)
+		done(!isTargetFailure(err))
+		return stream, err
+	}
+}
+
+func allowTarget(breakers *breaker.Group, cc *grpc.ClientConn) (func(bool), error) {
+	t := target(cc)
+	done, err := breakers.Get(t).Allow()
+	if err != nil {
+		return nil, &breakerError{status: status.Newf(codes.Unavailable, "%s: %v", t, err), err: err}
+	}
+	return done, nil
+}
+
+// breakerError is the Unavailable status of calls refused by a breaker. It unwraps to the error
+// of the breaker, as breaker.ErrOpen, so that retries stop.
+type breakerError struct {
+	status *status.Status
+	err    error
+}
+
+func (e *breakerError) Error() string {
+	return e.status.Err().Error()
+}
+
+// GRPCStatus returns the status of the error
+func (e *breakerError) GRPCStatus() *status.Status {
+	return e.status
+}
+
+func (e *breakerError) Unwrap() error {
+	return e.err
+}
+
+func isTargetFailure(err error) bool {
+	switch status.Code(err) {
+	case codes.Unavailable, codes.DeadlineExceeded, codes.Internal, codes.Unknown:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,61 @@
+package interceptor
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/silentred/toolkit/breaker"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestClientBreakerInterceptor(t *testing.T) {
+	breakers := breaker.NewGroup(breaker.Settings{MinRequests: 2})
+	interceptor := NewClientBreakerInterceptor(breakers)
+
+	var calls int
+	invoke := func(code codes.Code) error {
+		return interceptor(context.Background(), "/pkg.Svc/Get", nil, nil, nil, func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+			calls++
+			return status.Error(code, "")
+		})
+	}
+
+	// errors of callers are not failures of the target
+	assert.Equal(t, codes.NotFound, status.Code(invoke(codes.NotFound)))
+	assert.Equal(t, codes.InvalidArgument, status.Code(invoke(codes.InvalidArgument)))
+	assert.Equal(t, breaker.Closed, breakers.Get("").State())
+
+	invoke(codes.Unavailable)
+	invoke(codes.Unavailable)
+	invoke(codes.DeadlineExceeded)
+	assert.Equal(t, breaker.Open, breakers.Get("").State())
+
+	// calls fail fast without reaching the target
+	calls = 0
+	assert.Equal(t, codes.Unavailable, status.Code(invoke(codes.OK)))
+	assert.Equal(t, 0, calls)
+}
+
+func TestRetryThroughBreaker(t *testing.T) {
+	// the breaker inside retries counts every attempt, and retries stop when the circuit opens
+	breakers := breaker.NewGroup(breaker.Settings{MinRequests: 2})
+	chain := UnaryClientInterceptorChain(
+		NewClientRetryPolicy(RetryPolicy{Max: 5, Backoff: time.Millisecond, Idempotent: IdempotentMethods("/pkg.Svc/*")}),
+		NewClientBreakerInterceptor(breakers),
+	)
+
+	var calls int
+	err := chain(context.Background(), "/pkg.Svc/Get", nil, nil, nil, func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		calls++
+		return status.Error(codes.Unavailable, "")
+	})
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+	assert.True(t, errors.Is(err, breaker.ErrOpen))
+	assert.Equal(t, 2, calls)
+	assert.Equal(t, breaker.Open, breakers.Get("").State())
+}
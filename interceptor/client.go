@@ -0,0 +1,334 @@
+package interceptor
+
+import (
+	"errors"
+	"io"
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/labstack/gommon/log"
+	"github.com/silentred/toolkit/breaker"
+	"github.com/silentred/toolkit/util"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// UnaryClientInterceptorChain build the multi client interceptors into one interceptor chain,
+// to be used by grpc.WithUnaryInterceptor. The first interceptor is the outermost.
+func UnaryClientInterceptorChain(interceptors ...grpc.UnaryClientInterceptor) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		chain := invoker
+		for i := len(interceptors) - 1; i >= 0; i-- {
+			chain = buildInvoker(interceptors[i], chain)
+		}
+		return chain(ctx, method, req, reply, cc, opts...)
+	}
+}
+
+func buildInvoker(c grpc.UnaryClientInterceptor, n grpc.UnaryInvoker) grpc.UnaryInvoker {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		return c(ctx, method, req, reply, cc, n, opts...)
+	}
+}
+
+// StreamClientInterceptorChain build the multi client stream interceptors into one interceptor chain,
+// to be used by grpc.WithStreamInterceptor. The first interceptor is the outermost.
+func StreamClientInterceptorChain(interceptors ...grpc.StreamClientInterceptor) grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		chain := streamer
+		for i := len(interceptors) - 1; i >= 0; i-- {
+			chain = buildStreamer(interceptors[i], chain)
+		}
+		return chain(ctx, desc, cc, method, opts...)
+	}
+}
+
+func buildStreamer(c grpc.StreamClientInterceptor, n grpc.Streamer) grpc.Streamer {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		return c(ctx, desc, cc, method, n, opts...)
+	}
+}
+
+// NewClientLogInterceptor returns a log interceptor for gRPC clients
+func NewClientLogInterceptor(logger util.Logger) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		start := time.Now()
+		err := invoker(ctx, method, req, reply, cc, opts...)
+		stop := time.Now()
+
+		json := log.JSON{
+			"time_unix":   strconv.FormatInt(time.Now().Unix(), 10),
+			"target":      cc.Target(),
+			"method":      method,
+			"latency":     strconv.FormatInt(int64(stop.Sub(start)), 10),
+			"latency_str": stop.Sub(start).String(),
+			"req":         marshal(req),
+			"resp":        marshal(reply),
+			"code":        status.Code(err).String(),
+			"err":         err,
+		}
+		util.AddRequestID(json, ctx)
+
+		logger.Infoj(json)
+
+		return err
+	}
+}
+
+// NewStreamClientLogInterceptor returns a log stream interceptor for gRPC clients, which logs
+// a summary of every stream when it ends: when receiving from it ends, after the only response of
+// streams without ServerStreams, or when ctx is done
+func NewStreamClientLogInterceptor(logger util.Logger) grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		start := time.Now()
+		cs := &countingClientStream{desc: desc}
+		cs.finish = func(err error) {
+			stop := time.Now()
+			json := log.JSON{
+				"time_unix":     strconv.FormatInt(time.Now().Unix(), 10),
+				"target":        cc.Target(),
+				"method":        method,
+				"client_stream": desc.ClientStreams,
+				"server_stream": desc.ServerStreams,
+				"latency":       strconv.FormatInt(int64(stop.Sub(start)), 10),
+				"latency_str":   stop.Sub(start).String(),
+				"recv_msgs":     atomic.LoadInt64(&cs.recvMsgs),
+				"recv_bytes":    atomic.LoadInt64(&cs.recvBytes),
+				"sent_msgs":     atomic.LoadInt64(&cs.sentMsgs),
+				"sent_bytes":    atomic.LoadInt64(&cs.sentBytes),
+				"code":          status.Code(err).String(),
+				"err":           err,
+			}
+			util.AddRequestID(json, ctx)
+			logger.Infoj(json)
+		}
+
+		stream, err := streamer(ctx, desc, cc, method, opts...)
+		if err != nil {
+			cs.end(err)
+			return nil, err
+		}
+		cs.ClientStream = stream
+		watchClientStream(ctx, stream, cs.end)
+		return cs, nil
+	}
+}
+
+// watchClientStream calls end with the error of ctx, if ctx is done before stream finishes.
+// Callers may stop a stream by canceling it instead of receiving until the end.
+func watchClientStream(ctx context.Context, stream grpc.ClientStream, end func(error)) {
+	if ctx.Done() == nil {
+		return
+	}
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-stream.Context().Done():
+			// the stream of ctx is done with ctx as well
+			if ctx.Err() == nil {
+				return
+			}
+		}
+		end(status.FromContextError(ctx.Err()).Err())
+	}()
+}
+
+// countingClientStream counts the messages received and sent successfully, and calls finish once
+// when receiving ends. Streams without ServerStreams end with their only response, as grpc finishes
+// them then and callers do not receive again.
+type countingClientStream struct {
+	grpc.ClientStream
+	desc                *grpc.StreamDesc
+	recvMsgs, recvBytes int64
+	sentMsgs, sentBytes int64
+
+	once   sync.Once
+	finish func(error)
+}
+
+func (s *countingClientStream) RecvMsg(m interface{}) error {
+	err := s.ClientStream.RecvMsg(m)
+	if err == nil {
+		atomic.AddInt64(&s.recvMsgs, 1)
+		atomic.AddInt64(&s.recvBytes, int64(messageSize(m)))
+		if !s.desc.ServerStreams {
+			s.end(nil)
+		}
+		return nil
+	}
+	if err == io.EOF {
+		s.end(nil)
+	} else {
+		s.end(err)
+	}
+	return err
+}
+
+func (s *countingClientStream) SendMsg(m interface{}) error {
+	err := s.ClientStream.SendMsg(m)
+	if err == nil {
+		atomic.AddInt64(&s.sentMsgs, 1)
+		atomic.AddInt64(&s.sentBytes, int64(messageSize(m)))
+	}
+	return err
+}
+
+func (s *countingClientStream) end(err error) {
+	s.once.Do(func() { s.finish(err) })
+}
+
+// Timeouts of the calls without deadline
+type Timeouts struct {
+	// Default applies to the methods not in Methods
+	Default time.Duration
+	// Methods by full method name as "/pkg.Service/Method", matched case-insensitively
+	Methods map[string]time.Duration
+}
+
+// NewClientTimeout returns an interceptor which sets the deadline of calls without one.
+// Deadlines are propagated to the server by gRPC.
+func NewClientTimeout(timeout time.Duration) grpc.UnaryClientInterceptor {
+	return NewClientTimeouts(Timeouts{Default: timeout})
+}
+
+// NewClientTimeouts returns an interceptor which sets the deadline of calls without one by method
+func NewClientTimeouts(timeouts Timeouts) grpc.UnaryClientInterceptor {
+	methods := make(map[string]time.Duration, len(timeouts.Methods))
+	for method, timeout := range timeouts.Methods {
+		methods[strings.ToLower(method)] = timeout
+	}
+
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		timeout, ok := methods[strings.ToLower(method)]
+		if !ok {
+			timeout = timeouts.Default
+		}
+		if _, ok := ctx.Deadline(); !ok && timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, timeout)
+			defer cancel()
+		}
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+}
+
+var (
+	// DefaultRetryCodes are retried if RetryPolicy has no Codes
+	DefaultRetryCodes = []codes.Code{codes.Unavailable}
+	// DefaultRetryBackoff is the first backoff if RetryPolicy has no Backoff
+	DefaultRetryBackoff = 100 * time.Millisecond
+	// DefaultMaxRetryBackoff is the limit of backoff if RetryPolicy has no MaxBackoff
+	DefaultMaxRetryBackoff = 5 * time.Second
+)
+
+// RetryPolicy of client calls. The backoff before the nth retry is Backoff * 2^(n-1), limited by
+// MaxBackoff, and randomized by ±Jitter of itself.
+type RetryPolicy struct {
+	// Max number of retries after the first attempt
+	Max   int
+	Codes []codes.Code
+	// Idempotent tells if method is safe to be retried, no method is if it is nil
+	Idempotent func(method string) bool
+
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	// Jitter is a fraction in [0, 1]
+	Jitter float64
+}
+
+// IdempotentMethods returns a RetryPolicy.Idempotent matching full method names, or every method
+// of a service with "/pkg.Service/*"
+func IdempotentMethods(methods ...string) func(string) bool {
+	return func(method string) bool {
+		for _, m := range methods {
+			if m == method || (strings.HasSuffix(m, "/*") && strings.HasPrefix(method, m[:len(m)-1])) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// backoff returns the backoff before retry n, starting from 1
+func (p RetryPolicy) backoff(n int) time.Duration {
+	backoff, max := p.Backoff, p.MaxBackoff
+	if backoff <= 0 {
+		backoff = DefaultRetryBackoff
+	}
+	if max <= 0 {
+		max = DefaultMaxRetryBackoff
+	}
+	for i := 1; i < n && backoff < max; i++ {
+		backoff *= 2
+	}
+	if backoff > max {
+		backoff = max
+	}
+	if p.Jitter > 0 {
+		backoff += time.Duration(p.Jitter * (rand.Float64()*2 - 1) * float64(backoff))
+	}
+	return backoff
+}
+
+func (p RetryPolicy) retryable(err error) bool {
+	// calls refused by an open circuit are not retried
+	if errors.Is(err, breaker.ErrOpen) || errors.Is(err, breaker.ErrTooManyProbes) {
+		return false
+	}
+	retryCodes := p.Codes
+	if len(retryCodes) == 0 {
+		retryCodes = DefaultRetryCodes
+	}
+	code := status.Code(err)
+	for _, c := range retryCodes {
+		if c == code {
+			return true
+		}
+	}
+	return false
+}
+
+// NewClientRetry returns an interceptor which retries calls of the idempotent methods failing with
+// DefaultRetryCodes, at most retries times. methods are as in IdempotentMethods.
+func NewClientRetry(retries int, methods ...string) grpc.UnaryClientInterceptor {
+	return NewClientRetryPolicy(RetryPolicy{Max: retries, Idempotent: IdempotentMethods(methods...)})
+}
+
+// NewClientRetryPolicy returns an interceptor which retries idempotent calls by policy, until the context is done
+func NewClientRetryPolicy(policy RetryPolicy) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		err := invoker(ctx, method, req, reply, cc, opts...)
+		if policy.Idempotent == nil || !policy.Idempotent(method) {
+			return err
+		}
+
+		for n := 1; n <= policy.Max && err != nil && policy.retryable(err); n++ {
+			timer := time.NewTimer(policy.backoff(n))
+			select {
+			case <-timer.C:
+			case <-ctx.Done():
+				timer.Stop()
+				return err
+			}
+			err = invoker(ctx, method, req, reply, cc, opts...)
+		}
+		return err
+	}
+}
+
+// ParseCode returns the code of name, as "Unavailable" or "UNAVAILABLE" or "unavailable"
+func ParseCode(name string) (codes.Code, bool) {
+	name = strings.Replace(name, "_", "", -1)
+	for c := codes.OK; c <= codes.Unauthenticated; c++ {
+		if strings.EqualFold(c.String(), name) {
+			return c, true
+		}
+	}
+	return codes.Unknown, false
+}
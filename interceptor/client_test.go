@@ -0,0 +1,295 @@
+package interceptor
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"testing"
+	"time"
+
+	elog "github.com/labstack/gommon/log"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+)
+
+func TestUnaryClientInterceptorChain(t *testing.T) {
+	var calls []string
+	record := func(name string) grpc.UnaryClientInterceptor {
+		return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+			calls = append(calls, name)
+			return invoker(ctx, method, req, reply, cc, opts...)
+		}
+	}
+
+	chain := UnaryClientInterceptorChain(record("first"), record("second"))
+	err := chain(context.Background(), "/test/Call", nil, nil, nil, func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		calls = append(calls, "invoker")
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"first", "second", "invoker"}, calls)
+}
+
+func TestClientTimeouts(t *testing.T) {
+	timeouts := NewClientTimeouts(Timeouts{
+		Default: time.Second,
+		Methods: map[string]time.Duration{"/test/slow": time.Minute},
+	})
+
+	remaining := func(ctx context.Context, method string) time.Duration {
+		var left time.Duration
+		timeouts(ctx, method, nil, nil, nil, func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+			deadline, ok := ctx.Deadline()
+			assert.True(t, ok)
+			left = time.Until(deadline)
+			return nil
+		})
+		return left
+	}
+
+	assert.InDelta(t, float64(time.Second), float64(remaining(context.Background(), "/test/Fast")), float64(100*time.Millisecond))
+	assert.InDelta(t, float64(time.Minute), float64(remaining(context.Background(), "/test/Slow")), float64(100*time.Millisecond))
+
+	// the deadline of caller is kept
+	ctx, cancel := context.WithTimeout(context.Background(), time.Hour)
+	defer cancel()
+	assert.InDelta(t, float64(time.Hour), float64(remaining(ctx, "/test/Fast")), float64(100*time.Millisecond))
+}
+
+func TestClientRetryPolicy(t *testing.T) {
+	attempts := 0
+	failing := func(code codes.Code) grpc.UnaryInvoker {
+		return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+			attempts++
+			return status.Error(code, "failed")
+		}
+	}
+
+	retry := NewClientRetryPolicy(RetryPolicy{
+		Max:        3,
+		Codes:      []codes.Code{codes.Unavailable, codes.ResourceExhausted},
+		Idempotent: IdempotentMethods("/test.Service/Get", "/test.Reader/*"),
+		Backoff:    time.Millisecond,
+		Jitter:     0.5,
+	})
+	ctx := context.Background()
+
+	for _, method := range []string{"/test.Service/Get", "/test.Reader/List"} {
+		attempts = 0
+		err := retry(ctx, method, nil, nil, nil, failing(codes.ResourceExhausted))
+		assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+		assert.Equal(t, 4, attempts, method)
+	}
+
+	// not idempotent
+	attempts = 0
+	retry(ctx, "/test.Service/Create", nil, nil, nil, failing(codes.Unavailable))
+	assert.Equal(t, 1, attempts)
+
+	// no method is retried without Idempotent
+	attempts = 0
+	NewClientRetry(3)(ctx, "/test.Service/Get", nil, nil, nil, failing(codes.Unavailable))
+	assert.Equal(t, 1, attempts)
+
+	// not retryable code
+	attempts = 0
+	retry(ctx, "/test.Service/Get", nil, nil, nil, failing(codes.InvalidArgument))
+	assert.Equal(t, 1, attempts)
+
+	// recovered
+	attempts = 0
+	err := retry(ctx, "/test.Service/Get", nil, nil, nil, func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		if attempts++; attempts < 2 {
+			return status.Error(codes.Unavailable, "failed")
+		}
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, attempts)
+
+	// the context is done while backing off
+	attempts = 0
+	slow := NewClientRetryPolicy(RetryPolicy{Max: 3, Backoff: time.Hour, Idempotent: IdempotentMethods("/test.Service/*")})
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	slow(ctx, "/test.Service/Get", nil, nil, nil, failing(codes.Unavailable))
+	assert.Equal(t, 1, attempts)
+}
+
+func TestRetryBackoff(t *testing.T) {
+	p := RetryPolicy{Backoff: 100 * time.Millisecond, MaxBackoff: time.Second}
+	assert.Equal(t, 100*time.Millisecond, p.backoff(1))
+	assert.Equal(t, 400*time.Millisecond, p.backoff(3))
+	assert.Equal(t, time.Second, p.backoff(10))
+
+	p.Jitter = 0.2
+	for i := 0; i < 100; i++ {
+		b := p.backoff(2)
+		assert.True(t, b >= 160*time.Millisecond && b <= 240*time.Millisecond, b)
+	}
+}
+
+func TestParseCode(t *testing.T) {
+	for _, name := range []string{"Unavailable", "UNAVAILABLE", "unavailable"} {
+		code, ok := ParseCode(name)
+		assert.True(t, ok)
+		assert.Equal(t, codes.Unavailable, code)
+	}
+	code, ok := ParseCode("DEADLINE_EXCEEDED")
+	assert.True(t, ok)
+	assert.Equal(t, codes.DeadlineExceeded, code)
+
+	_, ok = ParseCode("Broken")
+	assert.False(t, ok)
+}
+
+type fakeClientStream struct {
+	grpc.ClientStream
+	recv int
+	// err ends the stream, io.EOF if it is nil
+	err error
+	// ctx is the context of the stream, context.Background() if it is nil
+	ctx context.Context
+}
+
+func (s *fakeClientStream) Context() context.Context {
+	if s.ctx == nil {
+		return context.Background()
+	}
+	return s.ctx
+}
+
+func (s *fakeClientStream) SendMsg(m interface{}) error {
+	return nil
+}
+
+func (s *fakeClientStream) RecvMsg(m interface{}) error {
+	if s.recv == 0 {
+		if s.err != nil {
+			return s.err
+		}
+		return io.EOF
+	}
+	s.recv--
+	return nil
+}
+
+func TestStreamClientLogInterceptor(t *testing.T) {
+	buf := new(bytes.Buffer)
+	logger := elog.New("test")
+	logger.SetOutput(buf)
+
+	cc, err := grpc.Dial("127.0.0.1:0", grpc.WithInsecure())
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer cc.Close()
+
+	desc := &grpc.StreamDesc{ServerStreams: true}
+	stream, err := NewStreamClientLogInterceptor(logger)(context.Background(), desc, cc, "/test/Watch",
+		func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+			return &fakeClientStream{recv: 3}, nil
+		})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	assert.NoError(t, stream.SendMsg(&healthpb.HealthCheckRequest{Service: "hello"}))
+	for stream.RecvMsg(new(healthpb.HealthCheckResponse)) == nil {
+	}
+	// logged once
+	stream.RecvMsg(new(healthpb.HealthCheckResponse))
+
+	var line map[string]interface{}
+	if assert.NoError(t, json.Unmarshal(buf.Bytes(), &line)) {
+		assert.Equal(t, "/test/Watch", line["method"])
+		assert.EqualValues(t, 3, line["recv_msgs"])
+		assert.EqualValues(t, 1, line["sent_msgs"])
+		assert.EqualValues(t, 7, line["sent_bytes"])
+		assert.Equal(t, "OK", line["code"])
+	}
+}
+
+func TestStreamClientLogInterceptorClientStream(t *testing.T) {
+	buf := new(bytes.Buffer)
+	logger := elog.New("test")
+	logger.SetOutput(buf)
+
+	cc, err := grpc.Dial("127.0.0.1:0", grpc.WithInsecure())
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer cc.Close()
+
+	// a client-streaming RPC receives its only response once, and ends with it
+	desc := &grpc.StreamDesc{ClientStreams: true}
+	stream, err := NewStreamClientLogInterceptor(logger)(context.Background(), desc, cc, "/test/Upload",
+		func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+			return &fakeClientStream{recv: 1}, nil
+		})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	assert.NoError(t, stream.SendMsg(&healthpb.HealthCheckRequest{Service: "hello"}))
+	assert.NoError(t, stream.SendMsg(&healthpb.HealthCheckRequest{Service: "world"}))
+	assert.NoError(t, stream.RecvMsg(new(healthpb.HealthCheckResponse)))
+
+	var line map[string]interface{}
+	if assert.NoError(t, json.Unmarshal(buf.Bytes(), &line)) {
+		assert.Equal(t, "/test/Upload", line["method"])
+		assert.Equal(t, true, line["client_stream"])
+		assert.EqualValues(t, 1, line["recv_msgs"])
+		assert.EqualValues(t, 2, line["sent_msgs"])
+		assert.Equal(t, "OK", line["code"])
+	}
+}
+
+func TestStreamClientLogInterceptorCancel(t *testing.T) {
+	logged := make(chan []byte, 1)
+	logger := elog.New("test")
+	logger.SetOutput(writerFunc(func(p []byte) (int, error) {
+		logged <- append([]byte(nil), p...)
+		return len(p), nil
+	}))
+
+	cc, err := grpc.Dial("127.0.0.1:0", grpc.WithInsecure())
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer cc.Close()
+
+	// the stream is canceled instead of received until the end
+	ctx, cancel := context.WithCancel(context.Background())
+	desc := &grpc.StreamDesc{ServerStreams: true}
+	stream, err := NewStreamClientLogInterceptor(logger)(ctx, desc, cc, "/test/Watch",
+		func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+			return &fakeClientStream{recv: 3, ctx: ctx}, nil
+		})
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.NoError(t, stream.RecvMsg(new(healthpb.HealthCheckResponse)))
+	cancel()
+
+	select {
+	case p := <-logged:
+		var line map[string]interface{}
+		if assert.NoError(t, json.Unmarshal(p, &line)) {
+			assert.EqualValues(t, 1, line["recv_msgs"])
+			assert.Equal(t, "Canceled", line["code"])
+		}
+	case <-time.After(time.Second):
+		t.Error("canceled stream is not logged")
+	}
+}
+
+type writerFunc func(p []byte) (int, error)
+
+func (f writerFunc) Write(p []byte) (int, error) {
+	return f(p)
+}
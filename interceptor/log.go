@@ -26,6 +26,7 @@ func NewLogInterceptor(logger util.Logger) grpc.UnaryServerInterceptor {
 			"resp":        marshal(resp),
 			"err":         err,
 		}
+		util.AddRequestID(json, ctx)
 
 		logger.Infoj(json)
 
@@ -0,0 +1,230 @@
+package interceptor
+
+import (
+	"io"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+var (
+	_ prometheus.Collector = &ServerMetrics{}
+	_ prometheus.Collector = &ClientMetrics{}
+
+	// DefaultLatencyBuckets of the latency histograms, in second
+	DefaultLatencyBuckets = []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+)
+
+// rpcMetrics are the metrics of one side of gRPC calls, labelled by full method
+type rpcMetrics struct {
+	handled  *prometheus.CounterVec
+	latency  *prometheus.HistogramVec
+	inFlight *prometheus.GaugeVec
+	received *prometheus.CounterVec
+	sent     *prometheus.CounterVec
+}
+
+func newRPCMetrics(side string, labels ...string) rpcMetrics {
+	methodLabels := append(labels, "method")
+	return rpcMetrics{
+		handled: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "grpc_" + side + "_handled_total",
+			Help: "total number of RPCs completed, by status code",
+		}, append(methodLabels, "code")),
+		latency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "grpc_" + side + "_handling_seconds",
+			Help:    "latency of RPCs until completion in second",
+			Buckets: DefaultLatencyBuckets,
+		}, methodLabels),
+		inFlight: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "grpc_" + side + "_in_flight",
+			Help: "number of RPCs in progress",
+		}, methodLabels),
+		received: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "grpc_" + side + "_msg_received_total",
+			Help: "total number of stream messages received",
+		}, methodLabels),
+		sent: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "grpc_" + side + "_msg_sent_total",
+			Help: "total number of stream messages sent",
+		}, methodLabels),
+	}
+}
+
+func (m rpcMetrics) collectors() []prometheus.Collector {
+	return []prometheus.Collector{m.handled, m.latency, m.inFlight, m.received, m.sent}
+}
+
+// Describe implements prometheus.Collector
+func (m rpcMetrics) Describe(ch chan<- *prometheus.Desc) {
+	for _, c := range m.collectors() {
+		c.Describe(ch)
+	}
+}
+
+// Collect implements prometheus.Collector
+func (m rpcMetrics) Collect(ch chan<- prometheus.Metric) {
+	for _, c := range m.collectors() {
+		c.Collect(ch)
+	}
+}
+
+// start records the beginning of an RPC, the returned func records the end of it
+func (m rpcMetrics) start(labels ...string) func(error) {
+	start := time.Now()
+	m.inFlight.WithLabelValues(labels...).Inc()
+	return func(err error) {
+		m.inFlight.WithLabelValues(labels...).Dec()
+		m.latency.WithLabelValues(labels...).Observe(time.Since(start).Seconds())
+		m.handled.WithLabelValues(append(labels, status.Code(err).String())...).Inc()
+	}
+}
+
+// ServerMetrics records the count, latency and in-flight number of RPCs of gRPC servers, and the
+// messages of streams. It is a prometheus.Collector to be registered on a registry.
+type ServerMetrics struct {
+	rpcMetrics
+}
+
+// NewServerMetrics returns ServerMetrics, with metrics named grpc_server_*
+func NewServerMetrics() *ServerMetrics {
+	return &ServerMetrics{rpcMetrics: newRPCMetrics("server")}
+}
+
+// UnaryServerInterceptor returns the interceptor recording unary RPCs
+func (m *ServerMetrics) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		end := m.start(info.FullMethod)
+		resp, err := handler(ctx, req)
+		end(err)
+		return resp, err
+	}
+}
+
+// StreamServerInterceptor returns the interceptor recording stream RPCs
+func (m *ServerMetrics) StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		end := m.start(info.FullMethod)
+		err := handler(srv, &metricsServerStream{
+			ServerStream: ss,
+			received:     m.received.WithLabelValues(info.FullMethod),
+			sent:         m.sent.WithLabelValues(info.FullMethod),
+		})
+		end(err)
+		return err
+	}
+}
+
+type metricsServerStream struct {
+	grpc.ServerStream
+	received, sent prometheus.Counter
+}
+
+func (s *metricsServerStream) RecvMsg(m interface{}) error {
+	err := s.ServerStream.RecvMsg(m)
+	if err == nil {
+		s.received.Inc()
+	}
+	return err
+}
+
+func (s *metricsServerStream) SendMsg(m interface{}) error {
+	err := s.ServerStream.SendMsg(m)
+	if err == nil {
+		s.sent.Inc()
+	}
+	return err
+}
+
+// ClientMetrics records the count, latency and in-flight number of RPCs of gRPC clients by target,
+// and the messages of streams. It is a prometheus.Collector to be registered on a registry.
+type ClientMetrics struct {
+	rpcMetrics
+}
+
+// NewClientMetrics returns ClientMetrics, with metrics named grpc_client_*
+func NewClientMetrics() *ClientMetrics {
+	return &ClientMetrics{rpcMetrics: newRPCMetrics("client", "target")}
+}
+
+// UnaryClientInterceptor returns the interceptor recording unary RPCs
+func (m *ClientMetrics) UnaryClientInterceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		end := m.start(target(cc), method)
+		err := invoker(ctx, method, req, reply, cc, opts...)
+		end(err)
+		return err
+	}
+}
+
+// StreamClientInterceptor returns the interceptor recording stream RPCs. A stream ends when
+// receiving from it returns an error, io.EOF included, after the only response of streams without
+// ServerStreams, or when ctx is done.
+func (m *ClientMetrics) StreamClientInterceptor() grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		end := m.start(target(cc), method)
+		stream, err := streamer(ctx, desc, cc, method, opts...)
+		if err != nil {
+			end(err)
+			return nil, err
+		}
+		ms := &metricsClientStream{
+			ClientStream: stream,
+			desc:         desc,
+			received:     m.received.WithLabelValues(target(cc), method),
+			sent:         m.sent.WithLabelValues(target(cc), method),
+			end:          end,
+		}
+		watchClientStream(ctx, stream, ms.finish)
+		return ms, nil
+	}
+}
+
+func target(cc *grpc.ClientConn) string {
+	if cc == nil {
+		return ""
+	}
+	return cc.Target()
+}
+
+type metricsClientStream struct {
+	grpc.ClientStream
+	desc           *grpc.StreamDesc
+	received, sent prometheus.Counter
+	end            func(error)
+	once           sync.Once
+}
+
+func (s *metricsClientStream) RecvMsg(m interface{}) error {
+	err := s.ClientStream.RecvMsg(m)
+	if err == nil {
+		s.received.Inc()
+		if !s.desc.ServerStreams {
+			s.finish(nil)
+		}
+		return nil
+	}
+	if err == io.EOF {
+		s.finish(nil)
+	} else {
+		s.finish(err)
+	}
+	return err
+}
+
+// finish records the end of the stream once, as it ends either in RecvMsg or when ctx is done
+func (s *metricsClientStream) finish(err error) {
+	s.once.Do(func() { s.end(err) })
+}
+
+func (s *metricsClientStream) SendMsg(m interface{}) error {
+	err := s.ClientStream.SendMsg(m)
+	if err == nil {
+		s.sent.Inc()
+	}
+	return err
+}
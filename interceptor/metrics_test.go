@@ -0,0 +1,117 @@
+package interceptor
+
+import (
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+)
+
+func TestServerMetrics(t *testing.T) {
+	m := NewServerMetrics()
+	registry := prometheus.NewRegistry()
+	assert.NoError(t, registry.Register(m))
+
+	unary := m.UnaryServerInterceptor()
+	info := &grpc.UnaryServerInfo{FullMethod: "/test/Unary"}
+	unary(context.Background(), nil, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		assert.Equal(t, float64(1), testutil.ToFloat64(m.inFlight.WithLabelValues("/test/Unary")))
+		return nil, nil
+	})
+	unary(context.Background(), nil, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return nil, status.Error(codes.NotFound, "not found")
+	})
+	assert.Equal(t, float64(1), testutil.ToFloat64(m.handled.WithLabelValues("/test/Unary", "OK")))
+	assert.Equal(t, float64(1), testutil.ToFloat64(m.handled.WithLabelValues("/test/Unary", "NotFound")))
+	assert.Equal(t, float64(0), testutil.ToFloat64(m.inFlight.WithLabelValues("/test/Unary")))
+
+	stream := m.StreamServerInterceptor()
+	err := stream(nil, &fakeServerStream{recv: 3}, &grpc.StreamServerInfo{FullMethod: "/test/Stream"}, func(srv interface{}, ss grpc.ServerStream) error {
+		for {
+			var req healthpb.HealthCheckRequest
+			if err := ss.RecvMsg(&req); err == io.EOF {
+				return ss.SendMsg(&healthpb.HealthCheckResponse{})
+			}
+		}
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, float64(3), testutil.ToFloat64(m.received.WithLabelValues("/test/Stream")))
+	assert.Equal(t, float64(1), testutil.ToFloat64(m.sent.WithLabelValues("/test/Stream")))
+	assert.Equal(t, float64(1), testutil.ToFloat64(m.handled.WithLabelValues("/test/Stream", "OK")))
+
+	// registering metrics of another server on the same registry fails instead of panicking
+	assert.Error(t, registry.Register(NewServerMetrics()))
+}
+
+func TestClientMetrics(t *testing.T) {
+	m := NewClientMetrics()
+
+	unary := m.UnaryClientInterceptor()
+	unary(context.Background(), "/test/Unary", nil, nil, nil, func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		return status.Error(codes.Unavailable, "unavailable")
+	})
+	assert.Equal(t, float64(1), testutil.ToFloat64(m.handled.WithLabelValues("", "/test/Unary", "Unavailable")))
+	assert.Equal(t, 1, testutil.CollectAndCount(m.latency))
+
+	streamer := func(err error) grpc.Streamer {
+		return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+			return &fakeClientStream{recv: 2, err: err}, nil
+		}
+	}
+	for _, err := range []error{io.EOF, errors.New("broken")} {
+		cs, _ := m.StreamClientInterceptor()(context.Background(), &grpc.StreamDesc{ServerStreams: true}, nil, "/test/Stream", streamer(err))
+		assert.Equal(t, float64(1), testutil.ToFloat64(m.inFlight.WithLabelValues("", "/test/Stream")))
+		cs.SendMsg(nil)
+		for cs.RecvMsg(nil) == nil {
+		}
+		// the end of a stream is recorded once
+		cs.RecvMsg(nil)
+		assert.Equal(t, float64(0), testutil.ToFloat64(m.inFlight.WithLabelValues("", "/test/Stream")))
+	}
+	assert.Equal(t, float64(4), testutil.ToFloat64(m.received.WithLabelValues("", "/test/Stream")))
+	assert.Equal(t, float64(2), testutil.ToFloat64(m.sent.WithLabelValues("", "/test/Stream")))
+	assert.Equal(t, float64(1), testutil.ToFloat64(m.handled.WithLabelValues("", "/test/Stream", "OK")))
+	assert.Equal(t, float64(1), testutil.ToFloat64(m.handled.WithLabelValues("", "/test/Stream", "Unknown")))
+}
+
+func TestClientMetricsClientStream(t *testing.T) {
+	m := NewClientMetrics()
+	streamer := func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		return &fakeClientStream{recv: 1, ctx: ctx}, nil
+	}
+
+	// a client-streaming RPC ends with its only response
+	desc := &grpc.StreamDesc{ClientStreams: true}
+	cs, err := m.StreamClientInterceptor()(context.Background(), desc, nil, "/test/Upload", streamer)
+	if !assert.NoError(t, err) {
+		return
+	}
+	cs.SendMsg(nil)
+	cs.SendMsg(nil)
+	assert.NoError(t, cs.RecvMsg(nil))
+	assert.Equal(t, float64(0), testutil.ToFloat64(m.inFlight.WithLabelValues("", "/test/Upload")))
+	assert.Equal(t, float64(1), testutil.ToFloat64(m.handled.WithLabelValues("", "/test/Upload", "OK")))
+	assert.Equal(t, float64(2), testutil.ToFloat64(m.sent.WithLabelValues("", "/test/Upload")))
+
+	// a stream canceled before its response ends with ctx
+	ctx, cancel := context.WithCancel(context.Background())
+	_, err = m.StreamClientInterceptor()(ctx, desc, nil, "/test/Upload", streamer)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, float64(1), testutil.ToFloat64(m.inFlight.WithLabelValues("", "/test/Upload")))
+	cancel()
+	assert.Eventually(t, func() bool {
+		return testutil.ToFloat64(m.handled.WithLabelValues("", "/test/Upload", "Canceled")) == 1
+	}, time.Second, 10*time.Millisecond)
+	assert.Equal(t, float64(0), testutil.ToFloat64(m.inFlight.WithLabelValues("", "/test/Upload")))
+}
@@ -0,0 +1,128 @@
+package interceptor
+
+import (
+	"math"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/silentred/toolkit/auth"
+	"github.com/silentred/toolkit/ratelimit"
+	"github.com/silentred/toolkit/util"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	mdRateLimitLimit     = "x-ratelimit-limit"
+	mdRateLimitRemaining = "x-ratelimit-remaining"
+	mdRateLimitReset     = "x-ratelimit-reset"
+	mdRetryAfter         = "retry-after"
+)
+
+// RateLimiter limits calls by key. The X-RateLimit headers are sent in the header metadata, and
+// calls over the limit fail with ResourceExhausted and retry-after in the trailer.
+type RateLimiter struct {
+	Limiter ratelimit.Limiter
+	// Key of calls to limit, KeyByPeer by default
+	Key func(ctx context.Context, method string) string
+	// Logger logs the errors of the limiter, which allows calls, optional
+	Logger util.Logger
+}
+
+// NewRateLimiter returns a RateLimiter keyed by key, or KeyByPeer if it is nil
+func NewRateLimiter(limiter ratelimit.Limiter, key func(ctx context.Context, method string) string) *RateLimiter {
+	if key == nil {
+		key = KeyByPeer
+	}
+	return &RateLimiter{Limiter: limiter, Key: key}
+}
+
+// KeyByPeer keys calls by the IP of the peer
+func KeyByPeer(ctx context.Context, method string) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return "ip:"
+	}
+	addr := p.Addr.String()
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		addr = host
+	}
+	return "ip:" + addr
+}
+
+// KeyByPrincipal keys calls by the subject of the principal stored by Authenticator, or by peer
+// without principal
+func KeyByPrincipal(ctx context.Context, method string) string {
+	if p, ok := auth.PrincipalFromContext(ctx); ok {
+		return "sub:" + p.Subject
+	}
+	return KeyByPeer(ctx, method)
+}
+
+// KeyByMethod keys calls by the full method name
+func KeyByMethod(ctx context.Context, method string) string {
+	return "method:" + method
+}
+
+// UnaryServerInterceptor limits unary calls
+func (l *RateLimiter) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		header, trailer, err := l.allow(ctx, info.FullMethod)
+		if header != nil {
+			grpc.SetHeader(ctx, header)
+		}
+		if err != nil {
+			grpc.SetTrailer(ctx, trailer)
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptor limits streams
+func (l *RateLimiter) StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		header, trailer, err := l.allow(ss.Context(), info.FullMethod)
+		if header != nil {
+			ss.SetHeader(header)
+		}
+		if err != nil {
+			ss.SetTrailer(trailer)
+			return err
+		}
+		return handler(srv, ss)
+	}
+}
+
+// allow returns the header metadata of the limit, and the error and trailer of calls over the limit
+func (l *RateLimiter) allow(ctx context.Context, method string) (metadata.MD, metadata.MD, error) {
+	res, err := l.Limiter.Allow(l.Key(ctx, method))
+	if err != nil {
+		// calls are not blocked by a broken limiter
+		if l.Logger != nil {
+			l.Logger.Errorf("rate limit of %s: %v", method, err)
+		}
+		return nil, nil, nil
+	}
+
+	header := metadata.Pairs(
+		mdRateLimitLimit, strconv.Itoa(res.Limit),
+		mdRateLimitRemaining, strconv.Itoa(res.Remaining),
+		mdRateLimitReset, seconds(res.ResetAfter),
+	)
+	if res.Allowed {
+		return header, nil, nil
+	}
+	trailer := metadata.Pairs(mdRetryAfter, seconds(res.RetryAfter))
+	return header, trailer, status.Errorf(codes.ResourceExhausted, "rate limit of %s is exceeded, retry after %v", method, res.RetryAfter)
+}
+
+// seconds rounds d up to seconds
+func seconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
@@ -0,0 +1,51 @@
+package interceptor
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/silentred/toolkit/auth"
+	"github.com/silentred/toolkit/ratelimit"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+func TestRateLimitKeys(t *testing.T) {
+	ctx := peer.NewContext(context.Background(), &peer.Peer{Addr: &net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 5000}})
+	assert.Equal(t, "ip:10.0.0.1", KeyByPeer(ctx, "/pkg.Svc/Get"))
+	assert.Equal(t, "ip:10.0.0.1", KeyByPrincipal(ctx, "/pkg.Svc/Get"))
+	assert.Equal(t, "sub:alice", KeyByPrincipal(auth.WithPrincipal(ctx, &auth.Principal{Subject: "alice"}), "/pkg.Svc/Get"))
+	assert.Equal(t, "method:/pkg.Svc/Get", KeyByMethod(ctx, "/pkg.Svc/Get"))
+}
+
+func TestRateLimiter(t *testing.T) {
+	l := NewRateLimiter(ratelimit.NewLocalTokenBucket(ratelimit.Rate{Limit: 1, Period: time.Minute}), KeyByMethod)
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return "ok", nil
+	}
+	info := &grpc.UnaryServerInfo{FullMethod: "/pkg.Svc/Get"}
+
+	resp, err := l.UnaryServerInterceptor()(context.Background(), nil, info, handler)
+	assert.NoError(t, err)
+	assert.Equal(t, "ok", resp)
+	_, err = l.UnaryServerInterceptor()(context.Background(), nil, info, handler)
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+
+	// streams of another method have their own limit
+	ss := &fakeServerStream{}
+	streamInfo := &grpc.StreamServerInfo{FullMethod: "/pkg.Svc/Watch"}
+	stream := func(srv interface{}, ss grpc.ServerStream) error { return nil }
+	assert.NoError(t, l.StreamServerInterceptor()(nil, ss, streamInfo, stream))
+	assert.Equal(t, []string{"1"}, ss.header.Get(mdRateLimitLimit))
+	assert.Equal(t, []string{"0"}, ss.header.Get(mdRateLimitRemaining))
+
+	ss = &fakeServerStream{}
+	err = l.StreamServerInterceptor()(nil, ss, streamInfo, stream)
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+	assert.Equal(t, []string{"60"}, ss.trailer.Get(mdRetryAfter))
+}
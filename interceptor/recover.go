@@ -23,7 +23,8 @@ func NewRecovery(logger util.Logger) grpc.UnaryServerInterceptor {
 				// log stack
 				stack := make([]byte, MaxStackSize)
 				stack = stack[:runtime.Stack(stack, false)]
-				logger.Errorf("panic grpc invoke: %s, err=%v, stack:\n%s", info.FullMethod, r, string(stack))
+				logger.Errorf("panic grpc invoke: %s, request_id=%s, err=%v, stack:\n%s", info.FullMethod,
+					util.RequestIDFromContext(ctx), r, string(stack))
 
 				// if panic, set custom error to 'err', in order that client and sense it.
 				err = grpc.Errorf(codes.Internal, "panic error: %v", r)
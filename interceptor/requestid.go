@@ -0,0 +1,95 @@
+package interceptor
+
+import (
+	"strings"
+
+	"github.com/silentred/toolkit/util"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+var (
+	// metadata keys are lowercase
+	mdRequestID   = strings.ToLower(util.HeaderRequestID)
+	mdTraceparent = util.HeaderTraceparent
+	mdTracestate  = util.HeaderTracestate
+)
+
+// NewRequestIDInterceptor returns an interceptor accepting the request ID and W3C trace-context
+// of the caller from metadata, or generating them, and storing them in the context. The request ID
+// is sent back in the header metadata.
+func NewRequestIDInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		ctx = startRequest(ctx)
+		grpc.SetHeader(ctx, metadata.Pairs(mdRequestID, util.RequestIDFromContext(ctx)))
+		return handler(ctx, req)
+	}
+}
+
+// NewStreamRequestIDInterceptor returns the stream version of NewRequestIDInterceptor
+func NewStreamRequestIDInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx := startRequest(ss.Context())
+		ss.SetHeader(metadata.Pairs(mdRequestID, util.RequestIDFromContext(ctx)))
+		return handler(srv, &contextStream{ServerStream: ss, ctx: ctx})
+	}
+}
+
+// NewClientRequestIDInterceptor returns an interceptor sending the request ID and trace-context
+// of the context in the outgoing metadata
+func NewClientRequestIDInterceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		return invoker(outgoingRequestID(ctx), method, req, reply, cc, opts...)
+	}
+}
+
+// NewStreamClientRequestIDInterceptor returns the stream version of NewClientRequestIDInterceptor
+func NewStreamClientRequestIDInterceptor() grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		return streamer(outgoingRequestID(ctx), desc, cc, method, opts...)
+	}
+}
+
+// contextStream overrides the context of a ServerStream
+type contextStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *contextStream) Context() context.Context {
+	return s.ctx
+}
+
+func startRequest(ctx context.Context) context.Context {
+	md, _ := metadata.FromIncomingContext(ctx)
+	return util.StartRequest(ctx, firstValue(md, mdRequestID), firstValue(md, mdTraceparent), firstValue(md, mdTracestate))
+}
+
+// firstValue returns the first value of key in md
+func firstValue(md metadata.MD, key string) string {
+	if values := md.Get(key); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+// outgoingRequestID appends the request ID and trace-context of ctx to the outgoing metadata,
+// unless they are set already
+func outgoingRequestID(ctx context.Context) context.Context {
+	md, _ := metadata.FromOutgoingContext(ctx)
+	var kv []string
+	if id := util.RequestIDFromContext(ctx); len(id) > 0 && len(md.Get(mdRequestID)) == 0 {
+		kv = append(kv, mdRequestID, id)
+	}
+	if tc, ok := util.TraceContextFromContext(ctx); ok && tc.Valid() && len(md.Get(mdTraceparent)) == 0 {
+		kv = append(kv, mdTraceparent, tc.Traceparent())
+		if len(tc.State) > 0 {
+			kv = append(kv, mdTracestate, tc.State)
+		}
+	}
+	if len(kv) == 0 {
+		return ctx
+	}
+	return metadata.AppendToOutgoingContext(ctx, kv...)
+}
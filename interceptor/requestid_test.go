@@ -0,0 +1,48 @@
+package interceptor
+
+import (
+	"testing"
+
+	"github.com/silentred/toolkit/util"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+func TestRequestIDInterceptor(t *testing.T) {
+	const traceparent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	incoming := metadata.NewIncomingContext(context.Background(), metadata.Pairs("x-request-id", "req-1", "traceparent", traceparent))
+
+	var ctx context.Context
+	NewRequestIDInterceptor()(incoming, nil, &grpc.UnaryServerInfo{FullMethod: "/test/Unary"}, func(c context.Context, req interface{}) (interface{}, error) {
+		ctx = c
+		return nil, nil
+	})
+	assert.Equal(t, "req-1", util.RequestIDFromContext(ctx))
+	tc, ok := util.TraceContextFromContext(ctx)
+	if assert.True(t, ok) {
+		assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", tc.TraceID)
+		assert.NotEqual(t, "00f067aa0ba902b7", tc.SpanID)
+	}
+
+	// the request ID and trace-context are sent to the next service
+	var md metadata.MD
+	NewClientRequestIDInterceptor()(ctx, "/test/Next", nil, nil, nil, func(c context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		md, _ = metadata.FromOutgoingContext(c)
+		return nil
+	})
+	assert.Equal(t, []string{"req-1"}, md.Get("x-request-id"))
+	assert.Equal(t, []string{tc.Traceparent()}, md.Get("traceparent"))
+
+	// a stream without request ID gets a new trace, and its ID
+	NewStreamRequestIDInterceptor()(nil, &fakeServerStream{}, &grpc.StreamServerInfo{FullMethod: "/test/Stream"}, func(srv interface{}, ss grpc.ServerStream) error {
+		ctx = ss.Context()
+		return nil
+	})
+	tc, ok = util.TraceContextFromContext(ctx)
+	if assert.True(t, ok) {
+		assert.Len(t, tc.TraceID, 32)
+		assert.Equal(t, tc.TraceID, util.RequestIDFromContext(ctx))
+	}
+}
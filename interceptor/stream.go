@@ -0,0 +1,116 @@
+package interceptor
+
+import (
+	"runtime"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/gogo/protobuf/proto"
+	"github.com/labstack/gommon/log"
+	"github.com/silentred/toolkit/util"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+)
+
+// StreamInterceptorChain build the multi stream interceptors into one interceptor chain.
+func StreamInterceptorChain(interceptors ...grpc.StreamServerInterceptor) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		chain := handler
+		for i := len(interceptors) - 1; i >= 0; i-- {
+			chain = buildStream(interceptors[i], chain, info)
+		}
+		return chain(srv, ss)
+	}
+}
+
+// buildStream is the stream interceptor chain helper
+func buildStream(c grpc.StreamServerInterceptor, n grpc.StreamHandler, info *grpc.StreamServerInfo) grpc.StreamHandler {
+	return func(srv interface{}, ss grpc.ServerStream) error {
+		return c(srv, ss, info, n)
+	}
+}
+
+// NewStreamRecovery return a recover stream interceptor for gRPC
+func NewStreamRecovery(logger util.Logger) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+		// recovery func
+		defer func() {
+			if r := recover(); r != nil {
+				// log stack
+				stack := make([]byte, MaxStackSize)
+				stack = stack[:runtime.Stack(stack, false)]
+				logger.Errorf("panic grpc stream: %s, request_id=%s, err=%v, stack:\n%s", info.FullMethod,
+					util.RequestIDFromContext(ss.Context()), r, string(stack))
+
+				// if panic, set custom error to 'err', in order that client and sense it.
+				err = grpc.Errorf(codes.Internal, "panic error: %v", r)
+			}
+		}()
+
+		return handler(srv, ss)
+	}
+}
+
+// NewStreamLogInterceptor returns a log stream interceptor for gRPC, which logs a summary
+// of every stream when it ends: the count and the bytes of messages and the duration
+func NewStreamLogInterceptor(logger util.Logger) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		start := time.Now()
+		cs := &countingStream{ServerStream: ss}
+		err := handler(srv, cs)
+		stop := time.Now()
+
+		json := log.JSON{
+			"time_unix":     strconv.FormatInt(time.Now().Unix(), 10),
+			"method":        info.FullMethod,
+			"client_stream": info.IsClientStream,
+			"server_stream": info.IsServerStream,
+			"latency":       strconv.FormatInt(int64(stop.Sub(start)), 10),
+			"latency_str":   stop.Sub(start).String(),
+			"recv_msgs":     atomic.LoadInt64(&cs.recvMsgs),
+			"recv_bytes":    atomic.LoadInt64(&cs.recvBytes),
+			"sent_msgs":     atomic.LoadInt64(&cs.sentMsgs),
+			"sent_bytes":    atomic.LoadInt64(&cs.sentBytes),
+			"err":           err,
+		}
+		util.AddRequestID(json, ss.Context())
+
+		logger.Infoj(json)
+
+		return err
+	}
+}
+
+// countingStream counts the messages received and sent successfully
+type countingStream struct {
+	grpc.ServerStream
+	recvMsgs, recvBytes int64
+	sentMsgs, sentBytes int64
+}
+
+func (s *countingStream) RecvMsg(m interface{}) error {
+	err := s.ServerStream.RecvMsg(m)
+	if err == nil {
+		atomic.AddInt64(&s.recvMsgs, 1)
+		atomic.AddInt64(&s.recvBytes, int64(messageSize(m)))
+	}
+	return err
+}
+
+func (s *countingStream) SendMsg(m interface{}) error {
+	err := s.ServerStream.SendMsg(m)
+	if err == nil {
+		atomic.AddInt64(&s.sentMsgs, 1)
+		atomic.AddInt64(&s.sentBytes, int64(messageSize(m)))
+	}
+	return err
+}
+
+// messageSize returns the encoded size of a protocol buffer message, or 0 for other values
+func messageSize(m interface{}) int {
+	if pb, ok := m.(proto.Message); ok {
+		return proto.Size(pb)
+	}
+	return 0
+}
@@ -0,0 +1,112 @@
+package interceptor
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"testing"
+
+	elog "github.com/labstack/gommon/log"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+type fakeServerStream struct {
+	grpc.ServerStream
+	ctx     context.Context
+	recv    int
+	header  metadata.MD
+	trailer metadata.MD
+}
+
+func (s *fakeServerStream) Context() context.Context {
+	if s.ctx == nil {
+		return context.Background()
+	}
+	return s.ctx
+}
+
+func (s *fakeServerStream) SetHeader(md metadata.MD) error {
+	s.header = metadata.Join(s.header, md)
+	return nil
+}
+
+func (s *fakeServerStream) SetTrailer(md metadata.MD) {
+	s.trailer = metadata.Join(s.trailer, md)
+}
+
+func (s *fakeServerStream) RecvMsg(m interface{}) error {
+	if s.recv == 0 {
+		return io.EOF
+	}
+	s.recv--
+	*m.(*healthpb.HealthCheckRequest) = healthpb.HealthCheckRequest{Service: "hello"}
+	return nil
+}
+
+func (s *fakeServerStream) SendMsg(m interface{}) error {
+	return nil
+}
+
+func TestStreamInterceptorChain(t *testing.T) {
+	var calls []string
+	record := func(name string) grpc.StreamServerInterceptor {
+		return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+			calls = append(calls, name)
+			return handler(srv, ss)
+		}
+	}
+
+	chain := StreamInterceptorChain(record("first"), record("second"))
+	err := chain(nil, &fakeServerStream{}, &grpc.StreamServerInfo{}, func(srv interface{}, ss grpc.ServerStream) error {
+		calls = append(calls, "handler")
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"first", "second", "handler"}, calls)
+}
+
+func TestStreamRecovery(t *testing.T) {
+	logger := elog.New("test")
+	logger.SetOutput(new(bytes.Buffer))
+
+	err := NewStreamRecovery(logger)(nil, &fakeServerStream{}, &grpc.StreamServerInfo{FullMethod: "/test/Panic"},
+		func(srv interface{}, ss grpc.ServerStream) error {
+			panic("boom")
+		})
+	assert.Equal(t, codes.Internal, status.Code(err))
+}
+
+func TestStreamLogInterceptor(t *testing.T) {
+	buf := new(bytes.Buffer)
+	logger := elog.New("test")
+	logger.SetOutput(buf)
+
+	info := &grpc.StreamServerInfo{FullMethod: "/test/Stream", IsClientStream: true}
+	err := NewStreamLogInterceptor(logger)(nil, &fakeServerStream{recv: 2}, info, func(srv interface{}, ss grpc.ServerStream) error {
+		for {
+			req := new(healthpb.HealthCheckRequest)
+			if err := ss.RecvMsg(req); err == io.EOF {
+				break
+			}
+		}
+		return ss.SendMsg(&healthpb.HealthCheckResponse{Status: healthpb.HealthCheckResponse_SERVING})
+	})
+	assert.NoError(t, err)
+
+	var line map[string]interface{}
+	if assert.NoError(t, json.Unmarshal(buf.Bytes(), &line)) {
+		assert.Equal(t, "/test/Stream", line["method"])
+		assert.EqualValues(t, 2, line["recv_msgs"])
+		// "hello" is encoded in 7 bytes
+		assert.EqualValues(t, 14, line["recv_bytes"])
+		assert.EqualValues(t, 1, line["sent_msgs"])
+		assert.EqualValues(t, 2, line["sent_bytes"])
+		assert.Equal(t, true, line["client_stream"])
+	}
+}
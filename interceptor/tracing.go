@@ -0,0 +1,119 @@
+package interceptor
+
+import (
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/silentred/toolkit/util"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.4.0"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// NewTracingInterceptor returns an interceptor starting a server span for every call, as a child of
+// the caller in the traceparent metadata. It should be used before NewRequestIDInterceptor, which
+// keeps the trace of the span.
+func NewTracingInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		ctx, span := startServerSpan(ctx, info.FullMethod)
+		resp, err := handler(ctx, req)
+		endSpan(span, err)
+		return resp, err
+	}
+}
+
+// NewStreamTracingInterceptor returns the stream version of NewTracingInterceptor
+func NewStreamTracingInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, span := startServerSpan(ss.Context(), info.FullMethod)
+		err := handler(srv, &contextStream{ServerStream: ss, ctx: ctx})
+		endSpan(span, err)
+		return err
+	}
+}
+
+// NewClientTracingInterceptor returns an interceptor starting a client span for every call. The span is
+// propagated by NewClientRequestIDInterceptor, which should be used after it.
+func NewClientTracingInterceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		ctx, span := util.StartSpan(ctx, spanName(method), trace.SpanKindClient, rpcAttributes(method)...)
+		err := invoker(ctx, method, req, reply, cc, opts...)
+		endSpan(span, err)
+		return err
+	}
+}
+
+// NewStreamClientTracingInterceptor returns the stream version of NewClientTracingInterceptor.
+// A span ends when receiving from the stream returns an error, io.EOF included, after the only
+// response of streams without ServerStreams, or when ctx is done.
+func NewStreamClientTracingInterceptor() grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		ctx, span := util.StartSpan(ctx, spanName(method), trace.SpanKindClient, rpcAttributes(method)...)
+		stream, err := streamer(ctx, desc, cc, method, opts...)
+		if err != nil {
+			endSpan(span, err)
+			return nil, err
+		}
+		ts := &tracingClientStream{ClientStream: stream, desc: desc, span: span}
+		watchClientStream(ctx, stream, ts.end)
+		return ts, nil
+	}
+}
+
+type tracingClientStream struct {
+	grpc.ClientStream
+	desc *grpc.StreamDesc
+	span trace.Span
+	once sync.Once
+}
+
+func (s *tracingClientStream) RecvMsg(m interface{}) error {
+	err := s.ClientStream.RecvMsg(m)
+	switch {
+	case err == nil:
+		if !s.desc.ServerStreams {
+			s.end(nil)
+		}
+	case err == io.EOF:
+		s.end(nil)
+	default:
+		s.end(err)
+	}
+	return err
+}
+
+// end ends the span once, as the stream ends either in RecvMsg or when ctx is done
+func (s *tracingClientStream) end(err error) {
+	s.once.Do(func() { endSpan(s.span, err) })
+}
+
+func startServerSpan(ctx context.Context, method string) (context.Context, trace.Span) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	return util.StartServerSpan(ctx, spanName(method), firstValue(md, mdTraceparent), firstValue(md, mdTracestate),
+		rpcAttributes(method)...)
+}
+
+// endSpan records the status code of err, and ends span
+func endSpan(span trace.Span, err error) {
+	span.SetAttributes(semconv.RPCGRPCStatusCodeKey.Int(int(status.Code(err))))
+	util.EndSpan(span, err)
+}
+
+// spanName returns the span name of a full method, as "pkg.Service/Method"
+func spanName(method string) string {
+	return strings.TrimPrefix(method, "/")
+}
+
+func rpcAttributes(method string) []attribute.KeyValue {
+	attrs := []attribute.KeyValue{semconv.RPCSystemKey.String("grpc")}
+	name := spanName(method)
+	if i := strings.LastIndex(name, "/"); i >= 0 {
+		attrs = append(attrs, semconv.RPCServiceKey.String(name[:i]), semconv.RPCMethodKey.String(name[i+1:]))
+	}
+	return attrs
+}
@@ -0,0 +1,92 @@
+package interceptor
+
+import (
+	"testing"
+	"time"
+
+	"github.com/silentred/toolkit/util"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestTracingInterceptor(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)))
+	defer otel.SetTracerProvider(trace.NewNoopTracerProvider())
+
+	const traceparent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	incoming := metadata.NewIncomingContext(context.Background(), metadata.Pairs("traceparent", traceparent))
+	server := UnaryInterceptorChain(NewTracingInterceptor(), NewRequestIDInterceptor())
+	client := UnaryClientInterceptorChain(NewClientTracingInterceptor(), NewClientRequestIDInterceptor())
+
+	var md metadata.MD
+	server(incoming, nil, &grpc.UnaryServerInfo{FullMethod: "/test.Service/Unary"}, func(ctx context.Context, req interface{}) (interface{}, error) {
+		// the request ID is the trace ID of the span
+		assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", util.RequestIDFromContext(ctx))
+		return nil, client(ctx, "/test.Next/Call", nil, nil, nil, func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+			md, _ = metadata.FromOutgoingContext(ctx)
+			return status.Error(codes.Unavailable, "unavailable")
+		})
+	})
+
+	spans := exporter.GetSpans()
+	if !assert.Len(t, spans, 2) {
+		return
+	}
+	clientSpan, serverSpan := spans[0], spans[1]
+	assert.Equal(t, "test.Service/Unary", serverSpan.Name)
+	assert.Equal(t, trace.SpanKindServer, serverSpan.SpanKind)
+	assert.Equal(t, "00f067aa0ba902b7", serverSpan.Parent.SpanID().String())
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", serverSpan.SpanContext.TraceID().String())
+
+	assert.Equal(t, "test.Next/Call", clientSpan.Name)
+	assert.Equal(t, serverSpan.SpanContext.SpanID(), clientSpan.Parent.SpanID())
+	assert.Equal(t, []string{"00-4bf92f3577b34da6a3ce929d0e0e4736-" + clientSpan.SpanContext.SpanID().String() + "-01"}, md.Get("traceparent"))
+	assert.Equal(t, "Error", clientSpan.Status.Code.String())
+}
+
+func TestStreamClientTracingInterceptor(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)))
+	defer otel.SetTracerProvider(trace.NewNoopTracerProvider())
+
+	streamer := func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		return &fakeClientStream{recv: 1, ctx: ctx}, nil
+	}
+	interceptor := NewStreamClientTracingInterceptor()
+
+	// a client-streaming RPC ends with its only response
+	desc := &grpc.StreamDesc{ClientStreams: true}
+	cs, err := interceptor(context.Background(), desc, nil, "/test.Service/Upload", streamer)
+	if !assert.NoError(t, err) {
+		return
+	}
+	cs.SendMsg(nil)
+	assert.NoError(t, cs.RecvMsg(nil))
+	if spans := exporter.GetSpans(); assert.Len(t, spans, 1) {
+		assert.Equal(t, "test.Service/Upload", spans[0].Name)
+		assert.Equal(t, "Unset", spans[0].Status.Code.String())
+	}
+
+	// a stream canceled before its response ends with ctx
+	exporter.Reset()
+	ctx, cancel := context.WithCancel(context.Background())
+	_, err = interceptor(ctx, desc, nil, "/test.Service/Upload", streamer)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Empty(t, exporter.GetSpans())
+	cancel()
+	assert.Eventually(t, func() bool {
+		spans := exporter.GetSpans()
+		return len(spans) == 1 && spans[0].Status.Code.String() == "Error"
+	}, time.Second, 10*time.Millisecond)
+}
@@ -0,0 +1,125 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// sweepInterval is the min interval of removing idle keys of local limiters
+var sweepInterval = time.Minute
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// LocalTokenBucket is a token bucket limiter in the process
+type LocalTokenBucket struct {
+	rate Rate
+
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	swept   time.Time
+}
+
+// NewLocalTokenBucket returns a LocalTokenBucket of rate
+func NewLocalTokenBucket(rate Rate) *LocalTokenBucket {
+	return &LocalTokenBucket{rate: rate, buckets: make(map[string]*bucket), swept: time.Now()}
+}
+
+// Allow implements Limiter
+func (l *LocalTokenBucket) Allow(key string) (Result, error) {
+	now := time.Now()
+	burst := float64(l.rate.burst())
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if now.Sub(l.swept) > sweepInterval {
+		// full buckets are the same as new ones
+		for k, b := range l.buckets {
+			if l.refill(b, now) >= burst {
+				delete(l.buckets, k)
+			}
+		}
+		l.swept = now
+	}
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: burst, last: now}
+		l.buckets[key] = b
+	}
+	b.tokens = l.refill(b, now)
+	b.last = now
+
+	allowed := b.tokens >= 1
+	if allowed {
+		b.tokens--
+	}
+	return tokenBucketResult(l.rate, allowed, b.tokens), nil
+}
+
+func (l *LocalTokenBucket) refill(b *bucket, now time.Time) float64 {
+	tokens := b.tokens + float64(now.Sub(b.last))/float64(l.rate.interval())
+	if burst := float64(l.rate.burst()); tokens > burst {
+		return burst
+	}
+	return tokens
+}
+
+type window struct {
+	start     time.Time
+	prev, cur int
+}
+
+// LocalSlidingWindow is a sliding window limiter in the process
+type LocalSlidingWindow struct {
+	rate Rate
+
+	mu      sync.Mutex
+	windows map[string]*window
+	swept   time.Time
+}
+
+// NewLocalSlidingWindow returns a LocalSlidingWindow of rate
+func NewLocalSlidingWindow(rate Rate) *LocalSlidingWindow {
+	return &LocalSlidingWindow{rate: rate, windows: make(map[string]*window), swept: time.Now()}
+}
+
+// Allow implements Limiter
+func (l *LocalSlidingWindow) Allow(key string) (Result, error) {
+	now := time.Now()
+	start := now.Truncate(l.rate.Period)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if now.Sub(l.swept) > sweepInterval {
+		for k, w := range l.windows {
+			if start.Sub(w.start) > l.rate.Period {
+				delete(l.windows, k)
+			}
+		}
+		l.swept = now
+	}
+
+	w, ok := l.windows[key]
+	if !ok {
+		w = &window{start: start}
+		l.windows[key] = w
+	}
+	switch {
+	case w.start.Equal(start):
+	case w.start.Add(l.rate.Period).Equal(start):
+		w.start, w.prev, w.cur = start, w.cur, 0
+	default:
+		w.start, w.prev, w.cur = start, 0, 0
+	}
+
+	res := slidingWindow(l.rate, now.Sub(start), w.prev, w.cur)
+	if res.Allowed {
+		w.cur++
+	}
+	return res, nil
+}
@@ -0,0 +1,102 @@
+// Package ratelimit limits the rate of requests by key, with token bucket and sliding window
+// algorithms in the process or in redis, shared by the instances of a service.
+package ratelimit
+
+import (
+	"math"
+	"time"
+)
+
+// Limiter decides whether a request of key is allowed
+type Limiter interface {
+	Allow(key string) (Result, error)
+}
+
+// Rate is Limit requests per Period
+type Rate struct {
+	Limit  int
+	Period time.Duration
+	// Burst is the capacity of token buckets, Limit by default. Sliding windows ignore it.
+	Burst int
+}
+
+// PerSecond returns the Rate of n requests per second
+func PerSecond(n int) Rate {
+	return Rate{Limit: n, Period: time.Second}
+}
+
+// PerMinute returns the Rate of n requests per minute
+func PerMinute(n int) Rate {
+	return Rate{Limit: n, Period: time.Minute}
+}
+
+func (r Rate) burst() int {
+	if r.Burst > 0 {
+		return r.Burst
+	}
+	return r.Limit
+}
+
+// interval is the time of refilling a token
+func (r Rate) interval() time.Duration {
+	return r.Period / time.Duration(r.Limit)
+}
+
+// Result of a request
+type Result struct {
+	Allowed bool
+	// Limit is the burst of token buckets, or the limit of sliding windows
+	Limit     int
+	Remaining int
+	// RetryAfter is the time until the next request could be allowed, 0 if this one is allowed
+	RetryAfter time.Duration
+	// ResetAfter is the time until the limit is fully available again
+	ResetAfter time.Duration
+}
+
+// tokenBucketResult returns the result of a bucket of tokens left
+func tokenBucketResult(rate Rate, allowed bool, tokens float64) Result {
+	interval := float64(rate.interval())
+	burst := rate.burst()
+	res := Result{
+		Allowed:    allowed,
+		Limit:      burst,
+		Remaining:  int(math.Floor(tokens)),
+		ResetAfter: time.Duration((float64(burst) - tokens) * interval),
+	}
+	if !allowed {
+		res.RetryAfter = time.Duration((1 - tokens) * interval)
+	}
+	return res
+}
+
+// slidingWindow decides a request in a window elapsed since it started, with the counts of the
+// previous and current windows. The count of the previous window is weighted by its overlap with
+// the sliding window.
+func slidingWindow(rate Rate, elapsed time.Duration, prev, cur int) Result {
+	weight := 1 - float64(elapsed)/float64(rate.Period)
+	count := float64(prev)*weight + float64(cur)
+
+	res := Result{
+		Allowed:    count+1 <= float64(rate.Limit),
+		Limit:      rate.Limit,
+		ResetAfter: 2*rate.Period - elapsed,
+	}
+	if res.Allowed {
+		count++
+		res.Remaining = int(math.Floor(float64(rate.Limit) - count))
+		return res
+	}
+
+	if cur+1 > rate.Limit || prev == 0 {
+		res.RetryAfter = rate.Period - elapsed
+	} else {
+		// the weight of prev decreases until the request fits
+		x := 1 - float64(rate.Limit-1-cur)/float64(prev)
+		res.RetryAfter = time.Duration(x*float64(rate.Period)) - elapsed
+	}
+	if res.RetryAfter <= 0 {
+		res.RetryAfter = time.Millisecond
+	}
+	return res
+}
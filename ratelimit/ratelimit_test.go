@@ -0,0 +1,78 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/stretchr/testify/assert"
+	redis "gopkg.in/redis.v5"
+)
+
+func testLimiter(t *testing.T, l Limiter, limit int) {
+	for i := 0; i < limit; i++ {
+		res, err := l.Allow("a")
+		assert.NoError(t, err)
+		assert.True(t, res.Allowed, i)
+		assert.Equal(t, limit, res.Limit)
+		assert.Equal(t, limit-1-i, res.Remaining)
+	}
+	res, err := l.Allow("a")
+	assert.NoError(t, err)
+	assert.False(t, res.Allowed)
+	assert.True(t, res.RetryAfter > 0)
+
+	// keys are limited separately
+	res, _ = l.Allow("b")
+	assert.True(t, res.Allowed)
+}
+
+func TestTokenBucket(t *testing.T) {
+	rate := Rate{Limit: 10, Period: time.Second, Burst: 3}
+	testLimiter(t, NewLocalTokenBucket(rate), 3)
+
+	mr, err := miniredis.Run()
+	assert.NoError(t, err)
+	defer mr.Close()
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	testLimiter(t, NewRedisTokenBucket(client, "", rate), 3)
+
+	// a token is refilled every 100ms
+	l := NewLocalTokenBucket(rate)
+	for i := 0; i < 3; i++ {
+		l.Allow("a")
+	}
+	res, _ := l.Allow("a")
+	assert.InDelta(t, float64(100*time.Millisecond), float64(res.RetryAfter), float64(10*time.Millisecond))
+	time.Sleep(res.RetryAfter)
+	res, _ = l.Allow("a")
+	assert.True(t, res.Allowed)
+}
+
+func TestSlidingWindow(t *testing.T) {
+	rate := PerMinute(3)
+	testLimiter(t, NewLocalSlidingWindow(rate), 3)
+
+	mr, err := miniredis.Run()
+	assert.NoError(t, err)
+	defer mr.Close()
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	testLimiter(t, NewRedisSlidingWindow(client, "", rate), 3)
+}
+
+func TestSlidingWindowWeight(t *testing.T) {
+	rate := Rate{Limit: 10, Period: time.Second}
+
+	// at the middle of the window, half of the previous window counts
+	res := slidingWindow(rate, 500*time.Millisecond, 10, 4)
+	assert.True(t, res.Allowed)
+	assert.Equal(t, 0, res.Remaining)
+	res = slidingWindow(rate, 500*time.Millisecond, 10, 5)
+	assert.False(t, res.Allowed)
+	assert.Equal(t, 100*time.Millisecond, res.RetryAfter)
+
+	// the current window is full
+	res = slidingWindow(rate, 500*time.Millisecond, 0, 10)
+	assert.False(t, res.Allowed)
+	assert.Equal(t, 500*time.Millisecond, res.RetryAfter)
+}
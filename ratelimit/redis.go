@@ -0,0 +1,134 @@
+package ratelimit
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	redis "gopkg.in/redis.v5"
+)
+
+// DefaultPrefix of the keys of redis limiters
+const DefaultPrefix = "ratelimit:"
+
+// tokenBucketScript refills and takes a token of the bucket in KEYS[1], a hash of tokens and ts.
+// ARGV are the tokens per ms, the burst, the time in ms and the ttl in ms.
+var tokenBucketScript = redis.NewScript(`
+local rate = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+local state = redis.call("HMGET", KEYS[1], "tokens", "ts")
+local tokens = tonumber(state[1])
+local ts = tonumber(state[2])
+if tokens == nil or ts == nil then
+	tokens = burst
+	ts = now
+end
+tokens = math.min(burst, tokens + math.max(0, now - ts) * rate)
+local allowed = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+end
+redis.call("HMSET", KEYS[1], "tokens", tostring(tokens), "ts", tostring(now))
+redis.call("PEXPIRE", KEYS[1], ARGV[4])
+return {allowed, tostring(tokens)}
+`)
+
+// slidingWindowScript counts a request in the current window KEYS[2] if it is allowed, with the
+// previous window KEYS[1]. ARGV are the limit, the weight of the previous window and the ttl in ms.
+var slidingWindowScript = redis.NewScript(`
+local limit = tonumber(ARGV[1])
+local weight = tonumber(ARGV[2])
+local prev = tonumber(redis.call("GET", KEYS[1]) or "0")
+local cur = tonumber(redis.call("GET", KEYS[2]) or "0")
+if prev * weight + cur + 1 <= limit then
+	redis.call("INCR", KEYS[2])
+	redis.call("PEXPIRE", KEYS[2], ARGV[3])
+end
+return {prev, cur}
+`)
+
+// RedisTokenBucket is a token bucket limiter in redis. The clocks of instances should be in sync.
+type RedisTokenBucket struct {
+	Client *redis.Client
+	Prefix string
+	rate   Rate
+}
+
+// NewRedisTokenBucket returns a RedisTokenBucket of rate, whose keys have prefix, DefaultPrefix if it is empty
+func NewRedisTokenBucket(client *redis.Client, prefix string, rate Rate) *RedisTokenBucket {
+	if len(prefix) == 0 {
+		prefix = DefaultPrefix
+	}
+	return &RedisTokenBucket{Client: client, Prefix: prefix, rate: rate}
+}
+
+// Allow implements Limiter
+func (l *RedisTokenBucket) Allow(key string) (Result, error) {
+	perMs := float64(time.Millisecond) / float64(l.rate.interval())
+	// an empty bucket is full again after the ttl
+	ttl := time.Duration(l.rate.burst())*l.rate.interval() + time.Second
+
+	reply, err := tokenBucketScript.Run(l.Client, []string{l.Prefix + "tb:" + key},
+		strconv.FormatFloat(perMs, 'f', -1, 64), l.rate.burst(), msOf(time.Now()), int64(ttl/time.Millisecond)).Result()
+	if err != nil {
+		return Result{}, err
+	}
+	values, ok := reply.([]interface{})
+	if !ok || len(values) != 2 {
+		return Result{}, fmt.Errorf("ratelimit: unexpected reply %v", reply)
+	}
+	allowed, _ := values[0].(int64)
+	s, _ := values[1].(string)
+	tokens, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return Result{}, fmt.Errorf("ratelimit: unexpected tokens %v", values[1])
+	}
+	return tokenBucketResult(l.rate, allowed == 1, tokens), nil
+}
+
+// RedisSlidingWindow is a sliding window limiter in redis. The clocks of instances should be in sync.
+type RedisSlidingWindow struct {
+	Client *redis.Client
+	Prefix string
+	rate   Rate
+}
+
+// NewRedisSlidingWindow returns a RedisSlidingWindow of rate, whose keys have prefix, DefaultPrefix if it is empty
+func NewRedisSlidingWindow(client *redis.Client, prefix string, rate Rate) *RedisSlidingWindow {
+	if len(prefix) == 0 {
+		prefix = DefaultPrefix
+	}
+	return &RedisSlidingWindow{Client: client, Prefix: prefix, rate: rate}
+}
+
+// Allow implements Limiter
+func (l *RedisSlidingWindow) Allow(key string) (Result, error) {
+	now := time.Now()
+	start := now.Truncate(l.rate.Period)
+	elapsed := now.Sub(start)
+	index := start.UnixNano() / int64(l.rate.Period)
+	weight := 1 - float64(elapsed)/float64(l.rate.Period)
+
+	keys := []string{
+		fmt.Sprintf("%ssw:%s:%d", l.Prefix, key, index-1),
+		fmt.Sprintf("%ssw:%s:%d", l.Prefix, key, index),
+	}
+	reply, err := slidingWindowScript.Run(l.Client, keys,
+		l.rate.Limit, strconv.FormatFloat(weight, 'f', -1, 64), int64(2*l.rate.Period/time.Millisecond)).Result()
+	if err != nil {
+		return Result{}, err
+	}
+	values, ok := reply.([]interface{})
+	if !ok || len(values) != 2 {
+		return Result{}, fmt.Errorf("ratelimit: unexpected reply %v", reply)
+	}
+	prev, _ := values[0].(int64)
+	cur, _ := values[1].(int64)
+	return slidingWindow(l.rate, elapsed, int(prev), int(cur)), nil
+}
+
+func msOf(t time.Time) int64 {
+	return t.UnixNano() / int64(time.Millisecond)
+}
@@ -7,6 +7,7 @@ import (
 	"log"
 
 	elog "github.com/labstack/gommon/log"
+	"github.com/prometheus/client_golang/prometheus"
 	cfg "github.com/silentred/toolkit/config"
 	"github.com/silentred/toolkit/util"
 	"github.com/silentred/toolkit/util/container"
@@ -30,6 +31,10 @@ const (
 	RouterHook
 	// ShutdownHook is a hook type for shutting down
 	ShutdownHook
+	// StartHook is a hook type for the moment the listener is up
+	StartHook
+	// PreShutdownHook is a hook type for shutting down, before the server stops
+	PreShutdownHook
 )
 
 var (
@@ -65,6 +70,8 @@ type Application interface {
 	DefaultLogger() util.Logger
 	Logger(name string) (util.Logger, error)
 	SetLogger(string, util.Logger)
+	// metrics
+	MetricsRegistry() *prometheus.Registry
 	// init
 	Initialize()
 
@@ -80,11 +87,15 @@ type App struct {
 	//loggers map[string]util.Logger
 	Config *cfg.AppConfig
 
-	configHooks   []HookFunc
-	loggerHooks   []HookFunc
-	serviceHooks  []HookFunc
-	routeHooks    []HookFunc
-	shutdownHooks []HookFunc
+	registry *prometheus.Registry
+
+	configHooks      []HookFunc
+	loggerHooks      []HookFunc
+	serviceHooks     []HookFunc
+	routeHooks       []HookFunc
+	shutdownHooks    []HookFunc
+	startHooks       []HookFunc
+	preShutdownHooks []HookFunc
 }
 
 // NewApp gets a new application
@@ -93,13 +104,17 @@ func NewApp() App {
 		Store:    &container.Map{},
 		Injector: container.NewInjector(),
 		//loggers:  make(map[string]util.Logger),
+		registry: prometheus.NewRegistry(),
 	}
 	// register App itself
 	app.Set("app", app, new(Application))
 	// register default hooks
 	app.RegisterHook(ConfigHook, initConfig)
 	app.RegisterHook(LoggerHook, initLogger)
-	app.RegisterHook(ServiceHook, initMySQL, initRedis)
+	app.RegisterHook(ServiceHook, initOtel, initMySQL, initRedis, initGrpcClients, initHTTPClients)
+	app.RegisterHook(StartHook, serveMetrics, registerService)
+	app.RegisterHook(PreShutdownHook, unregisterService)
+	app.RegisterHook(ShutdownHook, closeGrpcClients, closeHTTPClients, closeMetrics, shutdownOtel)
 
 	return app
 }
@@ -128,6 +143,11 @@ func (app *App) DefaultLogger() util.Logger {
 	return l
 }
 
+// MetricsRegistry returns the registry of the metrics of app
+func (app *App) MetricsRegistry() *prometheus.Registry {
+	return app.registry
+}
+
 // Set object into app.Store and Map it into app.Injector
 func (app *App) Set(key string, object interface{}, ifacePtr interface{}) {
 	app.Store.Set(key, object)
@@ -164,6 +184,10 @@ func (app *App) GetHook(ht HookType) *[]HookFunc {
 		hook = &app.routeHooks
 	case ShutdownHook:
 		hook = &app.shutdownHooks
+	case StartHook:
+		hook = &app.startHooks
+	case PreShutdownHook:
+		hook = &app.preShutdownHooks
 	}
 
 	return hook
@@ -214,6 +238,27 @@ func (app *App) LoadConfig(mode string) *cfg.AppConfig {
 	// redis config
 	redisConfig(&config)
 
+	// discovery config
+	discoveryConfig(&config)
+
+	// grpc client config
+	grpcClientConfig(&config)
+
+	// http client config
+	httpClientConfig(&config)
+
+	// grpc server auth config
+	grpcAuthConfig(&config)
+
+	// jwt config of web requests
+	jwtConfig(&config)
+
+	// ratelimit config
+	rateLimitConfig(&config)
+
+	// otel config
+	otelConfig(&config)
+
 	return &config
 }
 
@@ -222,6 +267,7 @@ func appConfig(c *cfg.AppConfig) {
 	c.Mode = viper.GetString("app.runMode")
 	c.Host = viper.GetString("app.host")
 	c.Port = viper.GetInt("app.port")
+	c.MetricsAddr = viper.GetString("app.metricsAddr")
 }
 
 func loggerConfig(c *cfg.AppConfig) {
@@ -250,6 +296,10 @@ func mysqlConfig(c *cfg.AppConfig) {
 	}
 	mysql.Ping = viper.GetBool("mysql_manager.ping")
 	mysql.InitMySQL = viper.GetBool("mysql_manager.init")
+	mysql.Metrics = viper.GetBool("mysql_manager.metrics")
+	mysql.Trace = viper.GetBool("mysql_manager.trace")
+	mysql.SlowThreshold = viper.GetDuration("mysql_manager.slow_threshold")
+	mysql.RedactArgs = viper.GetBool("mysql_manager.redact_args")
 	c.Mysql = mysql
 }
 
@@ -258,17 +308,88 @@ func redisConfig(c *cfg.AppConfig) {
 		Host: viper.GetString("redis.host"),
 		Port: viper.GetInt("redis.port"),
 		Db:   viper.GetInt("redis.db"),
+		Name: viper.GetString("redis.name"),
 		Pwd:  viper.GetString("redis.password"),
+
+		ReadOnly: viper.GetBool("redis.read_only"),
 	}
 	redisConfig := cfg.RedisConfig{
 		Ping:          viper.GetBool("redis_manager.ping"),
 		InitRedis:     viper.GetBool("redis_manager.init"),
+		Metrics:       viper.GetBool("redis_manager.metrics"),
 		RedisInstance: redis,
 	}
 
 	c.Redis = redisConfig
 }
 
+func discoveryConfig(c *cfg.AppConfig) {
+	c.Discovery = cfg.DiscoveryConfig{
+		Enable:    viper.GetBool("discovery.enable"),
+		Endpoints: viper.GetStringSlice("discovery.endpoints"),
+		Prefix:    viper.GetString("discovery.prefix"),
+		TTL:       viper.GetInt("discovery.ttl"),
+		Name:      viper.GetString("discovery.name"),
+		Host:      viper.GetString("discovery.host"),
+		Version:   viper.GetString("discovery.version"),
+		Zone:      viper.GetString("discovery.zone"),
+		Protocol:  viper.GetString("discovery.protocol"),
+		Weight:    viper.GetInt("discovery.weight"),
+		Tags:      viper.GetStringSlice("discovery.tags"),
+		Metadata:  viper.GetStringMapString("discovery.metadata"),
+		Backend:   viper.GetString("discovery.backend"),
+		File:      viper.GetString("discovery.file"),
+		Domain:    viper.GetString("discovery.domain"),
+		SRV:       viper.GetString("discovery.srv"),
+		DNSPort:   viper.GetInt("discovery.dns_port"),
+		Refresh:   viper.GetDuration("discovery.refresh"),
+	}
+}
+
+func grpcClientConfig(c *cfg.AppConfig) {
+	// decoded by mapstructure, which parses durations
+	if err := viper.UnmarshalKey("grpc_client", &c.GrpcClients); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func httpClientConfig(c *cfg.AppConfig) {
+	if err := viper.UnmarshalKey("http_client", &c.HTTPClients); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func grpcAuthConfig(c *cfg.AppConfig) {
+	if err := viper.UnmarshalKey("grpc_auth", &c.GrpcAuth); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func rateLimitConfig(c *cfg.AppConfig) {
+	if err := viper.UnmarshalKey("ratelimit", &c.RateLimit); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func jwtConfig(c *cfg.AppConfig) {
+	if err := viper.UnmarshalKey("jwt", &c.JWT); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func otelConfig(c *cfg.AppConfig) {
+	c.Otel = cfg.OtelConfig{
+		Enable:      viper.GetBool("otel.enable"),
+		Exporter:    viper.GetString("otel.exporter"),
+		File:        viper.GetString("otel.file"),
+		ServiceName: viper.GetString("otel.service_name"),
+	}
+	if viper.IsSet("otel.sample_ratio") {
+		ratio := viper.GetFloat64("otel.sample_ratio")
+		c.Otel.SampleRatio = &ratio
+	}
+}
+
 func getConfigFile(mode string) string {
 	var configName = "config"
 	if mode != "" {
@@ -277,13 +398,21 @@ func getConfigFile(mode string) string {
 	return configName
 }
 
-// initConfig loads config from toml file and setConfig
+// initConfig loads config from toml file and setConfig, unless config has been set
 func initConfig(app Application) error {
+	if app.GetConfig() != nil {
+		return nil
+	}
 	app.SetConfig(app.LoadConfig(AppMode))
 	return nil
 }
 
+// initLogger sets the default logger, unless it has been set
 func initLogger(app Application) error {
+	if _, err := app.Logger("default"); err == nil {
+		return nil
+	}
+
 	var level elog.Lvl
 	switch app.GetConfig().Mode {
 	case cfg.ModeProd:
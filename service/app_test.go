@@ -0,0 +1,23 @@
+package service
+
+import (
+	"io/ioutil"
+	"testing"
+
+	elog "github.com/labstack/gommon/log"
+	cfg "github.com/silentred/toolkit/config"
+	"github.com/silentred/toolkit/util"
+)
+
+// newTestApp returns an App of config with a discarding logger, without running its hooks
+func newTestApp(t *testing.T, config *cfg.AppConfig) *App {
+	app := NewApp()
+	if len(config.Name) == 0 {
+		config.Name = t.Name()
+	}
+	app.SetConfig(config)
+	logger := util.NewLogger(config.Name, elog.DEBUG, cfg.LogConfig{Providor: cfg.ProvidorStdOut})
+	logger.SetOutput(ioutil.Discard)
+	app.SetLogger("default", logger)
+	return &app
+}
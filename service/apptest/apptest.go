@@ -0,0 +1,177 @@
+// Package apptest builds initialized applications for tests, with in-memory stand-ins
+// for MySQL, Redis and etcd. Every call gets its own databases, so tests are isolated.
+package apptest
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	elog "github.com/labstack/gommon/log"
+	cfg "github.com/silentred/toolkit/config"
+	"github.com/silentred/toolkit/service"
+	"github.com/silentred/toolkit/service/discovery"
+	"github.com/silentred/toolkit/util"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	redis "gopkg.in/redis.v5"
+
+	// sqlite3 stands in for mysql
+	_ "github.com/mattn/go-sqlite3"
+)
+
+const (
+	// DriverSQLite is the driver of the in-memory databases
+	DriverSQLite = "sqlite3"
+)
+
+var dbSeq uint64
+
+// Env holds the in-memory dependencies of a test application
+type Env struct {
+	Config *cfg.AppConfig
+	Redis  *miniredis.Miniredis
+	// Store stands in for etcd, it is set as "etcd.store" in the application
+	Store *discovery.MemoryStore
+	// Spans are the ended spans, if tracing is enabled by WithTracing
+	Spans *tracetest.InMemoryExporter
+}
+
+// Option modifies the config before the application is initialized
+type Option func(*cfg.AppConfig)
+
+// WithConfig returns an Option which calls fn with the config
+func WithConfig(fn func(*cfg.AppConfig)) Option {
+	return Option(fn)
+}
+
+// WithReplicas adds read-only instances sharing the database of master
+func WithReplicas(names ...string) Option {
+	return func(c *cfg.AppConfig) {
+		for _, name := range names {
+			c.Mysql.Instances = append(c.Mysql.Instances, cfg.MysqlInstance{Name: name, ReadOnly: true})
+		}
+	}
+}
+
+// WithTracing enables otel with the in-memory exporter of Env.Spans
+func WithTracing() Option {
+	return func(c *cfg.AppConfig) {
+		c.Otel = cfg.OtelConfig{Enable: true, Exporter: cfg.ExporterMemory}
+	}
+}
+
+// DefaultConfig returns the config used by New: dev mode, stdout logger, one master instance and redis enabled
+func DefaultConfig(name string) *cfg.AppConfig {
+	return &cfg.AppConfig{
+		Name: name,
+		Mode: cfg.ModeDev,
+		Host: "127.0.0.1",
+		Log: cfg.LogConfig{
+			Name:     "default",
+			Providor: cfg.ProvidorStdOut,
+		},
+		Mysql: cfg.MysqlConfig{
+			InitMySQL: true,
+			Ping:      true,
+			Instances: []cfg.MysqlInstance{{Name: "master"}},
+		},
+		Redis: cfg.RedisConfig{
+			InitRedis: true,
+			Ping:      true,
+		},
+	}
+}
+
+// New returns an initialized *service.App and its Env
+func New(t testing.TB, opts ...Option) (*service.App, *Env) {
+	app := service.NewApp()
+	env := Initialize(t, &app, opts...)
+	return &app, env
+}
+
+// Initialize starts the in-memory dependencies, points the config of app at them and
+// initializes app. Instances without Driver share one in-memory sqlite database.
+// Everything is released when the test finishes.
+func Initialize(t testing.TB, app service.Application, opts ...Option) *Env {
+	t.Helper()
+
+	config := DefaultConfig(appName(t))
+	for _, opt := range opts {
+		opt(config)
+	}
+
+	env := &Env{
+		Config: config,
+		Store:  discovery.NewMemoryStore(),
+	}
+
+	// sqlite database shared by all the instances of this test only
+	dsn := fmt.Sprintf("file:apptest_%d?mode=memory&cache=shared", atomic.AddUint64(&dbSeq, 1))
+	for i, instance := range config.Mysql.Instances {
+		if len(instance.Driver) == 0 {
+			config.Mysql.Instances[i].Driver = DriverSQLite
+			config.Mysql.Instances[i].Db = dsn
+		}
+	}
+
+	if config.Redis.InitRedis {
+		mr, err := miniredis.Run()
+		if err != nil {
+			t.Fatalf("apptest: starting redis: %v", err)
+		}
+		t.Cleanup(mr.Close)
+		env.Redis = mr
+		config.Redis.Host = "127.0.0.1"
+		config.Redis.Port = portOf(mr.Addr())
+	}
+
+	logger := util.NewLogger(config.Name, elog.DEBUG, config.Log)
+	logger.SetOutput(testWriter{t})
+
+	app.SetConfig(config)
+	app.SetLogger("default", logger)
+	app.Set("etcd.store", env.Store, new(discovery.Store))
+	app.Initialize()
+	env.Spans, _ = app.Get("otel.exporter").(*tracetest.InMemoryExporter)
+
+	t.Cleanup(func() {
+		if mm, ok := app.Get("mysql").(*service.MysqlManager); ok {
+			mm.Close()
+		}
+		if cli, ok := app.Get("redis").(*redis.Client); ok {
+			cli.Close()
+		}
+		if gm, ok := app.Get("grpc.client").(*service.GrpcClientManager); ok {
+			gm.Close()
+		}
+		if provider, ok := app.Get("otel.provider").(*sdktrace.TracerProvider); ok {
+			provider.Shutdown(context.Background())
+		}
+	})
+
+	return env
+}
+
+func appName(t testing.TB) string {
+	return strings.Replace(t.Name(), "/", "_", -1)
+}
+
+func portOf(addr string) int {
+	var port int
+	fmt.Sscanf(addr[strings.LastIndex(addr, ":")+1:], "%d", &port)
+	return port
+}
+
+// testWriter writes log lines to testing.TB
+type testWriter struct {
+	t testing.TB
+}
+
+func (w testWriter) Write(p []byte) (int, error) {
+	w.t.Log(strings.TrimRight(string(p), "\n"))
+	return len(p), nil
+}
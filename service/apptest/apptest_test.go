@@ -0,0 +1,97 @@
+package apptest
+
+import (
+	"testing"
+
+	"github.com/silentred/toolkit/service"
+	"github.com/silentred/toolkit/service/discovery"
+	"github.com/stretchr/testify/assert"
+	redis "gopkg.in/redis.v5"
+)
+
+type user struct {
+	ID   int64
+	Name string
+}
+
+func TestInitialize(t *testing.T) {
+	app, env := New(t, WithReplicas("slave-01"))
+	assert.Equal(t, "TestInitialize", app.GetConfig().Name)
+
+	mm, ok := app.Get("mysql").(*service.MysqlManager)
+	if assert.True(t, ok) {
+		assert.NoError(t, mm.W().Sync2(new(user)))
+		_, err := mm.W().Insert(&user{Name: "jason"})
+		assert.NoError(t, err)
+
+		var u user
+		has, err := mm.R().Where("name = ?", "jason").Get(&u)
+		assert.NoError(t, err)
+		assert.True(t, has)
+	}
+
+	cli, ok := app.Get("redis").(*redis.Client)
+	if assert.True(t, ok) {
+		assert.NoError(t, cli.Set("foo", "bar", 0).Err())
+		val, err := env.Redis.Get("foo")
+		assert.NoError(t, err)
+		assert.Equal(t, "bar", val)
+	}
+}
+
+func TestIsolation(t *testing.T) {
+	for _, name := range []string{"first", "second"} {
+		t.Run(name, func(t *testing.T) {
+			app, env := New(t)
+			mm := app.Get("mysql").(*service.MysqlManager)
+
+			assert.NoError(t, mm.W().Sync2(new(user)))
+			count, err := mm.W().Count(new(user))
+			assert.NoError(t, err)
+			assert.EqualValues(t, 0, count)
+			_, err = mm.W().Insert(&user{Name: name})
+			assert.NoError(t, err)
+
+			assert.False(t, env.Redis.Exists("foo"))
+			env.Redis.Set("foo", name)
+		})
+	}
+}
+
+func TestPublisher(t *testing.T) {
+	app, env := New(t)
+	p := discovery.NewEtcdPublisherWithStore(env.Store, "", 10)
+	assert.NoError(t, app.Inject(p))
+
+	s := discovery.NewService("hello", "127.0.0.1", 8080)
+	assert.NoError(t, p.Register(s))
+	assert.EqualValues(t, 1, s.ID)
+
+	watcher, err := discovery.NewResolverWithStore("hello", "", env.Store).Resolve("")
+	if assert.NoError(t, err) {
+		defer watcher.Close()
+		updates, err := watcher.Next()
+		assert.NoError(t, err)
+		if assert.Len(t, updates, 1) {
+			assert.Equal(t, "127.0.0.1:8080", updates[0].Addr)
+		}
+
+		assert.NoError(t, p.Unregister(s))
+		updates, err = watcher.Next()
+		assert.NoError(t, err)
+		if assert.Len(t, updates, 1) {
+			assert.Equal(t, discovery.AddrDelete, updates[0].Op)
+		}
+	}
+}
+
+func TestWithTracing(t *testing.T) {
+	app, env := New(t, WithTracing())
+	if !assert.NotNil(t, env.Spans) {
+		return
+	}
+	mm := app.Get("mysql").(*service.MysqlManager)
+	env.Spans.Reset()
+	assert.NoError(t, mm.W().Sync2(new(user)))
+	assert.NotEmpty(t, env.Spans.GetSpans())
+}
@@ -0,0 +1,42 @@
+package service
+
+import (
+	"github.com/silentred/toolkit/breaker"
+	cfg "github.com/silentred/toolkit/config"
+)
+
+// NewBreakers returns a group of circuit breakers of config, whose state changes are logged and
+// recorded in the metrics of app. Breakers are named by name and the target, as "{name}/{target}".
+func NewBreakers(app Application, name string, config cfg.BreakerConfig) (*breaker.Group, error) {
+	metrics, err := breakerMetrics(app)
+	if err != nil {
+		return nil, err
+	}
+	logger := app.DefaultLogger()
+
+	return breaker.NewGroup(breaker.Settings{
+		FailureRatio:     config.FailureRatio,
+		MinRequests:      config.MinRequests,
+		Window:           config.Window,
+		CoolDown:         config.CoolDown,
+		HalfOpenRequests: config.HalfOpenRequests,
+		OnStateChange: func(target string, from, to breaker.State) {
+			target = name + "/" + target
+			logger.Warnf("circuit breaker %s changes from %s to %s", target, from, to)
+			metrics.OnStateChange(target, from, to)
+		},
+	}), nil
+}
+
+// breakerMetrics returns the metrics shared by the breakers of app
+func breakerMetrics(app Application) (*breaker.Metrics, error) {
+	if m, ok := app.Get("breaker.metrics").(*breaker.Metrics); ok {
+		return m, nil
+	}
+	m := breaker.NewMetrics()
+	if err := registerCollector(app, m); err != nil {
+		return nil, err
+	}
+	app.Set("breaker.metrics", m, nil)
+	return m, nil
+}
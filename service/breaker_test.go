@@ -0,0 +1,47 @@
+package service
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/silentred/toolkit/breaker"
+	cfg "github.com/silentred/toolkit/config"
+	"github.com/silentred/toolkit/util"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHTTPBreaker(t *testing.T) {
+	app := newTestApp(t, &cfg.AppConfig{})
+	breakers, err := NewBreakers(app, "http", cfg.BreakerConfig{MinRequests: 2, CoolDown: time.Hour})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	var calls int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	hc := util.NewHTTPClient(5, &http.Client{}, util.WithBreakers(breakers))
+	for i := 0; i < 2; i++ {
+		req, _ := util.NewHTTPReqeust(http.MethodGet, server.URL, nil, nil, nil)
+		_, code, err := hc.Do(req)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusServiceUnavailable, code)
+	}
+
+	// the circuit of the host is open
+	req, _ := util.NewHTTPReqeust(http.MethodGet, server.URL, nil, nil, nil)
+	_, _, err = hc.Do(req)
+	assert.True(t, errors.Is(err, breaker.ErrOpen))
+	assert.Equal(t, 2, calls)
+
+	host := strings.TrimPrefix(server.URL, "http://")
+	assert.Contains(t, metricsText(app), `circuit_breaker_state{name="http/`+host+`"} 2`)
+}
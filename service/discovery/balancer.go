@@ -0,0 +1,248 @@
+package discovery
+
+import (
+	"context"
+	"hash/crc32"
+	"math/rand"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+
+	"google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/balancer/base"
+)
+
+// Names of the balancers, to be used as the loadBalancingPolicy in service config, as in
+// grpc.WithDefaultServiceConfig(`{"loadBalancingPolicy":"weighted_round_robin"}`).
+// They use the instances resolved by the builders of this package.
+const (
+	WeightedRoundRobin = "weighted_round_robin"
+	LeastPending       = "least_pending"
+	ConsistentHash     = "consistent_hash"
+	ZoneAware          = "zone_aware"
+)
+
+var (
+	// HashReplicas is the number of points of one weight of an instance on the hash ring
+	HashReplicas = 64
+)
+
+func init() {
+	balancer.Register(newBalancerBuilder(WeightedRoundRobin, func(scs []subConn) balancer.Picker {
+		return newWRRPicker(scs)
+	}))
+	balancer.Register(newBalancerBuilder(LeastPending, func(scs []subConn) balancer.Picker {
+		return newLeastPendingPicker(scs)
+	}))
+	balancer.Register(newBalancerBuilder(ConsistentHash, func(scs []subConn) balancer.Picker {
+		return newHashPicker(scs)
+	}))
+	balancer.Register(newBalancerBuilder(ZoneAware, newClientZonePicker))
+}
+
+// newClientZonePicker prefers the zone of the client, which is set in the builder of each
+// connection and carried by the addresses
+func newClientZonePicker(scs []subConn) balancer.Picker {
+	return newZonePicker(scs[0].zone, scs)
+}
+
+// newZonePicker prefers the instances in zone. Requests are balanced by weighted round-robin among
+// the ready instances in zone, or among all the ready instances if there is none in zone.
+func newZonePicker(zone string, scs []subConn) *wrrPicker {
+	var local []subConn
+	for _, sc := range scs {
+		if sc.service.Zone == zone {
+			local = append(local, sc)
+		}
+	}
+	if len(zone) == 0 || len(local) == 0 {
+		return newWRRPicker(scs)
+	}
+	return newWRRPicker(local)
+}
+
+type hashKey struct{}
+
+// WithHashKey returns a context whose requests are balanced by key, when the consistent_hash
+// balancer is used. Requests of the same key go to the same instance while the instances do not change.
+func WithHashKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, hashKey{}, key)
+}
+
+// HashKeyFromContext returns the key set by WithHashKey
+func HashKeyFromContext(ctx context.Context) (string, bool) {
+	key, ok := ctx.Value(hashKey{}).(string)
+	return key, ok
+}
+
+// subConn is a ready SubConn and the instance it connects to
+type subConn struct {
+	sc      balancer.SubConn
+	addr    string
+	service *Service
+	// zone of the client
+	zone string
+}
+
+type pickerBuilder struct {
+	build func([]subConn) balancer.Picker
+}
+
+func newBalancerBuilder(name string, build func([]subConn) balancer.Picker) balancer.Builder {
+	return base.NewBalancerBuilder(name, &pickerBuilder{build: build}, base.Config{HealthCheck: true})
+}
+
+// Build implements base.PickerBuilder
+func (pb *pickerBuilder) Build(info base.PickerBuildInfo) balancer.Picker {
+	if len(info.ReadySCs) == 0 {
+		return base.NewErrPicker(balancer.ErrNoSubConnAvailable)
+	}
+
+	scs := make([]subConn, 0, len(info.ReadySCs))
+	for sc, sci := range info.ReadySCs {
+		srv, ok := ServiceFromAddress(sci.Address)
+		if !ok {
+			// addresses of other resolvers have the default weight and no zone
+			srv = &Service{}
+		}
+		scs = append(scs, subConn{sc: sc, addr: sci.Address.Addr, service: srv, zone: clientZone(sci.Address)})
+	}
+	sort.Slice(scs, func(i, j int) bool { return scs[i].addr < scs[j].addr })
+
+	return pb.build(scs)
+}
+
+// wrrPicker is the smooth weighted round-robin of nginx, which spreads the picks of heavy
+// instances among the others
+type wrrPicker struct {
+	mu      sync.Mutex
+	scs     []subConn
+	weights []int
+	current []int
+	total   int
+}
+
+func newWRRPicker(scs []subConn) *wrrPicker {
+	p := &wrrPicker{
+		scs:     scs,
+		weights: make([]int, len(scs)),
+		current: make([]int, len(scs)),
+	}
+	for i, sc := range scs {
+		p.weights[i] = sc.service.GetWeight()
+		p.total += p.weights[i]
+	}
+	// start at a random point of the cycle, as the picker is built again when instances change
+	for n := rand.Intn(p.total); n > 0; n-- {
+		p.next()
+	}
+	return p
+}
+
+// Pick implements balancer.Picker
+func (p *wrrPicker) Pick(balancer.PickInfo) (balancer.PickResult, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return balancer.PickResult{SubConn: p.scs[p.next()].sc}, nil
+}
+
+func (p *wrrPicker) next() int {
+	best := 0
+	for i := range p.current {
+		p.current[i] += p.weights[i]
+		if p.current[i] > p.current[best] {
+			best = i
+		}
+	}
+	p.current[best] -= p.total
+	return best
+}
+
+// leastPendingPicker picks the instance with the fewest requests in flight, dividing by weight.
+// Counts start from zero whenever the picker is built again.
+type leastPendingPicker struct {
+	scs     []subConn
+	pending []int64
+	next    uint32
+}
+
+func newLeastPendingPicker(scs []subConn) *leastPendingPicker {
+	return &leastPendingPicker{
+		scs:     scs,
+		pending: make([]int64, len(scs)),
+		next:    uint32(rand.Intn(len(scs))),
+	}
+}
+
+// Pick implements balancer.Picker
+func (p *leastPendingPicker) Pick(balancer.PickInfo) (balancer.PickResult, error) {
+	n := len(p.scs)
+	// start from a rotating index, so that ties are broken by round-robin
+	start := int(atomic.AddUint32(&p.next, 1) % uint32(n))
+
+	best := start
+	for k := 1; k < n; k++ {
+		i := (start + k) % n
+		// pending[i]/weight[i] < pending[best]/weight[best]
+		if atomic.LoadInt64(&p.pending[i])*int64(p.scs[best].service.GetWeight()) <
+			atomic.LoadInt64(&p.pending[best])*int64(p.scs[i].service.GetWeight()) {
+			best = i
+		}
+	}
+
+	atomic.AddInt64(&p.pending[best], 1)
+	return balancer.PickResult{
+		SubConn: p.scs[best].sc,
+		Done: func(balancer.DoneInfo) {
+			atomic.AddInt64(&p.pending[best], -1)
+		},
+	}, nil
+}
+
+// hashPicker picks by the key of WithHashKey on a ring of instances, in which every instance
+// has HashReplicas points per weight. Requests without key are balanced by weighted round-robin.
+type hashPicker struct {
+	scs    []subConn
+	points []uint32
+	owners map[uint32]int
+	wrr    *wrrPicker
+}
+
+func newHashPicker(scs []subConn) *hashPicker {
+	p := &hashPicker{
+		scs:    scs,
+		owners: make(map[uint32]int),
+		wrr:    newWRRPicker(scs),
+	}
+	for i, sc := range scs {
+		for r := 0; r < HashReplicas*sc.service.GetWeight(); r++ {
+			point := crc32.ChecksumIEEE([]byte(sc.addr + "#" + strconv.Itoa(r)))
+			if _, ok := p.owners[point]; ok {
+				continue
+			}
+			p.owners[point] = i
+			p.points = append(p.points, point)
+		}
+	}
+	sort.Slice(p.points, func(i, j int) bool { return p.points[i] < p.points[j] })
+	return p
+}
+
+// Pick implements balancer.Picker
+func (p *hashPicker) Pick(info balancer.PickInfo) (balancer.PickResult, error) {
+	if info.Ctx == nil {
+		return p.wrr.Pick(info)
+	}
+	key, ok := HashKeyFromContext(info.Ctx)
+	if !ok {
+		return p.wrr.Pick(info)
+	}
+
+	h := crc32.ChecksumIEEE([]byte(key))
+	idx := sort.Search(len(p.points), func(i int) bool { return p.points[i] >= h })
+	if idx == len(p.points) {
+		idx = 0
+	}
+	return balancer.PickResult{SubConn: p.scs[p.owners[p.points[idx]]].sc}, nil
+}
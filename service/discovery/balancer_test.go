@@ -0,0 +1,191 @@
+package discovery
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/attributes"
+	"google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/balancer/base"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/resolver"
+)
+
+type fakeSubConn struct {
+	balancer.SubConn
+	addr string
+}
+
+func newSubConns(services ...*Service) []subConn {
+	scs := make([]subConn, 0, len(services))
+	for _, srv := range services {
+		scs = append(scs, subConn{sc: &fakeSubConn{addr: srv.Addr()}, addr: srv.Addr(), service: srv})
+	}
+	return scs
+}
+
+func weighted(port, weight int, zone string) *Service {
+	srv := NewService("hello", "127.0.0.1", port)
+	srv.Weight = weight
+	srv.Zone = zone
+	return srv
+}
+
+func pickCounts(t *testing.T, p balancer.Picker, n int, info balancer.PickInfo) map[string]int {
+	counts := make(map[string]int)
+	for i := 0; i < n; i++ {
+		res, err := p.Pick(info)
+		if !assert.NoError(t, err) {
+			break
+		}
+		counts[res.SubConn.(*fakeSubConn).addr]++
+	}
+	return counts
+}
+
+func TestWeightedRoundRobin(t *testing.T) {
+	p := newWRRPicker(newSubConns(weighted(8080, 1, ""), weighted(8081, 2, ""), weighted(8082, 0, "")))
+	counts := pickCounts(t, p, 400, balancer.PickInfo{})
+	assert.Equal(t, 100, counts["127.0.0.1:8080"])
+	assert.Equal(t, 200, counts["127.0.0.1:8081"])
+	assert.Equal(t, 100, counts["127.0.0.1:8082"])
+}
+
+func TestLeastPending(t *testing.T) {
+	p := newLeastPendingPicker(newSubConns(weighted(8080, 1, ""), weighted(8081, 1, ""), weighted(8082, 1, "")))
+
+	var results []balancer.PickResult
+	picked := make(map[string]bool)
+	for i := 0; i < 3; i++ {
+		res, err := p.Pick(balancer.PickInfo{})
+		assert.NoError(t, err)
+		results = append(results, res)
+		picked[res.SubConn.(*fakeSubConn).addr] = true
+	}
+	assert.Len(t, picked, 3)
+
+	// the instance finishing its request has the fewest pending
+	results[1].Done(balancer.DoneInfo{})
+	for i := 0; i < 2; i++ {
+		res, err := p.Pick(balancer.PickInfo{})
+		assert.NoError(t, err)
+		assert.Equal(t, results[1].SubConn, res.SubConn)
+		res.Done(balancer.DoneInfo{})
+	}
+}
+
+func TestConsistentHash(t *testing.T) {
+	services := []*Service{weighted(8080, 1, ""), weighted(8081, 1, ""), weighted(8082, 1, "")}
+	p := newHashPicker(newSubConns(services...))
+	smaller := newHashPicker(newSubConns(services[:2]...))
+
+	owners := make(map[string]string)
+	moved := 0
+	for i := 0; i < 300; i++ {
+		info := balancer.PickInfo{Ctx: WithHashKey(context.Background(), fmt.Sprintf("user-%d", i))}
+		counts := pickCounts(t, p, 3, info)
+		if !assert.Len(t, counts, 1) {
+			break
+		}
+		for addr := range counts {
+			owners[addr] = addr
+			res, _ := smaller.Pick(info)
+			if addr != "127.0.0.1:8082" && res.SubConn.(*fakeSubConn).addr != addr {
+				moved++
+			}
+		}
+	}
+	// keys spread over all the instances, and only keys of the removed instance move
+	assert.Len(t, owners, 3)
+	assert.Equal(t, 0, moved)
+
+	// requests without key are balanced
+	counts := pickCounts(t, p, 30, balancer.PickInfo{Ctx: context.Background()})
+	assert.Len(t, counts, 3)
+}
+
+func TestZoneAware(t *testing.T) {
+	scs := newSubConns(weighted(8080, 1, "bj"), weighted(8081, 1, "sh"), weighted(8082, 1, "bj"))
+
+	counts := pickCounts(t, newZonePicker("bj", scs), 10, balancer.PickInfo{})
+	assert.Equal(t, map[string]int{"127.0.0.1:8080": 5, "127.0.0.1:8082": 5}, counts)
+
+	// fall back to all the instances
+	counts = pickCounts(t, newZonePicker("gz", scs), 9, balancer.PickInfo{})
+	assert.Len(t, counts, 3)
+}
+
+func TestClientZone(t *testing.T) {
+	// the zone of the client is carried by the addresses, so connections of different zones coexist
+	build := func(zone string) balancer.Picker {
+		info := base.PickerBuildInfo{ReadySCs: make(map[balancer.SubConn]base.SubConnInfo)}
+		for _, srv := range []*Service{weighted(8080, 1, "bj"), weighted(8081, 1, "sh")} {
+			addr := resolver.Address{Addr: srv.Addr(), Attributes: attributes.New(serviceKey{}, srv, zoneKey{}, zone)}
+			info.ReadySCs[&fakeSubConn{addr: srv.Addr()}] = base.SubConnInfo{Address: addr}
+		}
+		return (&pickerBuilder{build: newClientZonePicker}).Build(info)
+	}
+	assert.Equal(t, map[string]int{"127.0.0.1:8080": 4}, pickCounts(t, build("bj"), 4, balancer.PickInfo{}))
+	assert.Equal(t, map[string]int{"127.0.0.1:8081": 4}, pickCounts(t, build("sh"), 4, balancer.PickInfo{}))
+}
+
+func TestDialWeightedRoundRobin(t *testing.T) {
+	store := NewMemoryStore()
+	p := NewEtcdPublisherWithStore(store, "", 10)
+
+	for _, weight := range []int{1, 3} {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		if !assert.NoError(t, err) {
+			return
+		}
+		s := grpc.NewServer()
+		healthpb.RegisterHealthServer(s, health.NewServer())
+		go s.Serve(l)
+		defer s.Stop()
+
+		srv := NewService("weighted", "127.0.0.1", l.Addr().(*net.TCPAddr).Port)
+		srv.Weight = weight
+		assert.NoError(t, p.Register(srv))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	resolver.Register(NewSourceBuilder("weighted", NewStoreSource(store, "")))
+	conn, err := grpc.DialContext(ctx, "weighted:///weighted", grpc.WithInsecure(), grpc.WithBlock(),
+		grpc.WithDefaultServiceConfig(`{"loadBalancingPolicy":"weighted_round_robin"}`))
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer conn.Close()
+
+	// wait until both instances are ready
+	client := healthpb.NewHealthClient(conn)
+	counts := make(map[string]int)
+	for i := 0; i < 100 && len(counts) < 2; i++ {
+		var pr peer.Peer
+		client.Check(ctx, &healthpb.HealthCheckRequest{}, grpc.Peer(&pr))
+		counts[pr.Addr.String()]++
+	}
+
+	counts = make(map[string]int)
+	for i := 0; i < 40; i++ {
+		var pr peer.Peer
+		_, err := client.Check(ctx, &healthpb.HealthCheckRequest{}, grpc.Peer(&pr))
+		if !assert.NoError(t, err) {
+			return
+		}
+		counts[pr.Addr.String()]++
+	}
+	var values []int
+	for _, c := range counts {
+		values = append(values, c)
+	}
+	assert.ElementsMatch(t, []int{10, 30}, values)
+}
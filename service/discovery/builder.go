@@ -0,0 +1,199 @@
+package discovery
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc/resolver"
+)
+
+const (
+	// Scheme of the resolver.Builder, clients dial "etcd:///{ServiceName}"
+	Scheme = "etcd"
+)
+
+var _ resolver.Builder = &EtcdBuilder{}
+
+type (
+	serviceKey struct{}
+	zoneKey    struct{}
+)
+
+// ServiceFromAddress returns the registered Service carried by the attributes of addr
+func ServiceFromAddress(addr resolver.Address) (*Service, bool) {
+	if addr.Attributes == nil {
+		return nil, false
+	}
+	srv, ok := addr.Attributes.Value(serviceKey{}).(*Service)
+	return srv, ok
+}
+
+// clientZone returns the zone of the client carried by the attributes of addr
+func clientZone(addr resolver.Address) string {
+	if addr.Attributes == nil {
+		return ""
+	}
+	zone, _ := addr.Attributes.Value(zoneKey{}).(string)
+	return zone
+}
+
+// EtcdBuilder is the implementation of grpc resolver.Builder for Scheme.
+// The endpoint of target is the service name, followed by an optional query of conditions
+// parsed by ParseFilter, as in "etcd:///hello?version=v2&zone=bj". If Store is nil, the authority
+// of target is used as the comma-separated etcd endpoints, as in "etcd://127.0.0.1:2379/hello".
+type EtcdBuilder struct {
+	Prefix string
+	Store  Store
+	// Filter is applied to the instances of every target
+	Filter Filter
+	// Zone of the client, preferred by the zone_aware balancer
+	Zone string
+}
+
+// NewBuilder returns EtcdBuilder resolving services registered at store under prefix
+func NewBuilder(store Store, prefix string) *EtcdBuilder {
+	if len(prefix) == 0 {
+		prefix = DefaultPrefix
+	}
+	return &EtcdBuilder{Prefix: prefix, Store: store}
+}
+
+// RegisterBuilder registers the builder of store globally. It should be called at initialization,
+// before grpc.Dial("etcd:///{ServiceName}").
+func RegisterBuilder(store Store, prefix string) {
+	resolver.Register(NewBuilder(store, prefix))
+}
+
+// Scheme implements resolver.Builder
+func (b *EtcdBuilder) Scheme() string {
+	return Scheme
+}
+
+// Build implements resolver.Builder
+func (b *EtcdBuilder) Build(target resolver.Target, cc resolver.ClientConn, opts resolver.BuildOptions) (resolver.Resolver, error) {
+	srvName, filter, err := parseEndpoint(target.Endpoint)
+	if err != nil {
+		return nil, err
+	}
+	if len(srvName) == 0 {
+		return nil, fmt.Errorf("discovery: no service name in target %+v", target)
+	}
+
+	store, owned := b.Store, false
+	if store == nil {
+		if len(target.Authority) == 0 {
+			return nil, fmt.Errorf("discovery: no store or etcd endpoints for target %+v", target)
+		}
+		etcdStore, err := NewEtcdStore(strings.Split(target.Authority, ","))
+		if err != nil {
+			return nil, err
+		}
+		store, owned = etcdStore, true
+	}
+
+	var onClose func()
+	if owned {
+		onClose = func() { store.Close() }
+	}
+	return startResolver(cc, NewStoreSource(store, b.Prefix), srvName, And(b.Filter, filter), b.Zone, onClose), nil
+}
+
+// StoreSource is the Source of services registered at Store by EtcdPublisher
+type StoreSource struct {
+	Store  Store
+	Prefix string
+}
+
+// NewStoreSource returns StoreSource of the services registered at store under prefix
+func NewStoreSource(store Store, prefix string) *StoreSource {
+	if len(prefix) == 0 {
+		prefix = DefaultPrefix
+	}
+	return &StoreSource{Store: store, Prefix: prefix}
+}
+
+// Watch implements Source. It lists the instances, then watches the changes, and lists again
+// after RetryInterval if watching fails.
+func (ss *StoreSource) Watch(ctx context.Context, name string) <-chan Update {
+	out := make(chan Update)
+	dir := getDir(ss.Prefix, name)
+
+	go func() {
+		defer close(out)
+		send := func(u Update) bool {
+			select {
+			case out <- u:
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		}
+		wait := func() bool {
+			select {
+			case <-time.After(RetryInterval):
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		}
+
+		for ctx.Err() == nil {
+			kvs, rev, err := ss.Store.List(ctx, dir)
+			if err != nil {
+				if !send(Update{Err: err}) || !wait() {
+					return
+				}
+				continue
+			}
+
+			services := make(map[string]*Service)
+			for _, kv := range kvs {
+				if srv, ok := parseService(kv); ok {
+					services[kv.Key] = srv
+				}
+			}
+			if !send(Update{Services: serviceList(services)}) {
+				return
+			}
+
+			// watch until it fails, then list again
+			wctx, wcancel := context.WithCancel(ctx)
+			for resp := range ss.Store.Watch(wctx, dir, rev+1) {
+				if resp.Err != nil {
+					send(Update{Err: resp.Err})
+					break
+				}
+				for _, ev := range resp.Events {
+					switch ev.Type {
+					case EventPut:
+						if srv, ok := parseService(ev.KeyValue); ok {
+							services[ev.Key] = srv
+						}
+					case EventDelete:
+						delete(services, ev.Key)
+					}
+				}
+				if !send(Update{Services: serviceList(services)}) {
+					break
+				}
+			}
+			wcancel()
+			if ctx.Err() == nil && !wait() {
+				return
+			}
+		}
+	}()
+
+	return out
+}
+
+func serviceList(services map[string]*Service) []*Service {
+	list := make([]*Service, 0, len(services))
+	for _, srv := range services {
+		list = append(list, srv)
+	}
+	sortServices(list)
+	return list
+}
@@ -0,0 +1,123 @@
+package discovery
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/resolver"
+)
+
+type fakeClientConn struct {
+	resolver.ClientConn
+	states chan resolver.State
+}
+
+func (cc *fakeClientConn) UpdateState(s resolver.State) error {
+	cc.states <- s
+	return nil
+}
+
+func (cc *fakeClientConn) ReportError(err error) {}
+
+func TestEtcdBuilder(t *testing.T) {
+	store := NewMemoryStore()
+	ctx := context.Background()
+	store.Put(ctx, getDir(DefaultPrefix, "hello")+"1", NewService("hello", "127.0.0.1", 8080).String(), NoLease)
+
+	cc := &fakeClientConn{states: make(chan resolver.State, 1)}
+	b := NewBuilder(store, "")
+	b.Zone = "bj"
+	r, err := b.Build(resolver.Target{Scheme: Scheme, Endpoint: "hello"}, cc, resolver.BuildOptions{})
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer r.Close()
+
+	state := <-cc.states
+	var first resolver.Address
+	if assert.Len(t, state.Addresses, 1) {
+		first = state.Addresses[0]
+		assert.Equal(t, "127.0.0.1:8080", first.Addr)
+		srv, ok := ServiceFromAddress(first)
+		assert.True(t, ok)
+		assert.Equal(t, "hello", srv.Name)
+		assert.Equal(t, "bj", clientZone(first))
+	}
+
+	store.Put(ctx, getDir(DefaultPrefix, "hello")+"2", NewService("hello", "127.0.0.1", 8081).String(), NoLease)
+	state = <-cc.states
+	if assert.Len(t, state.Addresses, 2) {
+		// unchanged instances keep the same address, so that balancers keep their connections
+		assert.True(t, first == state.Addresses[0])
+	}
+
+	store.Delete(ctx, getDir(DefaultPrefix, "hello")+"1")
+	state = <-cc.states
+	if assert.Len(t, state.Addresses, 1) {
+		assert.Equal(t, "127.0.0.1:8081", state.Addresses[0].Addr)
+	}
+}
+
+func TestDialEtcdScheme(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if !assert.NoError(t, err) {
+		return
+	}
+	s := grpc.NewServer()
+	healthpb.RegisterHealthServer(s, health.NewServer())
+	go s.Serve(l)
+	defer s.Stop()
+
+	store := NewMemoryStore()
+	srv := NewService("health", "127.0.0.1", l.Addr().(*net.TCPAddr).Port)
+	p := NewEtcdPublisherWithStore(store, "", 10)
+	assert.NoError(t, p.Register(srv))
+
+	RegisterBuilder(store, "")
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	conn, err := grpc.DialContext(ctx, Scheme+":///health", grpc.WithInsecure(), grpc.WithBlock(),
+		grpc.WithDefaultServiceConfig(`{"loadBalancingPolicy":"round_robin"}`))
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer conn.Close()
+
+	resp, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{})
+	if assert.NoError(t, err) {
+		assert.Equal(t, healthpb.HealthCheckResponse_SERVING, resp.Status)
+	}
+}
+
+func TestEtcdBuilderFilter(t *testing.T) {
+	store := NewMemoryStore()
+	ctx := context.Background()
+	v1 := NewService("hello", "127.0.0.1", 8080)
+	v1.Version, v1.Zone = "v1", "bj"
+	v2 := NewService("hello", "127.0.0.1", 8081)
+	v2.Version, v2.Zone, v2.Weight, v2.Tags = "v2", "sh", 10, []string{"canary"}
+	store.Put(ctx, getDir(DefaultPrefix, "hello")+"1", v1.String(), NoLease)
+	store.Put(ctx, getDir(DefaultPrefix, "hello")+"2", v2.String(), NoLease)
+
+	cc := &fakeClientConn{states: make(chan resolver.State, 1)}
+	r, err := NewBuilder(store, "").Build(resolver.Target{Scheme: Scheme, Endpoint: "hello?version=v2&tag=canary"}, cc, resolver.BuildOptions{})
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer r.Close()
+
+	state := <-cc.states
+	if assert.Len(t, state.Addresses, 1) {
+		srv, ok := ServiceFromAddress(state.Addresses[0])
+		if assert.True(t, ok) {
+			assert.Equal(t, "sh", srv.Zone)
+			assert.Equal(t, 10, srv.GetWeight())
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package discovery
+
+import (
+	"fmt"
+
+	cfg "github.com/silentred/toolkit/config"
+	"google.golang.org/grpc/resolver"
+)
+
+const (
+	// FileScheme is the scheme of the resolver.Builder of file backend, as in "file:///{ServiceName}"
+	FileScheme = "file"
+	// DNSScheme is the scheme of the resolver.Builder of dns backend, as in "dnssrv:///{ServiceName}".
+	// It differs from "dns" of grpc, which looks up A records only.
+	DNSScheme = "dnssrv"
+)
+
+// NewPublisherFromConfig returns the Publisher of the backend selected by config.
+// store is used by etcd backend, it is dialed at config.Endpoints if nil. The publisher of dns
+// backend publishes nothing but a warning.
+func NewPublisherFromConfig(config cfg.DiscoveryConfig, store Store) (Publisher, error) {
+	switch config.BackendName() {
+	case cfg.BackendEtcd:
+		if store == nil {
+			etcdStore, err := NewEtcdStore(config.Endpoints)
+			if err != nil {
+				return nil, err
+			}
+			store = etcdStore
+		}
+		return NewEtcdPublisherWithStore(store, config.Prefix, config.TTL), nil
+	case cfg.BackendFile:
+		if len(config.File) == 0 {
+			return nil, fmt.Errorf("discovery: no file for file backend")
+		}
+		return NewFilePublisher(config.File), nil
+	case cfg.BackendDNS:
+		return &StaticPublisher{}, nil
+	}
+	return nil, fmt.Errorf("discovery: unknown backend %q", config.Backend)
+}
+
+// NewBuilderFromConfig returns the resolver.Builder of the backend selected by config.
+// store is used by etcd backend, it is dialed at config.Endpoints if nil.
+func NewBuilderFromConfig(config cfg.DiscoveryConfig, store Store) (resolver.Builder, error) {
+	switch config.BackendName() {
+	case cfg.BackendEtcd:
+		if store == nil {
+			etcdStore, err := NewEtcdStore(config.Endpoints)
+			if err != nil {
+				return nil, err
+			}
+			store = etcdStore
+		}
+		b := NewBuilder(store, config.Prefix)
+		b.Zone = config.Zone
+		return b, nil
+	case cfg.BackendFile:
+		if len(config.File) == 0 {
+			return nil, fmt.Errorf("discovery: no file for file backend")
+		}
+		b := NewSourceBuilder(FileScheme, NewFileSource(config.File, config.Refresh))
+		b.Zone = config.Zone
+		return b, nil
+	case cfg.BackendDNS:
+		b := NewSourceBuilder(DNSScheme, NewDNSSource(config.Domain, config.SRV, config.DNSPort, config.Refresh))
+		b.Zone = config.Zone
+		return b, nil
+	}
+	return nil, fmt.Errorf("discovery: unknown backend %q", config.Backend)
+}
@@ -0,0 +1,188 @@
+package discovery
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/silentred/toolkit/util"
+)
+
+var (
+	// DefaultDNSInterval is the interval of looking up DNS
+	DefaultDNSInterval = 30 * time.Second
+)
+
+// DNSResolver looks up DNS records, it is implemented by *net.Resolver
+type DNSResolver interface {
+	LookupSRV(ctx context.Context, service, proto, name string) (string, []*net.SRV, error)
+	LookupHost(ctx context.Context, host string) ([]string, error)
+}
+
+var _ Source = &DNSSource{}
+
+// DNSSource is the Source of the instances in DNS, looked up every Interval.
+// If SRV is set, instances are the SRV records of "_{SRV}._tcp.{name}.{Domain}", with the weights
+// of records. Otherwise they are the A records of "{name}.{Domain}", listening at Port, as in
+// "dnssrv:///hello:8080". Records carry no version, zone, tags or metadata, so instances of DNS
+// have none of them and the weight of SRV records only.
+type DNSSource struct {
+	Domain   string
+	SRV      string
+	Port     int
+	Interval time.Duration
+	Resolver DNSResolver
+}
+
+// NewDNSSource returns DNSSource looking up SRV records by net.DefaultResolver, or A records
+// listening at port if srv is empty. DefaultDNSInterval is used if interval is not positive.
+func NewDNSSource(domain, srv string, port int, interval time.Duration) *DNSSource {
+	if interval <= 0 {
+		interval = DefaultDNSInterval
+	}
+	return &DNSSource{
+		Domain:   domain,
+		SRV:      srv,
+		Port:     port,
+		Interval: interval,
+		Resolver: net.DefaultResolver,
+	}
+}
+
+// Watch implements Source
+func (ds *DNSSource) Watch(ctx context.Context, name string) <-chan Update {
+	out := make(chan Update)
+
+	go func() {
+		defer close(out)
+		ticker := time.NewTicker(ds.Interval)
+		defer ticker.Stop()
+
+		var (
+			last  []*Service
+			first = true
+		)
+		for {
+			services, err := ds.Lookup(ctx, name)
+			if ctx.Err() != nil {
+				return
+			}
+
+			var u *Update
+			switch {
+			case err != nil:
+				u = &Update{Err: err}
+				first = true
+			case first || !sameServices(services, last):
+				u = &Update{Services: services}
+				last, first = services, false
+			}
+			if u != nil {
+				select {
+				case out <- *u:
+				case <-ctx.Done():
+					return
+				}
+			}
+
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return out
+}
+
+// Lookup returns the instances of service name in DNS, sorted by address.
+// For A records, name may be followed by the port, as in "hello:8080", which overrides Port.
+// It is an error if neither has a port.
+func (ds *DNSSource) Lookup(ctx context.Context, name string) ([]*Service, error) {
+	port := ds.Port
+	if h, p, err := net.SplitHostPort(name); err == nil {
+		if port, err = strconv.Atoi(p); err != nil {
+			return nil, fmt.Errorf("discovery: invalid port in %q", name)
+		}
+		name = h
+	}
+
+	host := name
+	if len(ds.Domain) > 0 {
+		host = name + "." + strings.Trim(ds.Domain, ".")
+	}
+
+	var services []*Service
+	if len(ds.SRV) > 0 {
+		_, records, err := ds.Resolver.LookupSRV(ctx, ds.SRV, "tcp", host)
+		if err != nil {
+			return nil, err
+		}
+		for _, rec := range records {
+			srv := NewService(name, strings.TrimSuffix(rec.Target, "."), int(rec.Port))
+			srv.Weight = int(rec.Weight)
+			services = append(services, srv)
+		}
+	} else {
+		if port <= 0 {
+			return nil, fmt.Errorf("discovery: no port for the A records of %q", name)
+		}
+		addrs, err := ds.Resolver.LookupHost(ctx, host)
+		if err != nil {
+			return nil, err
+		}
+		for _, addr := range addrs {
+			services = append(services, NewService(name, addr, port))
+		}
+	}
+
+	sortServices(services)
+	return services, nil
+}
+
+var (
+	_ Publisher  = &StaticPublisher{}
+	_ KeepAliver = &StaticPublisher{}
+)
+
+// StaticPublisher publishes nothing. It is for backends whose instances are maintained
+// outside of the process, as DNS records. Register logs a warning, if Logger is set, as the
+// service is not visible to clients unless the records are added.
+type StaticPublisher struct {
+	Logger util.Logger `inject:"logger.default"`
+}
+
+// Register implements Publisher
+func (p StaticPublisher) Register(service *Service) error {
+	service.start()
+	if p.Logger != nil {
+		p.Logger.Warnf("discovery: %s at %s is not published, its DNS records are maintained outside of the app",
+			service.Name, service.Addr())
+	}
+	return nil
+}
+
+// Unregister implements Publisher
+func (StaticPublisher) Unregister(service *Service) error {
+	service.Stop()
+	return nil
+}
+
+// HeartBeat implements Publisher, it blocks until the service is stopped
+func (p StaticPublisher) HeartBeat(service *Service) {
+	p.KeepAlive(context.Background(), service)
+}
+
+// KeepAlive implements KeepAliver, it blocks until ctx is done or the service is stopped
+func (StaticPublisher) KeepAlive(ctx context.Context, service *Service) error {
+	select {
+	case <-service.done():
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
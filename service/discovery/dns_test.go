@@ -0,0 +1,121 @@
+package discovery
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	elog "github.com/labstack/gommon/log"
+	cfg "github.com/silentred/toolkit/config"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeDNS struct {
+	mu    sync.Mutex
+	srv   map[string][]*net.SRV
+	hosts map[string][]string
+}
+
+func (f *fakeDNS) LookupSRV(ctx context.Context, service, proto, name string) (string, []*net.SRV, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	cname := "_" + service + "._" + proto + "." + name
+	if records, ok := f.srv[cname]; ok {
+		return cname, records, nil
+	}
+	return "", nil, errors.New("no such host")
+}
+
+func (f *fakeDNS) LookupHost(ctx context.Context, host string) ([]string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if addrs, ok := f.hosts[host]; ok {
+		return addrs, nil
+	}
+	return nil, errors.New("no such host")
+}
+
+func TestDNSLookup(t *testing.T) {
+	dns := &fakeDNS{
+		srv: map[string][]*net.SRV{
+			"_grpc._tcp.hello.svc.local": {
+				{Target: "b.hello.svc.local.", Port: 8080, Weight: 20},
+				{Target: "a.hello.svc.local.", Port: 8080, Weight: 10},
+			},
+		},
+		hosts: map[string][]string{"hello.svc.local": {"10.0.0.2", "10.0.0.1"}},
+	}
+	ds := NewDNSSource("svc.local", "grpc", 0, 0)
+	ds.Resolver = dns
+
+	services, err := ds.Lookup(context.Background(), "hello")
+	if assert.NoError(t, err) && assert.Len(t, services, 2) {
+		assert.Equal(t, "a.hello.svc.local:8080", services[0].Addr())
+		assert.Equal(t, 10, services[0].GetWeight())
+		assert.Equal(t, "hello", services[0].Name)
+	}
+
+	ds.SRV = ""
+	_, err = ds.Lookup(context.Background(), "hello")
+	assert.Error(t, err)
+	ds.Port = 9090
+	services, err = ds.Lookup(context.Background(), "hello")
+	if assert.NoError(t, err) && assert.Len(t, services, 2) {
+		assert.Equal(t, "10.0.0.1:9090", services[0].Addr())
+	}
+	services, err = ds.Lookup(context.Background(), "hello:7070")
+	if assert.NoError(t, err) && assert.Len(t, services, 2) {
+		assert.Equal(t, "10.0.0.1:7070", services[0].Addr())
+	}
+
+	_, err = ds.Lookup(context.Background(), "world")
+	assert.Error(t, err)
+}
+
+func TestDNSWatch(t *testing.T) {
+	dns := &fakeDNS{hosts: map[string][]string{"hello": {"10.0.0.1"}}}
+	ds := NewDNSSource("", "", 8080, 10*time.Millisecond)
+	ds.Resolver = dns
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	updates := ds.Watch(ctx, "hello")
+
+	u := <-updates
+	if assert.NoError(t, u.Err) && assert.Len(t, u.Services, 1) {
+		assert.Equal(t, "10.0.0.1:8080", u.Services[0].Addr())
+	}
+
+	dns.mu.Lock()
+	dns.hosts["hello"] = []string{"10.0.0.1", "10.0.0.2"}
+	dns.mu.Unlock()
+	u = <-updates
+	assert.Len(t, u.Services, 2)
+
+	dns.mu.Lock()
+	delete(dns.hosts, "hello")
+	dns.mu.Unlock()
+	u = <-updates
+	assert.Error(t, u.Err)
+}
+
+func TestStaticPublisher(t *testing.T) {
+	// registering with dns backend warns that nothing is published
+	var buf bytes.Buffer
+	p, err := NewPublisherFromConfig(cfg.DiscoveryConfig{Backend: cfg.BackendDNS}, nil)
+	if !assert.NoError(t, err) {
+		return
+	}
+	logger := elog.New("test")
+	logger.SetOutput(&buf)
+	p.(*StaticPublisher).Logger = logger
+
+	s := NewService("hello", "127.0.0.1", 8080)
+	assert.NoError(t, p.Register(s))
+	assert.Contains(t, buf.String(), "hello at 127.0.0.1:8080 is not published")
+	assert.NoError(t, p.Unregister(s))
+}
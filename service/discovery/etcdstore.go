@@ -0,0 +1,180 @@
+package discovery
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"go.etcd.io/etcd/api/v3/mvccpb"
+	"go.etcd.io/etcd/api/v3/v3rpc/rpctypes"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+var (
+	// DialTimeout of etcd client
+	DialTimeout = 5 * time.Second
+
+	_ Store = &EtcdStore{}
+)
+
+// EtcdStore implements Store with etcd v3 leases, prefix watches and transactions
+type EtcdStore struct {
+	Client *clientv3.Client
+}
+
+// NewEtcdStore dials the etcd endpoints, such as "http://127.0.0.1:2379"
+func NewEtcdStore(endpoints []string) (*EtcdStore, error) {
+	cli, err := clientv3.New(clientv3.Config{
+		Endpoints:   endpoints,
+		DialTimeout: DialTimeout,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &EtcdStore{Client: cli}, nil
+}
+
+// Grant implements Store
+func (es *EtcdStore) Grant(ctx context.Context, ttl time.Duration) (LeaseID, error) {
+	seconds := int64(ttl / time.Second)
+	if seconds < 1 {
+		seconds = 1
+	}
+	resp, err := es.Client.Grant(ctx, seconds)
+	if err != nil {
+		return NoLease, err
+	}
+	return LeaseID(resp.ID), nil
+}
+
+// KeepAlive implements Store
+func (es *EtcdStore) KeepAlive(ctx context.Context, id LeaseID) (<-chan struct{}, error) {
+	ch, err := es.Client.KeepAlive(ctx, clientv3.LeaseID(id))
+	if err != nil {
+		if err == rpctypes.ErrLeaseNotFound {
+			return nil, ErrLeaseNotFound
+		}
+		return nil, err
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		// the channel is closed when keeping alive fails or ctx is done
+		for range ch {
+		}
+	}()
+	return done, nil
+}
+
+// Revoke implements Store
+func (es *EtcdStore) Revoke(ctx context.Context, id LeaseID) error {
+	_, err := es.Client.Revoke(ctx, clientv3.LeaseID(id))
+	if err == rpctypes.ErrLeaseNotFound {
+		return ErrLeaseNotFound
+	}
+	return err
+}
+
+// Put implements Store
+func (es *EtcdStore) Put(ctx context.Context, key, value string, lease LeaseID) error {
+	var opts []clientv3.OpOption
+	if lease != NoLease {
+		opts = append(opts, clientv3.WithLease(clientv3.LeaseID(lease)))
+	}
+	_, err := es.Client.Put(ctx, key, value, opts...)
+	if err == rpctypes.ErrLeaseNotFound {
+		return ErrLeaseNotFound
+	}
+	return err
+}
+
+// Delete implements Store
+func (es *EtcdStore) Delete(ctx context.Context, key string) error {
+	_, err := es.Client.Delete(ctx, key)
+	return err
+}
+
+// List implements Store
+func (es *EtcdStore) List(ctx context.Context, prefix string) ([]KeyValue, int64, error) {
+	resp, err := es.Client.Get(ctx, prefix, clientv3.WithPrefix())
+	if err != nil {
+		return nil, 0, err
+	}
+
+	kvs := make([]KeyValue, 0, len(resp.Kvs))
+	for _, kv := range resp.Kvs {
+		kvs = append(kvs, KeyValue{Key: string(kv.Key), Value: string(kv.Value), ModRevision: kv.ModRevision})
+	}
+	return kvs, resp.Header.Revision, nil
+}
+
+// Watch implements Store
+func (es *EtcdStore) Watch(ctx context.Context, prefix string, rev int64) <-chan WatchResponse {
+	out := make(chan WatchResponse)
+	wch := es.Client.Watch(ctx, prefix, clientv3.WithPrefix(), clientv3.WithRev(rev))
+
+	go func() {
+		defer close(out)
+		for resp := range wch {
+			wr := WatchResponse{Revision: resp.Header.Revision, Err: resp.Err()}
+			for _, ev := range resp.Events {
+				event := Event{
+					Type:     EventPut,
+					KeyValue: KeyValue{Key: string(ev.Kv.Key), Value: string(ev.Kv.Value), ModRevision: ev.Kv.ModRevision},
+				}
+				if ev.Type == mvccpb.DELETE {
+					event.Type = EventDelete
+				}
+				wr.Events = append(wr.Events, event)
+			}
+
+			select {
+			case out <- wr:
+			case <-ctx.Done():
+				return
+			}
+			if wr.Err != nil {
+				return
+			}
+		}
+	}()
+
+	return out
+}
+
+// Incr implements Store. It retries the compare-and-swap until no one else has modified key.
+func (es *EtcdStore) Incr(ctx context.Context, key string) (int64, error) {
+	for {
+		resp, err := es.Client.Get(ctx, key)
+		if err != nil {
+			return 0, err
+		}
+
+		var current int64
+		var cmp clientv3.Cmp
+		if len(resp.Kvs) == 0 {
+			cmp = clientv3.Compare(clientv3.CreateRevision(key), "=", 0)
+		} else {
+			kv := resp.Kvs[0]
+			if current, err = strconv.ParseInt(string(kv.Value), 10, 64); err != nil {
+				return 0, err
+			}
+			cmp = clientv3.Compare(clientv3.ModRevision(key), "=", kv.ModRevision)
+		}
+
+		next := current + 1
+		txn, err := es.Client.Txn(ctx).If(cmp).Then(clientv3.OpPut(key, strconv.FormatInt(next, 10))).Commit()
+		if err != nil {
+			return 0, err
+		}
+		if txn.Succeeded {
+			return next, nil
+		}
+	}
+}
+
+// Close implements Store
+func (es *EtcdStore) Close() error {
+	return es.Client.Close()
+}
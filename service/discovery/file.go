@@ -0,0 +1,321 @@
+package discovery
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	elog "github.com/labstack/gommon/log"
+	toml "github.com/pelletier/go-toml"
+	"github.com/silentred/toolkit/util"
+	"sigs.k8s.io/yaml"
+)
+
+var (
+	// DefaultFileInterval is the interval of checking the static file for changes
+	DefaultFileInterval = time.Second
+)
+
+// fileEntry is an instance listed in the static file
+type fileEntry struct {
+	Name     string            `json:"name" toml:"name"`
+	Host     string            `json:"host" toml:"host"`
+	Port     int               `json:"port" toml:"port"`
+	Version  string            `json:"version,omitempty" toml:"version,omitempty"`
+	Zone     string            `json:"zone,omitempty" toml:"zone,omitempty"`
+	Protocol string            `json:"protocol,omitempty" toml:"protocol,omitempty"`
+	Weight   int               `json:"weight,omitempty" toml:"weight,omitempty"`
+	Tags     []string          `json:"tags,omitempty" toml:"tags,omitempty"`
+	Metadata map[string]string `json:"metadata,omitempty" toml:"metadata,omitempty"`
+}
+
+// fileContent is the format of the static file, as in YAML:
+//
+//	services:
+//	  - name: hello
+//	    host: 127.0.0.1
+//	    port: 8080
+//	    zone: bj
+type fileContent struct {
+	Services []fileEntry `json:"services" toml:"services"`
+}
+
+func (e fileEntry) service() *Service {
+	srv := NewService(e.Name, e.Host, e.Port)
+	srv.Version = e.Version
+	srv.Zone = e.Zone
+	srv.Protocol = e.Protocol
+	srv.Weight = e.Weight
+	srv.Tags = e.Tags
+	srv.Metadata = e.Metadata
+	return srv
+}
+
+func newFileEntry(srv *Service) fileEntry {
+	return fileEntry{
+		Name:     srv.Name,
+		Host:     srv.Host,
+		Port:     srv.Port,
+		Version:  srv.Version,
+		Zone:     srv.Zone,
+		Protocol: srv.Protocol,
+		Weight:   srv.Weight,
+		Tags:     srv.Tags,
+		Metadata: srv.Metadata,
+	}
+}
+
+// ReadFile returns the instances listed in the static file at path. The format is told by the
+// extension of path: .yaml, .yml, .toml or .json. A missing file lists no instance.
+func ReadFile(path string) ([]*Service, error) {
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var content fileContent
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(b, &content)
+	case ".toml":
+		err = toml.Unmarshal(b, &content)
+	case ".json":
+		err = json.Unmarshal(b, &content)
+	default:
+		err = fmt.Errorf("unsupported format %q", ext)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("discovery: reading %s: %v", path, err)
+	}
+
+	services := make([]*Service, 0, len(content.Services))
+	for _, e := range content.Services {
+		services = append(services, e.service())
+	}
+	return services, nil
+}
+
+// WriteFile replaces the static file at path with services, in the format told by the extension of path
+func WriteFile(path string, services []*Service) error {
+	var content fileContent
+	for _, srv := range services {
+		content.Services = append(content.Services, newFileEntry(srv))
+	}
+
+	var (
+		b   []byte
+		err error
+	)
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".yaml", ".yml":
+		b, err = yaml.Marshal(content)
+	case ".toml":
+		b, err = toml.Marshal(content)
+	case ".json":
+		b, err = json.MarshalIndent(content, "", "  ")
+	default:
+		err = fmt.Errorf("unsupported format %q", ext)
+	}
+	if err != nil {
+		return fmt.Errorf("discovery: writing %s: %v", path, err)
+	}
+
+	// write to a temporary file and rename it, so that readers never see a partial file
+	tmp, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path))
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if err = tmp.Chmod(0644); err != nil {
+		tmp.Close()
+		return err
+	}
+	if _, err = tmp.Write(b); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+var _ Source = &FileSource{}
+
+// FileSource is the Source of the instances listed in a static file, which is read again
+// every Interval if it is modified
+type FileSource struct {
+	Path     string
+	Interval time.Duration
+}
+
+// NewFileSource returns FileSource of the file at path. DefaultFileInterval is used if interval is not positive.
+func NewFileSource(path string, interval time.Duration) *FileSource {
+	if interval <= 0 {
+		interval = DefaultFileInterval
+	}
+	return &FileSource{Path: path, Interval: interval}
+}
+
+// Watch implements Source
+func (fs *FileSource) Watch(ctx context.Context, name string) <-chan Update {
+	out := make(chan Update)
+
+	go func() {
+		defer close(out)
+		ticker := time.NewTicker(fs.Interval)
+		defer ticker.Stop()
+
+		var (
+			last    []*Service
+			lastMod time.Time
+			lastErr error
+			first   = true
+		)
+		for {
+			if mod := modTime(fs.Path); first || !mod.Equal(lastMod) {
+				services, err := ReadFile(fs.Path)
+				if err == nil {
+					services = servicesNamed(services, name)
+				}
+
+				var u *Update
+				switch {
+				case err != nil && (lastErr == nil || err.Error() != lastErr.Error()):
+					u = &Update{Err: err}
+				case err == nil && (first || lastErr != nil || !sameServices(services, last)):
+					u = &Update{Services: services}
+					last = services
+				}
+				if u != nil {
+					select {
+					case out <- *u:
+					case <-ctx.Done():
+						return
+					}
+				}
+				// a file which fails to be parsed is read again, it may be in the middle of editing
+				if err == nil {
+					lastMod = mod
+				}
+				lastErr, first = err, false
+			}
+
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return out
+}
+
+func modTime(path string) time.Time {
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
+
+func servicesNamed(services []*Service, name string) []*Service {
+	named := make([]*Service, 0, len(services))
+	for _, srv := range services {
+		if srv.Name == name {
+			named = append(named, srv)
+		}
+	}
+	sortServices(named)
+	return named
+}
+
+var (
+	_ Publisher  = &FilePublisher{}
+	_ KeepAliver = &FilePublisher{}
+)
+
+// FilePublisher adds the service to a static file when registering, and removes it when unregistering.
+// It is meant for local development, where processes share the file without etcd. Processes writing
+// the file at the same moment may lose each other's change.
+type FilePublisher struct {
+	Logger util.Logger `inject:"logger.default"`
+	Path   string
+
+	mu sync.Mutex
+}
+
+// NewFilePublisher returns FilePublisher of the file at path. It logs to stdout until the Logger
+// of the app is injected.
+func NewFilePublisher(path string) *FilePublisher {
+	return &FilePublisher{Logger: elog.New("discovery"), Path: path}
+}
+
+// Register implements Publisher
+func (fp *FilePublisher) Register(service *Service) error {
+	service.start()
+	err := fp.update(service, true)
+	if err != nil {
+		fp.Logger.Error(err)
+	}
+	return err
+}
+
+// Unregister implements Publisher
+func (fp *FilePublisher) Unregister(service *Service) error {
+	service.Stop()
+	err := fp.update(service, false)
+	if err != nil {
+		fp.Logger.Error(err)
+	}
+	return err
+}
+
+// HeartBeat implements Publisher, it blocks until the service is stopped
+func (fp *FilePublisher) HeartBeat(service *Service) {
+	fp.KeepAlive(context.Background(), service)
+}
+
+// KeepAlive implements KeepAliver. Instances in the file do not expire, so it only blocks
+// until ctx is done or the service is stopped.
+func (fp *FilePublisher) KeepAlive(ctx context.Context, service *Service) error {
+	select {
+	case <-service.done():
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// update adds or removes service in the file
+func (fp *FilePublisher) update(service *Service, add bool) error {
+	fp.mu.Lock()
+	defer fp.mu.Unlock()
+
+	services, err := ReadFile(fp.Path)
+	if err != nil {
+		return err
+	}
+
+	kept := services[:0]
+	for _, srv := range services {
+		if srv.Name != service.Name || srv.Addr() != service.Addr() {
+			kept = append(kept, srv)
+		}
+	}
+	if add {
+		kept = append(kept, service)
+	}
+
+	return WriteFile(fp.Path, kept)
+}
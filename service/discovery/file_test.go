@@ -0,0 +1,117 @@
+package discovery
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	elog "github.com/labstack/gommon/log"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/resolver"
+)
+
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "discovery")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	return dir
+}
+
+func TestReadWriteFile(t *testing.T) {
+	dir := tempDir(t)
+
+	srv := NewService("hello", "127.0.0.1", 8080)
+	srv.Zone = "bj"
+	srv.Weight = 3
+	srv.Tags = []string{"canary"}
+	srv.Metadata = map[string]string{"idc": "a"}
+
+	for _, ext := range []string{".yaml", ".toml", ".json"} {
+		path := filepath.Join(dir, "services"+ext)
+		if !assert.NoError(t, WriteFile(path, []*Service{srv, NewService("world", "127.0.0.1", 8081)}), ext) {
+			continue
+		}
+		services, err := ReadFile(path)
+		if assert.NoError(t, err, ext) && assert.Len(t, services, 2, ext) {
+			assert.Equal(t, srv.String(), services[0].String(), ext)
+			assert.Equal(t, "world", services[1].Name, ext)
+		}
+	}
+
+	services, err := ReadFile(filepath.Join(dir, "missing.yaml"))
+	assert.NoError(t, err)
+	assert.Len(t, services, 0)
+
+	_, err = ReadFile(filepath.Join(dir, "services.ini"))
+	assert.NoError(t, err)
+	ioutil.WriteFile(filepath.Join(dir, "services.ini"), []byte("x"), 0644)
+	_, err = ReadFile(filepath.Join(dir, "services.ini"))
+	assert.Error(t, err)
+}
+
+func TestReadHandWrittenFile(t *testing.T) {
+	path := filepath.Join(tempDir(t), "services.toml")
+	ioutil.WriteFile(path, []byte(`
+[[services]]
+name = "hello"
+host = "10.0.0.1"
+port = 8080
+version = "v2"
+
+[services.metadata]
+idc = "a"
+`), 0644)
+
+	services, err := ReadFile(path)
+	if assert.NoError(t, err) && assert.Len(t, services, 1) {
+		assert.Equal(t, "10.0.0.1:8080", services[0].Addr())
+		assert.Equal(t, "v2", services[0].Version)
+		assert.Equal(t, "a", services[0].Metadata["idc"])
+	}
+}
+
+func TestFileBuilder(t *testing.T) {
+	path := filepath.Join(tempDir(t), "services.yaml")
+	p := NewFilePublisher(path)
+	p.Logger = elog.New("test")
+
+	s1 := NewService("hello", "127.0.0.1", 8080)
+	assert.NoError(t, p.Register(s1))
+	assert.NoError(t, p.Register(NewService("world", "127.0.0.1", 9090)))
+
+	cc := &fakeClientConn{states: make(chan resolver.State, 1)}
+	b := NewSourceBuilder(FileScheme, NewFileSource(path, 10*time.Millisecond))
+	r, err := b.Build(resolver.Target{Scheme: FileScheme, Endpoint: "hello"}, cc, resolver.BuildOptions{})
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer r.Close()
+
+	state := <-cc.states
+	if assert.Len(t, state.Addresses, 1) {
+		assert.Equal(t, "127.0.0.1:8080", state.Addresses[0].Addr)
+	}
+
+	// registering again replaces the instance at the same address
+	s2 := NewService("hello", "127.0.0.1", 8081)
+	assert.NoError(t, p.Register(s2))
+	assert.NoError(t, p.Register(s2))
+	state = <-cc.states
+	assert.Len(t, state.Addresses, 2)
+
+	assert.NoError(t, p.Unregister(s1))
+	state = <-cc.states
+	if assert.Len(t, state.Addresses, 1) {
+		assert.Equal(t, "127.0.0.1:8081", state.Addresses[0].Addr)
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- p.KeepAlive(context.Background(), s2) }()
+	assert.NoError(t, p.Unregister(s2))
+	assert.NoError(t, <-done)
+}
@@ -0,0 +1,104 @@
+package discovery
+
+import (
+	"net/url"
+	"strings"
+)
+
+// Filter tells if an instance should be used by clients
+type Filter func(*Service) bool
+
+// MatchVersion returns a Filter of the services in version
+func MatchVersion(version string) Filter {
+	return func(srv *Service) bool {
+		return srv.Version == version
+	}
+}
+
+// MatchZone returns a Filter of the services in zone
+func MatchZone(zone string) Filter {
+	return func(srv *Service) bool {
+		return srv.Zone == zone
+	}
+}
+
+// MatchProtocol returns a Filter of the services speaking protocol
+func MatchProtocol(protocol string) Filter {
+	return func(srv *Service) bool {
+		return srv.Protocol == protocol
+	}
+}
+
+// MatchTags returns a Filter of the services having all the tags
+func MatchTags(tags ...string) Filter {
+	return func(srv *Service) bool {
+		for _, tag := range tags {
+			if !srv.HasTag(tag) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// MatchMetadata returns a Filter of the services whose metadata has key with value
+func MatchMetadata(key, value string) Filter {
+	return func(srv *Service) bool {
+		v, ok := srv.Metadata[key]
+		return ok && v == value
+	}
+}
+
+// And returns a Filter of the services matching all the filters
+func And(filters ...Filter) Filter {
+	return func(srv *Service) bool {
+		for _, f := range filters {
+			if f != nil && !f(srv) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// ParseFilter builds a Filter from query, such as "version=v2&zone=bj&tag=canary&meta.env=prod".
+// It returns nil if query has no condition.
+func ParseFilter(query url.Values) Filter {
+	var filters []Filter
+	for key, values := range query {
+		for _, value := range values {
+			switch {
+			case key == "version":
+				filters = append(filters, MatchVersion(value))
+			case key == "zone":
+				filters = append(filters, MatchZone(value))
+			case key == "protocol":
+				filters = append(filters, MatchProtocol(value))
+			case key == "tag":
+				filters = append(filters, MatchTags(value))
+			case strings.HasPrefix(key, "meta."):
+				filters = append(filters, MatchMetadata(strings.TrimPrefix(key, "meta."), value))
+			}
+		}
+	}
+
+	if len(filters) == 0 {
+		return nil
+	}
+	return And(filters...)
+}
+
+// parseEndpoint splits the endpoint of target, such as "hello?version=v2", into service name and Filter
+func parseEndpoint(endpoint string) (string, Filter, error) {
+	endpoint = strings.Trim(endpoint, "/")
+	idx := strings.Index(endpoint, "?")
+	if idx < 0 {
+		return endpoint, nil, nil
+	}
+
+	query, err := url.ParseQuery(endpoint[idx+1:])
+	if err != nil {
+		return "", nil, err
+	}
+	return endpoint[:idx], ParseFilter(query), nil
+}
@@ -0,0 +1,283 @@
+package discovery
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var _ Store = &MemoryStore{}
+
+// MemoryStore implements Store in memory. It is meant for tests and local development.
+type MemoryStore struct {
+	mu      sync.Mutex
+	rev     int64
+	nextID  LeaseID
+	kvs     map[string]*memValue
+	leases  map[LeaseID]*memLease
+	events  []Event
+	changed chan struct{}
+}
+
+type memValue struct {
+	KeyValue
+	lease LeaseID
+}
+
+type memLease struct {
+	ttl   time.Duration
+	timer *time.Timer
+	keys  map[string]bool
+	// closed when the lease is gone
+	gone chan struct{}
+}
+
+// NewMemoryStore returns an empty MemoryStore
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		kvs:     make(map[string]*memValue),
+		leases:  make(map[LeaseID]*memLease),
+		changed: make(chan struct{}),
+	}
+}
+
+// Grant implements Store
+func (ms *MemoryStore) Grant(ctx context.Context, ttl time.Duration) (LeaseID, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	ms.nextID++
+	id := ms.nextID
+	l := &memLease{ttl: ttl, keys: make(map[string]bool), gone: make(chan struct{})}
+	l.timer = time.AfterFunc(ttl, func() { ms.Expire(id) })
+	ms.leases[id] = l
+
+	return id, nil
+}
+
+// KeepAlive implements Store
+func (ms *MemoryStore) KeepAlive(ctx context.Context, id LeaseID) (<-chan struct{}, error) {
+	ms.mu.Lock()
+	l, ok := ms.leases[id]
+	ms.mu.Unlock()
+	if !ok {
+		return nil, ErrLeaseNotFound
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(l.ttl / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				ms.mu.Lock()
+				if _, ok := ms.leases[id]; ok {
+					l.timer.Reset(l.ttl)
+				}
+				ms.mu.Unlock()
+			case <-l.gone:
+				return
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return done, nil
+}
+
+// Revoke implements Store
+func (ms *MemoryStore) Revoke(ctx context.Context, id LeaseID) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	return ms.revokeLocked(id)
+}
+
+// Expire revokes the lease at once, as if it was not kept alive in time
+func (ms *MemoryStore) Expire(id LeaseID) {
+	ms.mu.Lock()
+	ms.revokeLocked(id)
+	ms.mu.Unlock()
+}
+
+func (ms *MemoryStore) revokeLocked(id LeaseID) error {
+	l, ok := ms.leases[id]
+	if !ok {
+		return ErrLeaseNotFound
+	}
+	l.timer.Stop()
+	close(l.gone)
+	delete(ms.leases, id)
+
+	if len(l.keys) > 0 {
+		ms.rev++
+		for key := range l.keys {
+			ms.deleteLocked(key)
+		}
+		ms.notifyLocked()
+	}
+	return nil
+}
+
+// Put implements Store
+func (ms *MemoryStore) Put(ctx context.Context, key, value string, lease LeaseID) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	return ms.putLocked(key, value, lease)
+}
+
+func (ms *MemoryStore) putLocked(key, value string, lease LeaseID) error {
+	if lease != NoLease {
+		l, ok := ms.leases[lease]
+		if !ok {
+			return ErrLeaseNotFound
+		}
+		l.keys[key] = true
+	}
+	if prev, ok := ms.kvs[key]; ok && prev.lease != lease && prev.lease != NoLease {
+		if l, ok := ms.leases[prev.lease]; ok {
+			delete(l.keys, key)
+		}
+	}
+
+	ms.rev++
+	kv := KeyValue{Key: key, Value: value, ModRevision: ms.rev}
+	ms.kvs[key] = &memValue{KeyValue: kv, lease: lease}
+	ms.events = append(ms.events, Event{Type: EventPut, KeyValue: kv})
+	ms.notifyLocked()
+
+	return nil
+}
+
+// Delete implements Store
+func (ms *MemoryStore) Delete(ctx context.Context, key string) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	if _, ok := ms.kvs[key]; ok {
+		ms.rev++
+		ms.deleteLocked(key)
+		ms.notifyLocked()
+	}
+	return nil
+}
+
+func (ms *MemoryStore) deleteLocked(key string) {
+	v, ok := ms.kvs[key]
+	if !ok {
+		return
+	}
+	if l, ok := ms.leases[v.lease]; ok {
+		delete(l.keys, key)
+	}
+	delete(ms.kvs, key)
+	ms.events = append(ms.events, Event{Type: EventDelete, KeyValue: KeyValue{Key: key, ModRevision: ms.rev}})
+}
+
+func (ms *MemoryStore) notifyLocked() {
+	close(ms.changed)
+	ms.changed = make(chan struct{})
+}
+
+// Get returns the value at key
+func (ms *MemoryStore) Get(key string) (string, bool) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	if v, ok := ms.kvs[key]; ok {
+		return v.Value, true
+	}
+	return "", false
+}
+
+// List implements Store
+func (ms *MemoryStore) List(ctx context.Context, prefix string) ([]KeyValue, int64, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	var kvs []KeyValue
+	for key, v := range ms.kvs {
+		if strings.HasPrefix(key, prefix) {
+			kvs = append(kvs, v.KeyValue)
+		}
+	}
+	sort.Slice(kvs, func(i, j int) bool { return kvs[i].Key < kvs[j].Key })
+
+	return kvs, ms.rev, nil
+}
+
+// Watch implements Store
+func (ms *MemoryStore) Watch(ctx context.Context, prefix string, rev int64) <-chan WatchResponse {
+	out := make(chan WatchResponse)
+
+	// as etcd does, watch from the next revision if rev is not given
+	if rev <= 0 {
+		ms.mu.Lock()
+		rev = ms.rev + 1
+		ms.mu.Unlock()
+	}
+
+	go func() {
+		defer close(out)
+		for {
+			ms.mu.Lock()
+			var resp WatchResponse
+			for _, ev := range ms.events {
+				if ev.ModRevision < rev || !strings.HasPrefix(ev.Key, prefix) {
+					continue
+				}
+				if len(resp.Events) > 0 && ev.ModRevision != resp.Revision {
+					break
+				}
+				resp.Revision = ev.ModRevision
+				resp.Events = append(resp.Events, ev)
+			}
+			changed := ms.changed
+			ms.mu.Unlock()
+
+			if len(resp.Events) > 0 {
+				select {
+				case out <- resp:
+					rev = resp.Revision + 1
+					continue
+				case <-ctx.Done():
+					return
+				}
+			}
+
+			select {
+			case <-changed:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return out
+}
+
+// Incr implements Store
+func (ms *MemoryStore) Incr(ctx context.Context, key string) (int64, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	var current int64
+	if v, ok := ms.kvs[key]; ok {
+		var err error
+		if current, err = strconv.ParseInt(v.Value, 10, 64); err != nil {
+			return 0, err
+		}
+	}
+
+	next := current + 1
+	return next, ms.putLocked(key, strconv.FormatInt(next, 10), NoLease)
+}
+
+// Close implements Store
+func (ms *MemoryStore) Close() error {
+	return nil
+}
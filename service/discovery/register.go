@@ -2,17 +2,34 @@ package discovery
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"strconv"
 	"time"
 
-	"github.com/coreos/etcd/client"
+	elog "github.com/labstack/gommon/log"
 	"github.com/silentred/toolkit/util"
 )
 
 var (
 	// DefaultPrefix is the key prefix in etcd
 	DefaultPrefix = "iget/service/grpc"
+	// RetryInterval is the first interval between retries of registering a lost service
+	RetryInterval = time.Second
+	// MaxRetryInterval is the limit of the doubled retry interval
+	MaxRetryInterval = 30 * time.Second
+
+	// ErrKeyDeleted is reported when the registered key disappears while the lease is alive
+	ErrKeyDeleted = errors.New("discovery: registered key is deleted")
+	// ErrLeaseLost is reported when the lease can not be kept alive
+	ErrLeaseLost = errors.New("discovery: lease is lost")
+
+	errStopped     = errors.New("discovery: service is stopped")
+	errWatchClosed = errors.New("discovery: watch is closed")
+)
+
+var (
+	_ Publisher  = &EtcdPublisher{}
+	_ KeepAliver = &EtcdPublisher{}
 )
 
 // Publisher is able to register and unregister service to registry
@@ -22,181 +39,332 @@ type Publisher interface {
 	HeartBeat(*Service)
 }
 
+// KeepAliver is a Publisher which keeps services registered until a context is done. Callers check
+// for it by type assertion, and fall back to HeartBeat of other publishers.
+type KeepAliver interface {
+	KeepAlive(context.Context, *Service) error
+}
+
+// State of the registration of a service
+type State int
+
+const (
+	// StateRegistered means the service is stored at registry
+	StateRegistered State = iota + 1
+	// StateLost means the lease or the key of the service is gone, it is going to be registered again
+	StateLost
+	// StateUnregistered means the service is removed from registry
+	StateUnregistered
+)
+
+func (s State) String() string {
+	switch s {
+	case StateRegistered:
+		return "registered"
+	case StateLost:
+		return "lost"
+	case StateUnregistered:
+		return "unregistered"
+	}
+	return fmt.Sprintf("State(%d)", int(s))
+}
+
+// StateEvent reports the change of registration state of Service
+type StateEvent struct {
+	Service *Service
+	State   State
+	// Err is the reason of StateLost
+	Err error
+}
+
 // EtcdPublisher publish sevice info to etcd
 type EtcdPublisher struct {
 	Logger util.Logger `inject:"logger.default"`
 	// should be in format as iger/service/grpc/{ServiceName}
 	Prefix string
 	TTL    time.Duration
-	Client *client.Client
-	Kapi   client.KeysAPI
+	Store  Store
+	// OnStateChange is called on every StateEvent, from the goroutine changing the state.
+	// It must not block.
+	OnStateChange func(StateEvent)
 }
 
-// NewEtcdPublisher returns the publisher which refresh every ttl seconds and has DefaultPrefix
+// NewEtcdPublisher returns the publisher which refresh every ttl seconds and has DefaultPrefix.
+// It panics if etcd can not be dialed, see DialEtcdPublisher.
 func NewEtcdPublisher(hosts []string, ttl int) *EtcdPublisher {
 	return NewEtcdPublisherWithPrefix(hosts, DefaultPrefix, ttl)
 }
 
-// NewEtcdPublisherWithPrefix returns the publisher which refreshes every ttl seconds and has prefix
+// NewEtcdPublisherWithPrefix returns the publisher which refreshes every ttl seconds and has prefix.
+// It panics if etcd can not be dialed, see DialEtcdPublisher.
 func NewEtcdPublisherWithPrefix(hosts []string, prefix string, ttl int) *EtcdPublisher {
-	cfg := client.Config{
-		Endpoints:               hosts,
-		Transport:               client.DefaultTransport,
-		HeaderTimeoutPerRequest: time.Second,
+	ep, err := DialEtcdPublisher(hosts, prefix, ttl)
+	if err != nil {
+		panic(err)
 	}
+	return ep
+}
 
-	cli, err := client.New(cfg)
+// DialEtcdPublisher dials etcd at hosts and returns the publisher which refreshes every ttl seconds and has prefix
+func DialEtcdPublisher(hosts []string, prefix string, ttl int) (*EtcdPublisher, error) {
+	store, err := NewEtcdStore(hosts)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
 
-	kapi := client.NewKeysAPI(cli)
+	return NewEtcdPublisherWithStore(store, prefix, ttl), nil
+}
 
+// NewEtcdPublisherWithStore returns the publisher which uses store as registry. It logs to stdout
+// until the Logger of the app is injected.
+func NewEtcdPublisherWithStore(store Store, prefix string, ttl int) *EtcdPublisher {
 	if len(prefix) == 0 {
 		prefix = DefaultPrefix
 	}
 
 	return &EtcdPublisher{
+		Logger: elog.New("discovery"),
 		Prefix: prefix,
 		TTL:    time.Duration(ttl) * time.Second,
-		Client: &cli,
-		Kapi:   kapi,
+		Store:  store,
 	}
 }
 
-// Register stores the info of service at registry, and keep it, refresh it
+// Register stores the info of service at registry with a lease of TTL.
+// An ID is allocated if the service has none. A stopped service can be registered again.
 func (ep *EtcdPublisher) Register(service *Service) error {
+	service.regMu.Lock()
+	service.start()
+	err := ep.register(context.Background(), service)
+	service.regMu.Unlock()
+
+	if err != nil {
+		ep.Logger.Error(err)
+		return err
+	}
+	ep.notify(service, StateRegistered, nil)
+	return nil
+}
+
+// reregister registers service again, unless it is stopped meanwhile
+func (ep *EtcdPublisher) reregister(ctx context.Context, service *Service) error {
+	service.regMu.Lock()
+	defer service.regMu.Unlock()
+
+	if service.Stopped() {
+		return errStopped
+	}
+	return ep.register(ctx, service)
+}
+
+func (ep *EtcdPublisher) register(ctx context.Context, service *Service) error {
 	if service.ID == 0 {
-		var prevVal, value string
-		var currentID int
-		for !ep.saveIDIndex(service.Name, prevVal, value) {
-			if id, err := ep.lookupID(service.Name); err == nil {
-				prevVal = strconv.Itoa(id)
-				currentID = id + 1
-				value = strconv.Itoa(currentID)
-				// wait for 500ms before update ID
-				time.Sleep(time.Second / 2)
-			} else {
-				currentID = 1
-				value = "1"
-			}
+		id, err := ep.Store.Incr(ctx, ep.getIDKey(service.Name))
+		if err != nil {
+			return err
 		}
-		service.ID = uint64(currentID)
+		service.ID = uint64(id)
 	}
 
-	path := ep.getFullPath(service)
-
-	opt := &client.SetOptions{TTL: ep.TTL}
-	if service.lastIndex > 0 {
-		opt.PrevIndex = service.lastIndex
+	lease, err := ep.Store.Grant(ctx, ep.TTL)
+	if err != nil {
+		return err
 	}
 
-	resp, err := ep.Kapi.Set(context.Background(), path, service.String(), opt)
+	err = ep.Store.Put(ctx, ep.getFullPath(service), service.String(), lease)
 	if err != nil {
-		ep.Logger.Error(err)
+		ep.revoke(ctx, lease)
 		return err
 	}
-	service.SetIndex(resp.Index)
+	// the key is attached to the new lease, the old one only lives until its TTL otherwise
+	ep.revoke(ctx, service.GetLease())
+	service.SetLease(lease)
 
 	return nil
 }
 
-// Unregister removes the Publisher.FullKey at registry
-func (ep *EtcdPublisher) Unregister(service *Service) error {
-	path := ep.getFullPath(service)
+// revoke releases a lease which is not used any more. Errors are logged only, the lease expires
+// after its TTL anyway.
+func (ep *EtcdPublisher) revoke(ctx context.Context, lease LeaseID) {
+	if lease == NoLease {
+		return
+	}
+	if err := ep.Store.Revoke(ctx, lease); err != nil && err != ErrLeaseNotFound {
+		ep.Logger.Errorf("revoking lease %d: %v", lease, err)
+	}
+}
 
-	opt := &client.DeleteOptions{PrevIndex: service.GetIndex()}
-	resp, err := ep.Kapi.Delete(context.Background(), path, opt)
+// Unregister stops the service and revokes its lease, which removes its key at registry.
+// It is safe to call Unregister more than once.
+func (ep *EtcdPublisher) Unregister(service *Service) error {
+	registered, err := ep.unregister(service)
 	if err != nil {
 		ep.Logger.Error(err)
 		return err
 	}
+	if registered {
+		ep.notify(service, StateUnregistered, nil)
+	}
+	return nil
+}
+
+func (ep *EtcdPublisher) unregister(service *Service) (bool, error) {
+	ctx := context.Background()
+
+	service.regMu.Lock()
+	defer service.regMu.Unlock()
 
-	service.SetIndex(resp.Index)
+	// stop first, so that keeping alive does not register it again
 	service.Stop()
 
-	return nil
-}
+	lease := service.GetLease()
+	if lease != NoLease {
+		err := ep.Store.Revoke(ctx, lease)
+		if err != nil && err != ErrLeaseNotFound {
+			return false, err
+		}
+	}
 
-// Heartbeat blocks and refresh TTL every {ttl} seconds until the service is Unregistered
-func (ep *EtcdPublisher) Heartbeat(service *Service) {
-	ticker := time.NewTicker(ep.TTL / 2)
-	path := ep.getFullPath(service)
-	opt := &client.SetOptions{
-		Refresh:   true,
-		PrevExist: client.PrevExist,
-		TTL:       ep.TTL,
+	err := ep.Store.Delete(ctx, ep.getFullPath(service))
+	if err != nil {
+		return false, err
 	}
+	service.SetLease(NoLease)
 
-	for range ticker.C {
+	return lease != NoLease, nil
+}
+
+// HeartBeat blocks and keeps service registered until it is Unregistered or Stopped
+func (ep *EtcdPublisher) HeartBeat(service *Service) {
+	ep.KeepAlive(context.Background(), service)
+}
+
+// KeepAlive blocks and keeps the lease of service alive, until ctx is done or service is Unregistered
+// or Stopped. If the lease is lost or the key of service disappears, service is registered again,
+// with the retry interval doubled from RetryInterval up to MaxRetryInterval after each failure.
+// It returns nil if service is stopped, otherwise the error of ctx.
+func (ep *EtcdPublisher) KeepAlive(ctx context.Context, service *Service) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	stopped := service.done()
+	go func() {
 		select {
-		case <-service.quit:
-			return
-		default:
-			resp, err := ep.Kapi.Set(context.Background(), path, "", opt)
-			if err != nil {
-				ep.Logger.Error(err)
-			} else {
-				if resp.Index > 0 {
-					service.SetIndex(resp.Index)
-				}
+		case <-stopped:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	interval := RetryInterval
+	for ctx.Err() == nil {
+		if service.GetLease() == NoLease {
+			err := ep.reregister(ctx, service)
+			if err == nil {
+				interval = RetryInterval
+				ep.Logger.Infof("registered %s again", ep.getFullPath(service))
+				ep.notify(service, StateRegistered, nil)
+				continue
+			}
+			if ctx.Err() != nil || err == errStopped {
+				break
 			}
+
+			ep.Logger.Errorf("registering %s: %v, retry in %s", ep.getFullPath(service), err, interval)
+			select {
+			case <-time.After(interval):
+			case <-ctx.Done():
+			}
+			if interval *= 2; interval > MaxRetryInterval {
+				interval = MaxRetryInterval
+			}
+			continue
 		}
-	}
-}
 
-func (ep *EtcdPublisher) getFullPath(service *Service) string {
-	return fmt.Sprintf("%s/%s/%d", ep.Prefix, service.Name, service.ID)
-}
+		err := ep.hold(ctx, service)
+		if ctx.Err() != nil || service.Stopped() {
+			break
+		}
+		ep.Logger.Errorf("registration of %s is lost: %v", ep.getFullPath(service), err)
+		// the lease may be alive if only the key is deleted
+		ep.revoke(ctx, service.GetLease())
+		service.SetLease(NoLease)
+		ep.notify(service, StateLost, err)
+	}
 
-func (ep *EtcdPublisher) getIDKey(srvName string) string {
-	return fmt.Sprintf("%s/%s/ID", ep.Prefix, srvName)
+	if service.Stopped() {
+		return nil
+	}
+	return ctx.Err()
 }
 
-func getDir(prefix, srvName string) string {
-	return fmt.Sprintf("%s/%s", prefix, srvName)
-}
+// hold keeps the current lease of service alive and watches its key, until either is gone or ctx is done
+func (ep *EtcdPublisher) hold(ctx context.Context, service *Service) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
 
-func (ep *EtcdPublisher) lookupID(srvName string) (id int, err error) {
-	if len(srvName) == 0 {
-		panic("srvName cannot be empty")
+	key := ep.getFullPath(service)
+	done, err := ep.Store.KeepAlive(ctx, service.GetLease())
+	if err == ErrLeaseNotFound {
+		return ErrLeaseLost
 	}
-
-	var resp *client.Response
-	opt := &client.GetOptions{}
-	resp, err = ep.Kapi.Get(context.Background(), ep.getIDKey(srvName), opt)
 	if err != nil {
-		ep.Logger.Error(err.Error())
-		return
+		return err
 	}
 
-	id, err = strconv.Atoi(resp.Node.Value)
+	events := ep.Store.Watch(ctx, key, 0)
+	// the key may be deleted before watching
+	kvs, _, err := ep.Store.List(ctx, key)
 	if err != nil {
-		ep.Logger.Error(err)
-		return
+		return err
+	}
+	if !containsKey(kvs, key) {
+		return ErrKeyDeleted
 	}
 
-	return
+	for {
+		select {
+		case <-done:
+			return ErrLeaseLost
+		case resp, ok := <-events:
+			if !ok {
+				return errWatchClosed
+			}
+			if resp.Err != nil {
+				return resp.Err
+			}
+			for _, ev := range resp.Events {
+				if ev.Type == EventDelete && ev.Key == key {
+					return ErrKeyDeleted
+				}
+			}
+		}
+	}
 }
 
-func (ep *EtcdPublisher) saveIDIndex(srvName, prevValue, value string) bool {
-	if len(value) == 0 {
-		return false
+func (ep *EtcdPublisher) notify(service *Service, state State, err error) {
+	if ep.OnStateChange != nil {
+		ep.OnStateChange(StateEvent{Service: service, State: state, Err: err})
 	}
+}
 
-	var opt *client.SetOptions
-
-	if len(prevValue) > 0 {
-		opt = &client.SetOptions{PrevValue: prevValue}
-	} else {
-		opt = &client.SetOptions{PrevExist: client.PrevNoExist}
+func containsKey(kvs []KeyValue, key string) bool {
+	for _, kv := range kvs {
+		if kv.Key == key {
+			return true
+		}
 	}
+	return false
+}
 
-	_, err := ep.Kapi.Set(context.Background(), ep.getIDKey(srvName), value, opt)
-	if err != nil {
-		ep.Logger.Error(err)
-		return false
-	}
+func (ep *EtcdPublisher) getFullPath(service *Service) string {
+	return fmt.Sprintf("%s/%s/%d", ep.Prefix, service.Name, service.ID)
+}
+
+func (ep *EtcdPublisher) getIDKey(srvName string) string {
+	return fmt.Sprintf("%s/%s/ID", ep.Prefix, srvName)
+}
 
-	return true
+func getDir(prefix, srvName string) string {
+	return fmt.Sprintf("%s/%s/", prefix, srvName)
 }
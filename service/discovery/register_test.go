@@ -0,0 +1,182 @@
+package discovery
+
+import (
+	"context"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	elog "github.com/labstack/gommon/log"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestPublisher(t *testing.T, store Store) (*EtcdPublisher, chan StateEvent) {
+	interval := RetryInterval
+	RetryInterval = 10 * time.Millisecond
+	t.Cleanup(func() { RetryInterval = interval })
+
+	events := make(chan StateEvent, 16)
+	p := NewEtcdPublisherWithStore(store, "", 10)
+	p.Logger = elog.New("test")
+	p.Logger.SetOutput(ioutil.Discard)
+	p.OnStateChange = func(ev StateEvent) { events <- ev }
+	return p, events
+}
+
+func nextState(t *testing.T, events chan StateEvent) StateEvent {
+	select {
+	case ev := <-events:
+		return ev
+	case <-time.After(time.Second):
+		t.Fatal("no state event")
+	}
+	return StateEvent{}
+}
+
+func TestKeepAliveReregister(t *testing.T) {
+	store := NewMemoryStore()
+	p, events := newTestPublisher(t, store)
+
+	s := NewService("hello", "127.0.0.1", 8080)
+	if !assert.NoError(t, p.Register(s)) {
+		return
+	}
+	assert.Equal(t, StateRegistered, nextState(t, events).State)
+
+	done := make(chan error, 1)
+	go func() { done <- p.KeepAlive(context.Background(), s) }()
+
+	// the lease expires
+	store.Expire(s.GetLease())
+	ev := nextState(t, events)
+	assert.Equal(t, StateLost, ev.State)
+	assert.Equal(t, ErrLeaseLost, ev.Err)
+	assert.Equal(t, StateRegistered, nextState(t, events).State)
+	_, ok := store.Get(p.getFullPath(s))
+	assert.True(t, ok)
+
+	// the key is deleted while the lease is alive
+	store.Delete(context.Background(), p.getFullPath(s))
+	ev = nextState(t, events)
+	assert.Equal(t, StateLost, ev.State)
+	assert.Equal(t, ErrKeyDeleted, ev.Err)
+	assert.Equal(t, StateRegistered, nextState(t, events).State)
+	assert.EqualValues(t, 1, s.ID)
+
+	assert.NoError(t, p.Unregister(s))
+	assert.Equal(t, StateUnregistered, nextState(t, events).State)
+	assert.NoError(t, <-done)
+	_, ok = store.Get(p.getFullPath(s))
+	assert.False(t, ok)
+
+	// unregistering and stopping again do not block
+	assert.NoError(t, p.Unregister(s))
+	s.Stop()
+	assert.Len(t, events, 0)
+}
+
+func TestKeepAliveCancel(t *testing.T) {
+	p, events := newTestPublisher(t, NewMemoryStore())
+
+	s := NewService("hello", "127.0.0.1", 8080)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	// the service is registered by KeepAlive if it is not yet
+	go func() { done <- p.KeepAlive(ctx, s) }()
+	assert.Equal(t, StateRegistered, nextState(t, events).State)
+
+	cancel()
+	assert.Equal(t, context.Canceled, <-done)
+	assert.NotEqual(t, NoLease, s.GetLease())
+}
+
+func TestRegisterAfterStop(t *testing.T) {
+	store := NewMemoryStore()
+	p, _ := newTestPublisher(t, store)
+
+	s := NewService("hello", "127.0.0.1", 8080)
+	assert.NoError(t, p.Register(s))
+	assert.NoError(t, p.Unregister(s))
+	assert.True(t, s.Stopped())
+
+	assert.NoError(t, p.Register(s))
+	assert.False(t, s.Stopped())
+	_, ok := store.Get(p.getFullPath(s))
+	assert.True(t, ok)
+}
+
+type failingStore struct {
+	*MemoryStore
+	fails    int
+	putFails int
+}
+
+func (fs *failingStore) Put(ctx context.Context, key, value string, lease LeaseID) error {
+	if fs.putFails > 0 {
+		fs.putFails--
+		return errWatchClosed
+	}
+	return fs.MemoryStore.Put(ctx, key, value, lease)
+}
+
+func (fs *failingStore) Grant(ctx context.Context, ttl time.Duration) (LeaseID, error) {
+	if fs.fails > 0 {
+		fs.fails--
+		return NoLease, ErrLeaseNotFound
+	}
+	return fs.MemoryStore.Grant(ctx, ttl)
+}
+
+func TestKeepAliveRetry(t *testing.T) {
+	store := &failingStore{MemoryStore: NewMemoryStore(), fails: 2}
+	p, events := newTestPublisher(t, store)
+
+	s := NewService("hello", "127.0.0.1", 8080)
+	go p.KeepAlive(context.Background(), s)
+	defer p.Unregister(s)
+
+	assert.Equal(t, StateRegistered, nextState(t, events).State)
+	assert.Equal(t, 0, store.fails)
+}
+
+func TestRegisterRevokesLeases(t *testing.T) {
+	store := &failingStore{MemoryStore: NewMemoryStore(), putFails: 1}
+	p, _ := newTestPublisher(t, store)
+	leases := func() int {
+		store.mu.Lock()
+		defer store.mu.Unlock()
+		return len(store.leases)
+	}
+
+	// the lease of a failed registration is revoked
+	s := NewService("hello", "127.0.0.1", 8080)
+	assert.Error(t, p.Register(s))
+	assert.Equal(t, 0, leases())
+
+	// the previous lease is revoked by registering again, the key stays
+	assert.NoError(t, p.Register(s))
+	first := s.GetLease()
+	assert.NoError(t, p.Register(s))
+	assert.NotEqual(t, first, s.GetLease())
+	assert.Equal(t, 1, leases())
+	_, ok := store.Get(p.getFullPath(s))
+	assert.True(t, ok)
+
+	// the lease of a deleted key is revoked before registering again
+	events := make(chan StateEvent, 16)
+	p.OnStateChange = func(ev StateEvent) { events <- ev }
+	go p.KeepAlive(context.Background(), s)
+	defer p.Unregister(s)
+	store.Delete(context.Background(), p.getFullPath(s))
+	assert.Equal(t, StateLost, nextState(t, events).State)
+	assert.Equal(t, StateRegistered, nextState(t, events).State)
+	assert.Equal(t, 1, leases())
+}
+
+func TestPublisherDefaultLogger(t *testing.T) {
+	// a publisher which is not injected logs its failures instead of panicking
+	store := &failingStore{MemoryStore: NewMemoryStore(), fails: 1}
+	p := NewEtcdPublisherWithStore(store, "", 10)
+	p.Logger.SetOutput(ioutil.Discard)
+	assert.Error(t, p.Register(NewService("hello", "127.0.0.1", 8080)))
+}
@@ -4,16 +4,15 @@ import (
 	"errors"
 	"fmt"
 	"strings"
-	"time"
-
-	etcd "github.com/coreos/etcd/client"
-	"google.golang.org/grpc/naming"
 )
 
-// EtcdResolver is the implementaion of grpc.naming.Resolver
+// EtcdResolver resolves services to EtcdWatchers, as the former grpc.naming.Resolver
+//
+// Deprecated: grpc.naming is removed in newer grpc releases, use EtcdBuilder instead.
 type EtcdResolver struct {
 	prefix      string
 	ServiceName string // service name to resolve
+	store       Store
 }
 
 // NewResolver return EtcdResolver with service name
@@ -24,35 +23,31 @@ func NewResolver(serviceName, prefix string) *EtcdResolver {
 	return &EtcdResolver{ServiceName: serviceName, prefix: prefix}
 }
 
+// NewResolverWithStore returns EtcdResolver which watches store instead of dialing the target
+func NewResolverWithStore(serviceName, prefix string, store Store) *EtcdResolver {
+	er := NewResolver(serviceName, prefix)
+	er.store = store
+	return er
+}
+
 // Resolve to resolve the service from etcd, target is the dial address of etcd
 // target example: "http://127.0.0.1:2379,http://127.0.0.1:12379,http://127.0.0.1:22379"
-func (er *EtcdResolver) Resolve(target string) (naming.Watcher, error) {
+func (er *EtcdResolver) Resolve(target string) (*EtcdWatcher, error) {
 	if er.ServiceName == "" {
 		return nil, errors.New("wonaming: no service name provided")
 	}
 
-	// generate etcd client, return if error
-	endpoints := strings.Split(target, ",")
-	conf := etcd.Config{
-		Endpoints:               endpoints,
-		Transport:               etcd.DefaultTransport,
-		HeaderTimeoutPerRequest: time.Second,
+	store := er.store
+	if store == nil {
+		// generate etcd client, return if error
+		endpoints := strings.Split(target, ",")
+		etcdStore, err := NewEtcdStore(endpoints)
+		if err != nil {
+			return nil, fmt.Errorf("wonaming: creat etcd error: %s", err.Error())
+		}
+		store = etcdStore
 	}
 
-	client, err := etcd.New(conf)
-	if err != nil {
-		return nil, fmt.Errorf("wonaming: creat etcd error: %s", err.Error())
-	}
-
-	kapi := etcd.NewKeysAPI(client)
-
 	// Return EtcdWatcher
-	watcher := &EtcdWatcher{
-		prefix:  er.prefix,
-		srvName: er.ServiceName,
-		client:  &client,
-		kapi:    kapi,
-		addrs:   nil,
-	}
-	return watcher, nil
+	return newEtcdWatcher(store, er.prefix, er.ServiceName, er.store == nil), nil
 }
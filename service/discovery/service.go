@@ -2,10 +2,17 @@ package discovery
 
 import (
 	"encoding/json"
+	"fmt"
 	"log"
+	"sync"
 	"sync/atomic"
 )
 
+const (
+	// DefaultWeight of a Service without weight
+	DefaultWeight = 1
+)
+
 // Service to register
 type Service struct {
 	ID   uint64 `json:"id"`
@@ -13,8 +20,22 @@ type Service struct {
 	Host string `json:"host"`
 	Port int    `json:"port"`
 
-	lastIndex uint64
-	quit      chan struct{}
+	Version  string `json:"version,omitempty"`
+	Zone     string `json:"zone,omitempty"`
+	Protocol string `json:"protocol,omitempty"`
+	// Weight is relative to the other instances of the service, DefaultWeight if it is not positive
+	Weight int      `json:"weight,omitempty"`
+	Tags   []string `json:"tags,omitempty"`
+	// Metadata is free-form information of the instance
+	Metadata map[string]string `json:"metadata,omitempty"`
+
+	lease int64
+
+	// regMu serializes registering and unregistering
+	regMu   sync.Mutex
+	mu      sync.Mutex
+	stopped bool
+	quit    chan struct{}
 }
 
 // NewService returns a new Service
@@ -23,24 +44,85 @@ func NewService(name, host string, port int) *Service {
 		Name: name,
 		Host: host,
 		Port: port,
-		quit: make(chan struct{}, 1),
+		quit: make(chan struct{}),
 	}
 }
 
-// Stop stops the heartbeat
+// Stop stops the heartbeat. It is safe to call Stop more than once.
 func (srv *Service) Stop() {
-	var s struct{}
-	srv.quit <- s
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+
+	if srv.stopped {
+		return
+	}
+	srv.stopped = true
+	close(srv.quitLocked())
 }
 
-//SetIndex sets lastIndex
-func (srv *Service) SetIndex(index uint64) {
-	atomic.StoreUint64(&srv.lastIndex, index)
+// Stopped tells if the service is stopped
+func (srv *Service) Stopped() bool {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	return srv.stopped
+}
+
+// done returns the channel which is closed when the service is stopped
+func (srv *Service) done() <-chan struct{} {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	return srv.quitLocked()
+}
+
+// start makes a stopped service able to be kept alive again
+func (srv *Service) start() {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+
+	if srv.stopped {
+		srv.stopped = false
+		srv.quit = make(chan struct{})
+	}
+}
+
+func (srv *Service) quitLocked() chan struct{} {
+	if srv.quit == nil {
+		srv.quit = make(chan struct{})
+	}
+	return srv.quit
+}
+
+// SetLease sets the lease which the registered key is attached to
+func (srv *Service) SetLease(lease LeaseID) {
+	atomic.StoreInt64(&srv.lease, int64(lease))
+}
+
+// GetLease gets the lease which the registered key is attached to
+func (srv *Service) GetLease() LeaseID {
+	return LeaseID(atomic.LoadInt64(&srv.lease))
+}
+
+// GetWeight returns Weight, or DefaultWeight if it is not positive
+func (srv *Service) GetWeight() int {
+	if srv.Weight <= 0 {
+		return DefaultWeight
+	}
+	return srv.Weight
+}
+
+// HasTag tells if the service is tagged with tag
+func (srv *Service) HasTag(tag string) bool {
+	for _, t := range srv.Tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
 }
 
-// GetIndex get lastIndex
-func (srv *Service) GetIndex() uint64 {
-	return atomic.LoadUint64(&srv.lastIndex)
+// Addr returns the address in format as host:port
+func (srv *Service) Addr() string {
+	return fmt.Sprintf("%s:%d", srv.Host, srv.Port)
 }
 
 func (srv *Service) String() string {
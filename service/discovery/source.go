@@ -0,0 +1,155 @@
+package discovery
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+
+	"google.golang.org/grpc/attributes"
+	"google.golang.org/grpc/resolver"
+)
+
+// Update carries the instances of a service sent by Source
+type Update struct {
+	Services []*Service
+	// Err is set if the instances can not be fetched
+	Err error
+}
+
+// Source provides the instances of services to resolvers
+type Source interface {
+	// Watch sends the instances of service name at first and whenever they change, until ctx is done.
+	// If fetching fails, an Update with Err is sent and Source keeps retrying.
+	Watch(ctx context.Context, name string) <-chan Update
+}
+
+var _ resolver.Builder = &SourceBuilder{}
+
+// SourceBuilder is the grpc resolver.Builder of Source. As EtcdBuilder, the endpoint of target is
+// the service name followed by an optional query of conditions, as in "file:///hello?zone=bj".
+type SourceBuilder struct {
+	scheme string
+	Source Source
+	// Filter is applied to the instances of every target
+	Filter Filter
+	// Zone of the client, preferred by the zone_aware balancer
+	Zone string
+}
+
+// NewSourceBuilder returns SourceBuilder resolving targets of scheme by source
+func NewSourceBuilder(scheme string, source Source) *SourceBuilder {
+	return &SourceBuilder{scheme: scheme, Source: source}
+}
+
+// Scheme implements resolver.Builder
+func (b *SourceBuilder) Scheme() string {
+	return b.scheme
+}
+
+// Build implements resolver.Builder
+func (b *SourceBuilder) Build(target resolver.Target, cc resolver.ClientConn, opts resolver.BuildOptions) (resolver.Resolver, error) {
+	srvName, filter, err := parseEndpoint(target.Endpoint)
+	if err != nil {
+		return nil, err
+	}
+	if len(srvName) == 0 {
+		return nil, fmt.Errorf("discovery: no service name in target %+v", target)
+	}
+
+	return startResolver(cc, b.Source, srvName, And(b.Filter, filter), b.Zone, nil), nil
+}
+
+// sourceResolver pushes the instances sent by Source to grpc
+type sourceResolver struct {
+	cc      resolver.ClientConn
+	filter  Filter
+	zone    string
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+	onClose func()
+	// attrs of the last update, by the content of Service. Balancers track addresses by value,
+	// so unchanged instances keep their attributes to keep their connections.
+	attrs map[string]*attributes.Attributes
+}
+
+// startResolver resolves name by source. The zone of the client is carried by the addresses, for balancers.
+func startResolver(cc resolver.ClientConn, source Source, name string, filter Filter, zone string, onClose func()) *sourceResolver {
+	ctx, cancel := context.WithCancel(context.Background())
+	r := &sourceResolver{
+		cc:      cc,
+		filter:  filter,
+		zone:    zone,
+		cancel:  cancel,
+		onClose: onClose,
+	}
+
+	updates := source.Watch(ctx, name)
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		for u := range updates {
+			if u.Err != nil {
+				r.cc.ReportError(u.Err)
+				continue
+			}
+			r.update(u.Services)
+		}
+	}()
+
+	return r
+}
+
+// ResolveNow implements resolver.Resolver. Updates are pushed by Source, so it does nothing.
+func (r *sourceResolver) ResolveNow(resolver.ResolveNowOptions) {}
+
+// Close implements resolver.Resolver
+func (r *sourceResolver) Close() {
+	r.cancel()
+	r.wg.Wait()
+	if r.onClose != nil {
+		r.onClose()
+	}
+}
+
+func (r *sourceResolver) update(services []*Service) {
+	addrs := make([]resolver.Address, 0, len(services))
+	attrs := make(map[string]*attributes.Attributes, len(services))
+	for _, srv := range services {
+		if !r.filter(srv) {
+			continue
+		}
+		content := srv.String()
+		attr, ok := r.attrs[content]
+		if !ok {
+			attr = attributes.New(serviceKey{}, srv, zoneKey{}, r.zone)
+		}
+		attrs[content] = attr
+		addrs = append(addrs, resolver.Address{
+			Addr:       srv.Addr(),
+			Attributes: attr,
+		})
+	}
+	r.attrs = attrs
+	sort.Slice(addrs, func(i, j int) bool { return addrs[i].Addr < addrs[j].Addr })
+
+	r.cc.UpdateState(resolver.State{Addresses: addrs})
+}
+
+// sortServices sorts services by address
+func sortServices(services []*Service) {
+	sort.Slice(services, func(i, j int) bool { return services[i].Addr() < services[j].Addr() })
+}
+
+// sameServices tells if the sorted services are equal
+func sameServices(a, b []*Service) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].String() != b[i].String() {
+			return false
+		}
+	}
+	return true
+}
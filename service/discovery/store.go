@@ -0,0 +1,72 @@
+package discovery
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+var (
+	// ErrLeaseNotFound is returned when the lease has expired or been revoked
+	ErrLeaseNotFound = errors.New("discovery: lease not found")
+)
+
+// LeaseID identifies a lease in Store
+type LeaseID int64
+
+// NoLease is a lease ID for the absence of a lease
+const NoLease LeaseID = 0
+
+// EventType of watch events
+type EventType byte
+
+const (
+	// EventPut is sent when a key is created or updated
+	EventPut EventType = iota
+	// EventDelete is sent when a key is deleted or its lease expires
+	EventDelete
+)
+
+// KeyValue is a key and its value in Store
+type KeyValue struct {
+	Key         string
+	Value       string
+	ModRevision int64
+}
+
+// Event is a change of a key
+type Event struct {
+	Type EventType
+	KeyValue
+}
+
+// WatchResponse carries the events of one revision, or an error which ends the watch
+type WatchResponse struct {
+	Events   []Event
+	Revision int64
+	Err      error
+}
+
+// Store is the key-value registry with leases used by EtcdPublisher and EtcdResolver.
+// It is implemented by EtcdStore with etcd v3 and by MemoryStore in memory.
+type Store interface {
+	// Grant creates a lease which expires after ttl unless it is kept alive
+	Grant(ctx context.Context, ttl time.Duration) (LeaseID, error)
+	// KeepAlive keeps the lease alive until ctx is done. The returned channel is closed
+	// when keeping alive stops, because ctx is done or the lease is lost.
+	KeepAlive(ctx context.Context, id LeaseID) (<-chan struct{}, error)
+	// Revoke the lease, and delete the keys attached to it
+	Revoke(ctx context.Context, id LeaseID) error
+	// Put value at key, attached to lease unless lease is NoLease
+	Put(ctx context.Context, key, value string, lease LeaseID) error
+	// Delete key
+	Delete(ctx context.Context, key string) error
+	// List returns the key-values under prefix and the current revision of store
+	List(ctx context.Context, prefix string) ([]KeyValue, int64, error)
+	// Watch sends the changes under prefix since revision rev until ctx is done
+	Watch(ctx context.Context, prefix string, rev int64) <-chan WatchResponse
+	// Incr increases the integer at key by one in a transaction and returns the new value
+	Incr(ctx context.Context, key string) (int64, error)
+	// Close the store
+	Close() error
+}
@@ -1,133 +1,183 @@
 package discovery
 
 import (
+	"context"
 	"encoding/json"
 	"strings"
+)
 
-	"fmt"
+// AddrOp is the operation of an AddrUpdate
+type AddrOp uint8
 
-	etcd "github.com/coreos/etcd/client"
-	"golang.org/x/net/context"
-	"google.golang.org/grpc/naming"
+const (
+	// AddrAdd is an address added to the service
+	AddrAdd AddrOp = iota
+	// AddrDelete is an address removed from the service
+	AddrDelete
 )
 
-// EtcdWatcher is the implementaion of grpc.naming.Watcher
+// AddrUpdate is a change of the addresses of a service, as the grpc.naming.Update which newer grpc
+// releases have removed
+type AddrUpdate struct {
+	Op   AddrOp
+	Addr string
+}
+
+// EtcdWatcher watches the addresses of a service, as the former grpc.naming.Watcher
+//
+// Deprecated: grpc.naming is removed in newer grpc releases, use EtcdBuilder instead.
 type EtcdWatcher struct {
 	prefix  string
 	srvName string
-	client  *etcd.Client
-	kapi    etcd.KeysAPI
-	addrs   []string
+	store   Store
+	// closeStore tells if store is owned by the watcher
+	closeStore bool
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	events <-chan WatchResponse
+	// addrs maps keys to addresses
+	addrs map[string]string
 }
 
-// Close do nothing
+func newEtcdWatcher(store Store, prefix, srvName string, closeStore bool) *EtcdWatcher {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &EtcdWatcher{
+		prefix:     prefix,
+		srvName:    srvName,
+		store:      store,
+		closeStore: closeStore,
+		ctx:        ctx,
+		cancel:     cancel,
+	}
+}
+
+// Close stops watching
 func (ew *EtcdWatcher) Close() {
+	ew.cancel()
+	if ew.closeStore {
+		ew.store.Close()
+	}
 }
 
 // Next to return the updates
-func (ew *EtcdWatcher) Next() ([]*naming.Update, error) {
+func (ew *EtcdWatcher) Next() ([]*AddrUpdate, error) {
 	dirKey := getDir(ew.prefix, ew.srvName)
 
 	// ew.addrs is nil means it is intially called
 	// first time query return instantlly
 	if ew.addrs == nil {
-		// query addresses from etcd
-		resp, _ := ew.kapi.Get(context.Background(), dirKey, &etcd.GetOptions{Recursive: true})
-		addrs := ew.extractAddrs(resp)
-		ew.addrs = addrs
-
-		if addrs != nil {
-			return getUpdates([]string{}, addrs), nil
+		kvs, rev, err := ew.store.List(ew.ctx, dirKey)
+		if err != nil {
+			return nil, err
 		}
-	}
 
-	// after first time, use Watcher to block until changes happen
-	// generate etcd Watcher
-	w := ew.kapi.Watcher(dirKey, &etcd.WatcherOptions{Recursive: true})
-	for {
-		_, err := w.Next(context.Background())
-		if err == nil {
-			// query addresses from etcd
-			resp, err := ew.kapi.Get(context.Background(), dirKey, &etcd.GetOptions{Recursive: true})
-			if err != nil {
-				continue
-			}
-			addrs := ew.extractAddrs(resp)
-
-			updates := getUpdates(ew.addrs, addrs)
-			// update ew.addrs
-			ew.addrs = addrs
-			// if addrs updated, return it
-			if len(updates) > 0 {
-				return updates, nil
+		ew.addrs = make(map[string]string)
+		for _, kv := range kvs {
+			if addr, ok := extractAddr(kv); ok {
+				ew.addrs[kv.Key] = addr
 			}
 		}
-	}
-}
+		// watch the changes after the listed revision
+		ew.events = ew.store.Watch(ew.ctx, dirKey, rev+1)
 
-// helper function to extract addrs rom etcd response
-func (ew *EtcdWatcher) extractAddrs(resp *etcd.Response) (addrs []string) {
-	if resp == nil || resp.Node == nil || resp.Node.Nodes == nil {
-		return nil
+		if len(ew.addrs) > 0 {
+			return getUpdates(nil, addrList(ew.addrs)), nil
+		}
 	}
 
-	if len(resp.Node.Nodes) == 0 {
-		ew.dropEmptyDir(resp.Node.Key)
-		return nil
-	}
+	// after first time, block until changes happen
+	for {
+		resp, ok := <-ew.events
+		if !ok {
+			return nil, ew.ctx.Err()
+		}
+		if resp.Err != nil {
+			return nil, resp.Err
+		}
 
-	for _, node := range resp.Node.Nodes {
-		if !node.Dir && !stringEndsWith(node.Key, "ID") {
-			service := new(Service)
-			if err := json.Unmarshal([]byte(node.Value), service); err == nil {
-				addrs = append(addrs, fmt.Sprintf("%s:%d", service.Host, service.Port))
+		old := addrList(ew.addrs)
+		for _, ev := range resp.Events {
+			switch ev.Type {
+			case EventPut:
+				if addr, ok := extractAddr(ev.KeyValue); ok {
+					ew.addrs[ev.Key] = addr
+				}
+			case EventDelete:
+				delete(ew.addrs, ev.Key)
 			}
-		} else {
+		}
 
+		// if addrs updated, return it
+		if updates := getUpdates(old, addrList(ew.addrs)); len(updates) > 0 {
+			return updates, nil
 		}
 	}
+}
 
-	return
+// helper function to extract addr from a registered key
+func extractAddr(kv KeyValue) (string, bool) {
+	service, ok := parseService(kv)
+	if !ok {
+		return "", false
+	}
+	return service.Addr(), true
 }
 
-func (ew *EtcdWatcher) dropEmptyDir(emptyDir string) {
-	if len(emptyDir) == 0 {
-		return
+// parseService parses the Service registered at kv
+func parseService(kv KeyValue) (*Service, bool) {
+	if stringEndsWith(kv.Key, "/ID") {
+		return nil, false
 	}
 
-	_, err := ew.kapi.Delete(context.Background(), emptyDir, &etcd.DeleteOptions{Dir: false})
-	if err != nil {
+	service := new(Service)
+	if err := json.Unmarshal([]byte(kv.Value), service); err != nil {
+		return nil, false
 	}
+	return service, true
 }
 
-func getUpdates(old, new []string) []*naming.Update {
-	var updates []*naming.Update
+func addrList(addrs map[string]string) []string {
+	list := make([]string, 0, len(addrs))
+	for _, addr := range addrs {
+		if !containsString(list, addr) {
+			list = append(list, addr)
+		}
+	}
+	return list
+}
+
+func getUpdates(old, new []string) []*AddrUpdate {
+	var updates []*AddrUpdate
 
 	intersect := intersectString(old, new)
 
 	deleted := diffString(old, intersect)
 	for _, addr := range deleted {
-		update := &naming.Update{Op: naming.Delete, Addr: addr}
+		update := &AddrUpdate{Op: AddrDelete, Addr: addr}
 		updates = append(updates, update)
 	}
 
 	added := diffString(new, intersect)
 	for _, addr := range added {
-		update := &naming.Update{Op: naming.Add, Addr: addr}
+		update := &AddrUpdate{Op: AddrAdd, Addr: addr}
 		updates = append(updates, update)
 	}
 	return updates
 }
 
+func containsString(haystack []string, needle string) bool {
+	for _, v := range haystack {
+		if v == needle {
+			return true
+		}
+	}
+	return false
+}
+
 func intersectString(a, b []string) (i []string) {
 	for _, va := range a {
-		found := false
-		for _, vb := range b {
-			if va == vb {
-				found = true
-			}
-		}
-		if found {
+		if containsString(b, va) {
 			i = append(i, va)
 		}
 	}
@@ -138,14 +188,7 @@ func intersectString(a, b []string) (i []string) {
 // a has, b not have
 func diffString(a, b []string) (d []string) {
 	for _, va := range a {
-		found := false
-		for _, vb := range b {
-			if va == vb {
-				found = true
-			}
-		}
-
-		if !found {
+		if !containsString(b, va) {
 			d = append(d, va)
 		}
 	}
@@ -154,5 +197,5 @@ func diffString(a, b []string) (d []string) {
 }
 
 func stringEndsWith(haystack, needle string) bool {
-	return strings.LastIndex(haystack, needle) == len(haystack)-len(needle)
+	return strings.HasSuffix(haystack, needle)
 }
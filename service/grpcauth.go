@@ -0,0 +1,139 @@
+package service
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/silentred/toolkit/auth"
+	cfg "github.com/silentred/toolkit/config"
+	"github.com/silentred/toolkit/interceptor"
+	"google.golang.org/grpc/credentials"
+)
+
+// GrpcServerAuth returns the authenticator of gRPC servers configured by [grpc_auth], or nil if it is disabled
+func GrpcServerAuth(app Application) (*interceptor.Authenticator, error) {
+	config := app.GetConfig().GrpcAuth
+	if !config.Enable {
+		return nil, nil
+	}
+	if a, ok := app.Get("grpc.server.auth").(*interceptor.Authenticator); ok {
+		return a, nil
+	}
+
+	// tokens are refused without keys, as for mtls only
+	var verifier auth.Verifier
+	v, err := newJWTVerifier(config.JWT)
+	if err != nil {
+		return nil, err
+	}
+	if v != nil {
+		verifier = v
+	}
+
+	// methods require tokens unless the auth is declared
+	defaultAuth := config.Default
+	if len(defaultAuth) == 0 {
+		defaultAuth = auth.Token
+	}
+	if err := checkAuth(defaultAuth, "default"); err != nil {
+		return nil, err
+	}
+	policy := interceptor.AuthPolicy{
+		Default: interceptor.MethodAuth{Auth: defaultAuth, Scopes: config.Scopes},
+		Methods: make(map[string]interceptor.MethodAuth, len(config.Methods)),
+	}
+	for _, m := range config.Methods {
+		if len(m.Auth) == 0 {
+			m.Auth = defaultAuth
+		}
+		if err := checkAuth(m.Auth, m.Name); err != nil {
+			return nil, err
+		}
+		policy.Methods[m.Name] = interceptor.MethodAuth{Auth: m.Auth, Scopes: m.Scopes}
+	}
+
+	a := interceptor.NewAuthenticator(verifier, policy)
+	app.Set("grpc.server.auth", a, nil)
+	return a, nil
+}
+
+func checkAuth(a, name string) error {
+	switch a {
+	case auth.None, auth.Token, auth.MTLS, auth.Any:
+		return nil
+	}
+	return fmt.Errorf("unknown auth %q of %s", a, name)
+}
+
+// JWTVerifier returns the verifier of the tokens of web requests, configured by [jwt]
+func JWTVerifier(app Application) (*auth.JWTVerifier, error) {
+	if v, ok := app.Get("jwt.verifier").(*auth.JWTVerifier); ok {
+		return v, nil
+	}
+	v, err := newJWTVerifier(app.GetConfig().JWT)
+	if err != nil {
+		return nil, err
+	}
+	if v == nil {
+		return nil, fmt.Errorf("no secret or key in [jwt] to verify tokens")
+	}
+	app.Set("jwt.verifier", v, nil)
+	return v, nil
+}
+
+// newJWTVerifier returns nil if config has no secret or key
+func newJWTVerifier(config cfg.JWTConfig) (*auth.JWTVerifier, error) {
+	verifier := &auth.JWTVerifier{
+		Secret:   []byte(config.Secret),
+		Issuer:   config.Issuer,
+		Audience: config.Audience,
+		Leeway:   config.Leeway,
+
+		AllowNoExpiry: config.AllowNoExpiry,
+	}
+	if len(config.JWKS) > 0 {
+		verifier.Keys = auth.NewJWKS(config.JWKS, config.JWKSRefresh)
+	} else if len(config.PublicKeyFile) > 0 {
+		key, err := auth.LoadPublicKey(config.PublicKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		verifier.Keys = auth.PublicKey{PublicKey: key}
+	}
+	if len(verifier.Secret) == 0 && verifier.Keys == nil {
+		return nil, nil
+	}
+	return verifier, nil
+}
+
+// GrpcServerCredentials returns the TLS credentials of gRPC servers configured by [grpc_auth],
+// or nil if TLS is disabled. Client certificates are required and verified if ClientCAFile is set.
+func GrpcServerCredentials(app Application) (credentials.TransportCredentials, error) {
+	config := app.GetConfig().GrpcAuth
+	if !config.TLS {
+		return nil, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(config.CertFile, config.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+	tlsConfig := &tls.Config{Certificates: []tls.Certificate{cert}}
+
+	if len(config.ClientCAFile) > 0 {
+		pem, err := ioutil.ReadFile(config.ClientCAFile)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificate in %s", config.ClientCAFile)
+		}
+		tlsConfig.ClientCAs = pool
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	return credentials.NewTLS(tlsConfig), nil
+}
@@ -0,0 +1,48 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/silentred/toolkit/auth"
+	cfg "github.com/silentred/toolkit/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGrpcServerAuthDefault(t *testing.T) {
+	app := NewApp()
+	app.SetConfig(&cfg.AppConfig{GrpcAuth: cfg.GrpcAuthConfig{
+		Enable:  true,
+		JWT:     cfg.JWTConfig{Secret: "secret"},
+		Methods: []cfg.GrpcMethodAuth{{Name: "/pkg.Svc/Health", Auth: auth.None}, {Name: "/pkg.Svc/Admin", Scopes: []string{"admin"}}},
+	}})
+	a, err := GrpcServerAuth(&app)
+	if assert.NoError(t, err) {
+		// methods without auth require tokens
+		assert.Equal(t, auth.Token, a.Policy.Lookup("/pkg.Svc/Get").Auth)
+		assert.Equal(t, auth.Token, a.Policy.Lookup("/pkg.Svc/Admin").Auth)
+		assert.Equal(t, auth.None, a.Policy.Lookup("/pkg.Svc/Health").Auth)
+	}
+
+	app = NewApp()
+	app.SetConfig(&cfg.AppConfig{GrpcAuth: cfg.GrpcAuthConfig{Enable: true, Default: "tokne"}})
+	_, err = GrpcServerAuth(&app)
+	assert.Error(t, err)
+}
+
+func TestJWTVerifier(t *testing.T) {
+	app := newTestApp(t, &cfg.AppConfig{JWT: cfg.JWTConfig{Secret: "secret", Issuer: "test"}})
+	v, err := JWTVerifier(app)
+	if !assert.NoError(t, err) {
+		return
+	}
+	same, _ := JWTVerifier(app)
+	assert.True(t, v == same)
+
+	token, err := auth.Sign(auth.HS256, "", []byte("secret"), auth.Claims{"sub": "alice", "iss": "test", "exp": time.Now().Add(time.Minute).Unix()})
+	assert.NoError(t, err)
+	p, err := v.Verify(token)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "alice", p.Subject)
+	}
+}
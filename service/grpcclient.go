@@ -0,0 +1,308 @@
+package service
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"strings"
+	"sync"
+
+	"github.com/silentred/toolkit/auth"
+	"github.com/silentred/toolkit/breaker"
+	cfg "github.com/silentred/toolkit/config"
+	"github.com/silentred/toolkit/interceptor"
+	"github.com/silentred/toolkit/service/discovery"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/resolver"
+)
+
+var (
+	// DefaultGrpcBalancer is the load balancing policy of clients without Balancer
+	DefaultGrpcBalancer = discovery.WeightedRoundRobin
+)
+
+// GrpcClientManager holds the gRPC clients of the [[grpc_client]] sections.
+// Clients are dialed at initialization and closed on shutdown.
+type GrpcClientManager struct {
+	App     Application
+	Configs []cfg.GrpcClientConfig
+
+	mu    sync.RWMutex
+	conns map[string]*grpc.ClientConn
+	// builder resolves the service names of this manager
+	builder resolver.Builder
+	// store is closed with the clients if it is dialed by the manager
+	store discovery.Store
+}
+
+// NewGrpcClientManager dials the clients of configs. Dialing does not block, connections
+// are established in background.
+func NewGrpcClientManager(app Application, configs []cfg.GrpcClientConfig) (*GrpcClientManager, error) {
+	gm := &GrpcClientManager{
+		App:     app,
+		Configs: configs,
+		conns:   make(map[string]*grpc.ClientConn),
+	}
+
+	for _, config := range configs {
+		if len(config.Name) == 0 {
+			config.Name = config.Target
+		}
+		if _, ok := gm.conns[config.Name]; ok {
+			gm.Close()
+			return nil, fmt.Errorf("grpc client %s is duplicated", config.Name)
+		}
+
+		conn, err := gm.dial(config)
+		if err != nil {
+			gm.Close()
+			return nil, fmt.Errorf("grpc client %s: %v", config.Name, err)
+		}
+		gm.conns[config.Name] = conn
+	}
+
+	return gm, nil
+}
+
+// Conn returns the client of name
+func (gm *GrpcClientManager) Conn(name string) (*grpc.ClientConn, error) {
+	gm.mu.RLock()
+	defer gm.mu.RUnlock()
+
+	conn, ok := gm.conns[name]
+	if !ok {
+		return nil, fmt.Errorf("grpc client %s is not configured", name)
+	}
+	return conn, nil
+}
+
+// Close closes all the clients
+func (gm *GrpcClientManager) Close() error {
+	gm.mu.Lock()
+	defer gm.mu.Unlock()
+
+	var err error
+	for name, conn := range gm.conns {
+		if e := conn.Close(); e != nil && err == nil {
+			err = e
+		}
+		delete(gm.conns, name)
+	}
+	if gm.store != nil {
+		if e := gm.store.Close(); e != nil && err == nil {
+			err = e
+		}
+		gm.store = nil
+	}
+	return err
+}
+
+func (gm *GrpcClientManager) dial(config cfg.GrpcClientConfig) (*grpc.ClientConn, error) {
+	target, builder, err := gm.target(config.Target)
+	if err != nil {
+		return nil, err
+	}
+
+	balancer := config.Balancer
+	if len(balancer) == 0 {
+		balancer = DefaultGrpcBalancer
+	}
+
+	metrics, err := grpcClientMetrics(gm.App)
+	if err != nil {
+		return nil, err
+	}
+	var breakers *breaker.Group
+	if config.Breaker.Enable {
+		if breakers, err = NewBreakers(gm.App, "grpc/"+config.Name, config.Breaker); err != nil {
+			return nil, err
+		}
+	}
+	unary, err := gm.interceptors(config, metrics, breakers)
+	if err != nil {
+		return nil, err
+	}
+	stream := []grpc.StreamClientInterceptor{
+		interceptor.NewStreamClientRequestIDInterceptor(),
+		interceptor.NewStreamClientLogInterceptor(gm.App.DefaultLogger()),
+		metrics.StreamClientInterceptor(),
+	}
+	if breakers != nil {
+		stream = append(stream, interceptor.NewStreamClientBreakerInterceptor(breakers))
+	}
+	if gm.App.GetConfig().Otel.Enable {
+		stream = append([]grpc.StreamClientInterceptor{interceptor.NewStreamClientTracingInterceptor()}, stream...)
+	}
+	opts := []grpc.DialOption{
+		grpc.WithDefaultServiceConfig(fmt.Sprintf(`{"loadBalancingPolicy":%q}`, balancer)),
+		grpc.WithUnaryInterceptor(interceptor.UnaryClientInterceptorChain(unary...)),
+		grpc.WithStreamInterceptor(interceptor.StreamClientInterceptorChain(stream...)),
+	}
+	if builder != nil {
+		// the builder is not registered globally, so that apps in one process resolve by their own
+		opts = append(opts, grpc.WithResolvers(builder))
+	}
+	if config.TLS {
+		creds, err := clientCredentials(config)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, grpc.WithTransportCredentials(creds))
+	} else {
+		opts = append(opts, grpc.WithInsecure())
+	}
+	if creds := perRPCCredentials(config); creds != nil {
+		opts = append(opts, grpc.WithPerRPCCredentials(creds))
+	}
+
+	return grpc.Dial(target, opts...)
+}
+
+// interceptors are applied in order: tracing if otel is enabled, request ID, logging, metrics,
+// deadline, retries and circuit breaker. Every attempt is checked and counted by the breaker,
+// and retries stop when the circuit opens, as in util.HTTPClient.
+func (gm *GrpcClientManager) interceptors(config cfg.GrpcClientConfig, metrics *interceptor.ClientMetrics, breakers *breaker.Group) ([]grpc.UnaryClientInterceptor, error) {
+	var interceptors []grpc.UnaryClientInterceptor
+	if gm.App.GetConfig().Otel.Enable {
+		interceptors = append(interceptors, interceptor.NewClientTracingInterceptor())
+	}
+	interceptors = append(interceptors,
+		interceptor.NewClientRequestIDInterceptor(),
+		interceptor.NewClientLogInterceptor(gm.App.DefaultLogger()),
+		metrics.UnaryClientInterceptor(),
+	)
+	if config.Timeout > 0 || len(config.MethodTimeouts) > 0 {
+		interceptors = append(interceptors, interceptor.NewClientTimeouts(interceptor.Timeouts{
+			Default: config.Timeout,
+			Methods: config.MethodTimeouts,
+		}))
+	}
+	if config.Retries > 0 {
+		policy := interceptor.RetryPolicy{
+			Max:     config.Retries,
+			Backoff: config.RetryBackoff,
+			Jitter:  0.2,
+		}
+		for _, name := range config.RetryCodes {
+			code, ok := interceptor.ParseCode(name)
+			if !ok {
+				return nil, fmt.Errorf("unknown status code %q", name)
+			}
+			policy.Codes = append(policy.Codes, code)
+		}
+		if len(config.RetryMethods) == 0 {
+			return nil, fmt.Errorf("retries require retry_methods")
+		}
+		policy.Idempotent = interceptor.IdempotentMethods(config.RetryMethods...)
+		interceptors = append(interceptors, interceptor.NewClientRetryPolicy(policy))
+	}
+	if breakers != nil {
+		interceptors = append(interceptors, interceptor.NewClientBreakerInterceptor(breakers))
+	}
+	return interceptors, nil
+}
+
+// target returns the gRPC target of the configured one. Targets with scheme and addresses are
+// used as they are, others are service names resolved by the returned builder of the discovery
+// backend of the app.
+func (gm *GrpcClientManager) target(target string) (string, resolver.Builder, error) {
+	if strings.Contains(target, "://") {
+		return target, nil, nil
+	}
+	if _, _, err := net.SplitHostPort(target); err == nil {
+		return target, nil, nil
+	}
+
+	if gm.builder == nil {
+		config := gm.App.GetConfig().Discovery
+		store, _ := gm.App.Get("etcd.store").(discovery.Store)
+		if store == nil && config.BackendName() == cfg.BackendEtcd {
+			etcdStore, err := discovery.NewEtcdStore(config.Endpoints)
+			if err != nil {
+				return "", nil, err
+			}
+			store, gm.store = etcdStore, etcdStore
+		}
+
+		builder, err := discovery.NewBuilderFromConfig(config, store)
+		if err != nil {
+			return "", nil, err
+		}
+		gm.builder = builder
+	}
+	return gm.builder.Scheme() + ":///" + target, gm.builder, nil
+}
+
+func clientCredentials(config cfg.GrpcClientConfig) (credentials.TransportCredentials, error) {
+	tlsConfig := &tls.Config{ServerName: config.ServerName}
+
+	if len(config.CAFile) > 0 {
+		pem, err := ioutil.ReadFile(config.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificate in %s", config.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if len(config.CertFile) > 0 || len(config.KeyFile) > 0 {
+		cert, err := tls.LoadX509KeyPair(config.CertFile, config.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return credentials.NewTLS(tlsConfig), nil
+}
+
+// perRPCCredentials returns the bearer tokens of config, or nil. The tokens require TLS unless
+// AuthInsecure is set, so dialing without TLS fails instead of sending them in plaintext.
+func perRPCCredentials(config cfg.GrpcClientConfig) credentials.PerRPCCredentials {
+	if len(config.Token) > 0 {
+		return auth.TokenCredentials{Token: config.Token, AllowInsecure: config.AuthInsecure}
+	}
+	if len(config.AuthSecret) > 0 {
+		creds := auth.NewHMACCredentials([]byte(config.AuthSecret), config.AuthSubject, config.AuthScopes...)
+		creds.AllowInsecure = config.AuthInsecure
+		return creds
+	}
+	return nil
+}
+
+// GrpcClient returns the client of name configured in [[grpc_client]]
+func GrpcClient(app Application, name string) (*grpc.ClientConn, error) {
+	gm, ok := app.Get("grpc.client").(*GrpcClientManager)
+	if !ok {
+		return nil, fmt.Errorf("grpc clients are not initialized")
+	}
+	return gm.Conn(name)
+}
+
+func initGrpcClients(app Application) error {
+	configs := app.GetConfig().GrpcClients
+	if len(configs) == 0 {
+		return nil
+	}
+
+	gm, err := NewGrpcClientManager(app, configs)
+	if err != nil {
+		return err
+	}
+	app.Set("grpc.client", gm, nil)
+
+	return nil
+}
+
+func closeGrpcClients(app Application) error {
+	if gm, ok := app.Get("grpc.client").(*GrpcClientManager); ok {
+		return gm.Close()
+	}
+	return nil
+}
@@ -0,0 +1,141 @@
+package service
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	cfg "github.com/silentred/toolkit/config"
+	"github.com/silentred/toolkit/service/discovery"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/resolver"
+)
+
+func TestGrpcClient(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if !assert.NoError(t, err) {
+		return
+	}
+	app := newTestApp(t, &cfg.AppConfig{})
+	metrics, err := GrpcServerMetrics(app)
+	if !assert.NoError(t, err) {
+		return
+	}
+	s := grpc.NewServer(grpc.UnaryInterceptor(metrics.UnaryServerInterceptor()))
+	healthpb.RegisterHealthServer(s, health.NewServer())
+	go s.Serve(l)
+	defer s.Stop()
+
+	store := discovery.NewMemoryStore()
+	p := discovery.NewEtcdPublisherWithStore(store, "", 10)
+	assert.NoError(t, p.Register(discovery.NewService("health", "127.0.0.1", l.Addr().(*net.TCPAddr).Port)))
+	app.Set("etcd.store", store, new(discovery.Store))
+
+	gm, err := NewGrpcClientManager(app, []cfg.GrpcClientConfig{
+		{Name: "discovered", Target: "health", Timeout: time.Second, Retries: 1, RetryMethods: []string{"/grpc.health.v1.Health/*"}},
+		{Name: "direct", Target: l.Addr().String()},
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer gm.Close()
+
+	for _, name := range []string{"discovered", "direct"} {
+		conn, err := gm.Conn(name)
+		if !assert.NoError(t, err, name) {
+			continue
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+		resp, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{}, grpc.WaitForReady(true))
+		cancel()
+		if assert.NoError(t, err, name) {
+			assert.Equal(t, healthpb.HealthCheckResponse_SERVING, resp.Status)
+		}
+	}
+	_, err = gm.Conn("missing")
+	assert.Error(t, err)
+
+	// the calls are recorded on the registry of app
+	body := metricsText(app)
+	assert.Contains(t, body, `grpc_server_handled_total{code="OK",method="/grpc.health.v1.Health/Check"} 2`)
+	assert.Contains(t, body, `grpc_client_handled_total{code="OK",method="/grpc.health.v1.Health/Check",target="`+l.Addr().String()+`"} 1`)
+}
+
+func TestGrpcClientRetryMethods(t *testing.T) {
+	app := newTestApp(t, &cfg.AppConfig{})
+	_, err := NewGrpcClientManager(app, []cfg.GrpcClientConfig{{Name: "direct", Target: "127.0.0.1:1", Retries: 2}})
+	assert.Error(t, err)
+}
+
+func TestGrpcClientTokens(t *testing.T) {
+	// tokens are refused without TLS, unless auth_insecure allows them
+	app := newTestApp(t, &cfg.AppConfig{})
+	for _, config := range []cfg.GrpcClientConfig{
+		{Name: "token", Target: "127.0.0.1:1", Token: "secret"},
+		{Name: "hmac", Target: "127.0.0.1:1", AuthSecret: "secret", AuthSubject: "svc"},
+	} {
+		_, err := NewGrpcClientManager(app, []cfg.GrpcClientConfig{config})
+		if assert.Error(t, err, config.Name) {
+			assert.Contains(t, err.Error(), "transport level security")
+		}
+	}
+
+	gm, err := NewGrpcClientManager(app, []cfg.GrpcClientConfig{
+		{Name: "insecure", Target: "127.0.0.1:1", Token: "secret", AuthInsecure: true},
+	})
+	if assert.NoError(t, err) {
+		gm.Close()
+	}
+}
+
+func TestGrpcClientResolvers(t *testing.T) {
+	// two apps in one process resolve the same name by their own stores
+	var addrs []string
+	var managers []*GrpcClientManager
+	for i := 0; i < 2; i++ {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		if !assert.NoError(t, err) {
+			return
+		}
+		s := grpc.NewServer()
+		healthpb.RegisterHealthServer(s, health.NewServer())
+		go s.Serve(l)
+		defer s.Stop()
+		addrs = append(addrs, l.Addr().String())
+
+		store := discovery.NewMemoryStore()
+		p := discovery.NewEtcdPublisherWithStore(store, "", 10)
+		assert.NoError(t, p.Register(discovery.NewService("health", "127.0.0.1", l.Addr().(*net.TCPAddr).Port)))
+
+		app := newTestApp(t, &cfg.AppConfig{})
+		app.Set("etcd.store", store, new(discovery.Store))
+		gm, err := NewGrpcClientManager(app, []cfg.GrpcClientConfig{{Name: "health", Target: "health"}})
+		if !assert.NoError(t, err) {
+			return
+		}
+		defer gm.Close()
+		managers = append(managers, gm)
+	}
+
+	// the builders are given to the connections, not registered globally
+	assert.Nil(t, resolver.Get(discovery.Scheme))
+
+	for i, gm := range managers {
+		conn, err := gm.Conn("health")
+		if !assert.NoError(t, err) {
+			continue
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+		var pr peer.Peer
+		_, err = healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{}, grpc.WaitForReady(true), grpc.Peer(&pr))
+		cancel()
+		if assert.NoError(t, err) {
+			assert.Equal(t, addrs[i], pr.Addr.String())
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package service
+
+import (
+	"fmt"
+	"sync"
+
+	cfg "github.com/silentred/toolkit/config"
+	"github.com/silentred/toolkit/util"
+)
+
+// DefaultHTTPClient is the name of the client which is also injected as *util.HTTPClient
+const DefaultHTTPClient = "default"
+
+// HTTPClientManager holds the HTTP clients configured in [[http_client]], each with its own transport
+type HTTPClientManager struct {
+	App     Application
+	Configs []cfg.HTTPClientConfig
+
+	mu      sync.RWMutex
+	clients map[string]*util.HTTPClient
+}
+
+// NewHTTPClientManager creates the clients of configs
+func NewHTTPClientManager(app Application, configs []cfg.HTTPClientConfig) (*HTTPClientManager, error) {
+	hm := &HTTPClientManager{
+		App:     app,
+		Configs: configs,
+		clients: make(map[string]*util.HTTPClient),
+	}
+
+	for _, config := range configs {
+		if len(config.Name) == 0 {
+			return nil, fmt.Errorf("http client has no name")
+		}
+		if _, ok := hm.clients[config.Name]; ok {
+			return nil, fmt.Errorf("http client %s is duplicated", config.Name)
+		}
+
+		var opts []util.HTTPClientOption
+		if config.Breaker.Enable {
+			breakers, err := NewBreakers(app, "http/"+config.Name, config.Breaker)
+			if err != nil {
+				return nil, err
+			}
+			opts = append(opts, util.WithBreakers(breakers))
+		}
+		client, err := util.NewHTTPClientFromConfig(config, opts...)
+		if err != nil {
+			return nil, fmt.Errorf("http client %s: %v", config.Name, err)
+		}
+		hm.clients[config.Name] = client
+	}
+
+	return hm, nil
+}
+
+// Client returns the client of name
+func (hm *HTTPClientManager) Client(name string) (*util.HTTPClient, error) {
+	hm.mu.RLock()
+	defer hm.mu.RUnlock()
+
+	client, ok := hm.clients[name]
+	if !ok {
+		return nil, fmt.Errorf("http client %s is not configured", name)
+	}
+	return client, nil
+}
+
+// Close closes the idle connections of all the clients
+func (hm *HTTPClientManager) Close() error {
+	hm.mu.Lock()
+	defer hm.mu.Unlock()
+
+	for name, client := range hm.clients {
+		client.CloseIdleConnections()
+		delete(hm.clients, name)
+	}
+	return nil
+}
+
+// HTTPClient returns the client of name configured in [[http_client]]
+func HTTPClient(app Application, name string) (*util.HTTPClient, error) {
+	hm, ok := app.Get("http.client").(*HTTPClientManager)
+	if !ok {
+		return nil, fmt.Errorf("http clients are not initialized")
+	}
+	return hm.Client(name)
+}
+
+func initHTTPClients(app Application) error {
+	configs := app.GetConfig().HTTPClients
+	if len(configs) == 0 {
+		return nil
+	}
+
+	hm, err := NewHTTPClientManager(app, configs)
+	if err != nil {
+		return err
+	}
+	app.Set("http.client", hm, nil)
+	if client, err := hm.Client(DefaultHTTPClient); err == nil {
+		app.Set("http.client."+DefaultHTTPClient, client, nil)
+	}
+
+	return nil
+}
+
+func closeHTTPClients(app Application) error {
+	if hm, ok := app.Get("http.client").(*HTTPClientManager); ok {
+		return hm.Close()
+	}
+	return nil
+}
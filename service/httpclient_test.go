@@ -0,0 +1,50 @@
+package service
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	cfg "github.com/silentred/toolkit/config"
+	"github.com/silentred/toolkit/util"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHTTPClients(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.URL.Path))
+	}))
+	defer server.Close()
+
+	app := newTestApp(t, &cfg.AppConfig{HTTPClients: []cfg.HTTPClientConfig{
+		{Name: DefaultHTTPClient, Timeout: 5 * time.Second, MaxConnsPerHost: 2},
+		{Name: "payment", Timeout: time.Second, Proxy: "direct", Breaker: cfg.BreakerConfig{Enable: true}},
+	}})
+	if !assert.NoError(t, initHTTPClients(app)) {
+		return
+	}
+	defer closeHTTPClients(app)
+
+	payment, err := HTTPClient(app, "payment")
+	if assert.NoError(t, err) {
+		req, _ := util.NewHTTPReqeust(http.MethodGet, server.URL+"/pay", nil, nil, nil)
+		body, code, err := payment.Do(req)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, code)
+		assert.Equal(t, "/pay", string(body))
+	}
+	_, err = HTTPClient(app, "missing")
+	assert.Error(t, err)
+
+	// the default client is injected
+	var consumer struct {
+		Client *util.HTTPClient     `inject:"http.client.default"`
+		Iface  util.HTTPClientIface `inject:"http.client.default"`
+	}
+	if assert.NoError(t, app.Inject(&consumer)) {
+		client, _ := HTTPClient(app, DefaultHTTPClient)
+		assert.True(t, consumer.Client == client)
+		assert.NotNil(t, consumer.Iface)
+	}
+}
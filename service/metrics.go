@@ -0,0 +1,233 @@
+package service
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/silentred/toolkit/interceptor"
+	redis "gopkg.in/redis.v5"
+)
+
+var (
+	dbLabels = []string{"instance", "role"}
+
+	mysqlMaxOpenDesc = prometheus.NewDesc("mysql_max_open_connections",
+		"maximum number of open connections to the database", dbLabels, nil)
+	mysqlOpenDesc = prometheus.NewDesc("mysql_open_connections",
+		"number of established connections both in use and idle", dbLabels, nil)
+	mysqlInUseDesc = prometheus.NewDesc("mysql_in_use_connections",
+		"number of connections currently in use", dbLabels, nil)
+	mysqlIdleDesc = prometheus.NewDesc("mysql_idle_connections",
+		"number of idle connections", dbLabels, nil)
+	mysqlWaitCountDesc = prometheus.NewDesc("mysql_wait_count_total",
+		"total number of connections waited for", dbLabels, nil)
+	mysqlWaitDurationDesc = prometheus.NewDesc("mysql_wait_duration_seconds_total",
+		"total time blocked waiting for a new connection in second", dbLabels, nil)
+
+	redisRequestsDesc = prometheus.NewDesc("redis_pool_requests_total",
+		"number of times a connection was requested by the pool", dbLabels, nil)
+	redisHitsDesc = prometheus.NewDesc("redis_pool_hits_total",
+		"number of times free connection was found in the pool", dbLabels, nil)
+	redisTimeoutsDesc = prometheus.NewDesc("redis_pool_timeouts_total",
+		"number of times a wait timeout occurred", dbLabels, nil)
+	redisTotalConnsDesc = prometheus.NewDesc("redis_pool_total_connections",
+		"number of total connections in the pool", dbLabels, nil)
+	redisFreeConnsDesc = prometheus.NewDesc("redis_pool_free_connections",
+		"number of free connections in the pool", dbLabels, nil)
+)
+
+// MySQLCollector exports sql.DBStats of every database in MysqlManager
+type MySQLCollector struct {
+	mm *MysqlManager
+}
+
+// NewMySQLCollector returns a prometheus.Collector for the MysqlManager
+func NewMySQLCollector(mm *MysqlManager) *MySQLCollector {
+	return &MySQLCollector{mm: mm}
+}
+
+// Describe implements prometheus.Collector
+func (c *MySQLCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- mysqlMaxOpenDesc
+	ch <- mysqlOpenDesc
+	ch <- mysqlInUseDesc
+	ch <- mysqlIdleDesc
+	ch <- mysqlWaitCountDesc
+	ch <- mysqlWaitDurationDesc
+}
+
+// Collect implements prometheus.Collector
+func (c *MySQLCollector) Collect(ch chan<- prometheus.Metric) {
+	for name, engine := range c.mm.databases {
+		role := c.mm.role(name)
+		stats := engine.DB().Stats()
+		ch <- prometheus.MustNewConstMetric(mysqlMaxOpenDesc, prometheus.GaugeValue, float64(stats.MaxOpenConnections), name, role)
+		ch <- prometheus.MustNewConstMetric(mysqlOpenDesc, prometheus.GaugeValue, float64(stats.OpenConnections), name, role)
+		ch <- prometheus.MustNewConstMetric(mysqlInUseDesc, prometheus.GaugeValue, float64(stats.InUse), name, role)
+		ch <- prometheus.MustNewConstMetric(mysqlIdleDesc, prometheus.GaugeValue, float64(stats.Idle), name, role)
+		ch <- prometheus.MustNewConstMetric(mysqlWaitCountDesc, prometheus.CounterValue, float64(stats.WaitCount), name, role)
+		ch <- prometheus.MustNewConstMetric(mysqlWaitDurationDesc, prometheus.CounterValue, stats.WaitDuration.Seconds(), name, role)
+	}
+}
+
+// RedisCollector exports the pool stats of redis clients
+type RedisCollector struct {
+	clients map[string]*redis.Client
+	roles   map[string]string
+}
+
+// NewRedisCollector returns an empty RedisCollector
+func NewRedisCollector() *RedisCollector {
+	return &RedisCollector{
+		clients: make(map[string]*redis.Client),
+		roles:   make(map[string]string),
+	}
+}
+
+// Add a redis client with instance name and role
+func (c *RedisCollector) Add(name, role string, client *redis.Client) {
+	c.clients[name] = client
+	c.roles[name] = role
+}
+
+// Describe implements prometheus.Collector
+func (c *RedisCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- redisRequestsDesc
+	ch <- redisHitsDesc
+	ch <- redisTimeoutsDesc
+	ch <- redisTotalConnsDesc
+	ch <- redisFreeConnsDesc
+}
+
+// Collect implements prometheus.Collector
+func (c *RedisCollector) Collect(ch chan<- prometheus.Metric) {
+	for name, client := range c.clients {
+		role := c.roles[name]
+		stats := client.PoolStats()
+		ch <- prometheus.MustNewConstMetric(redisRequestsDesc, prometheus.CounterValue, float64(stats.Requests), name, role)
+		ch <- prometheus.MustNewConstMetric(redisHitsDesc, prometheus.CounterValue, float64(stats.Hits), name, role)
+		ch <- prometheus.MustNewConstMetric(redisTimeoutsDesc, prometheus.CounterValue, float64(stats.Timeouts), name, role)
+		ch <- prometheus.MustNewConstMetric(redisTotalConnsDesc, prometheus.GaugeValue, float64(stats.TotalConns), name, role)
+		ch <- prometheus.MustNewConstMetric(redisFreeConnsDesc, prometheus.GaugeValue, float64(stats.FreeConns), name, role)
+	}
+}
+
+// NewMySQLQueryDuration returns the histogram mysql_query_duration_seconds of MetricsQueryHook
+func NewMySQLQueryDuration() *prometheus.HistogramVec {
+	return prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "mysql_query_duration_seconds",
+		Help:    "latency of mysql statements in second",
+		Buckets: []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5},
+	}, []string{"instance", "role", "operation"})
+}
+
+// MetricsQueryHook records the latency of statements into Duration, made by NewMySQLQueryDuration
+type MetricsQueryHook struct {
+	Duration *prometheus.HistogramVec
+}
+
+// BeforeQuery implements QueryHook
+func (h MetricsQueryHook) BeforeQuery(ctx context.Context, event *QueryEvent) context.Context {
+	return ctx
+}
+
+// AfterQuery implements QueryHook
+func (h MetricsQueryHook) AfterQuery(ctx context.Context, event *QueryEvent) {
+	h.Duration.WithLabelValues(event.Instance, event.Role, event.Operation).Observe(event.Duration.Seconds())
+}
+
+// mysqlQueryDuration returns the histogram of the statements of app
+func mysqlQueryDuration(app Application) (*prometheus.HistogramVec, error) {
+	if h, ok := app.Get("mysql.query.duration").(*prometheus.HistogramVec); ok {
+		return h, nil
+	}
+	h := NewMySQLQueryDuration()
+	if err := registerCollector(app, h); err != nil {
+		return nil, err
+	}
+	app.Set("mysql.query.duration", h, nil)
+	return h, nil
+}
+
+// registerCollector registers c to the registry of app. Registering the same collector twice is not
+// an error, but another collector of the same metrics is.
+func registerCollector(app Application, c prometheus.Collector) error {
+	if err := app.MetricsRegistry().Register(c); err != nil {
+		if are, ok := err.(prometheus.AlreadyRegisteredError); !ok || are.ExistingCollector != c {
+			return err
+		}
+	}
+	return nil
+}
+
+// MetricsHandler serves the metrics of the registry of app, and of the default registry
+// where the Go runtime and process metrics are
+func MetricsHandler(app Application) http.Handler {
+	gatherers := prometheus.Gatherers{app.MetricsRegistry(), prometheus.DefaultGatherer}
+	return promhttp.HandlerFor(gatherers, promhttp.HandlerOpts{})
+}
+
+// GrpcServerMetrics returns the metrics interceptors of gRPC servers, registered to the registry of app
+func GrpcServerMetrics(app Application) (*interceptor.ServerMetrics, error) {
+	if m, ok := app.Get("grpc.server.metrics").(*interceptor.ServerMetrics); ok {
+		return m, nil
+	}
+	m := interceptor.NewServerMetrics()
+	if err := registerCollector(app, m); err != nil {
+		return nil, err
+	}
+	app.Set("grpc.server.metrics", m, nil)
+	return m, nil
+}
+
+// grpcClientMetrics returns the metrics interceptors shared by the gRPC clients of app
+func grpcClientMetrics(app Application) (*interceptor.ClientMetrics, error) {
+	if m, ok := app.Get("grpc.client.metrics").(*interceptor.ClientMetrics); ok {
+		return m, nil
+	}
+	m := interceptor.NewClientMetrics()
+	if err := registerCollector(app, m); err != nil {
+		return nil, err
+	}
+	app.Set("grpc.client.metrics", m, nil)
+	return m, nil
+}
+
+// serveMetrics serves MetricsHandler at MetricsAddr, if it is configured
+func serveMetrics(app Application) error {
+	addr := app.GetConfig().MetricsAddr
+	if len(addr) == 0 {
+		return nil
+	}
+
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", MetricsHandler(app))
+	server := &http.Server{Handler: mux}
+	app.Set("metrics.server", server, nil)
+
+	logger := app.DefaultLogger()
+	go func() {
+		if err := server.Serve(l); err != nil && err != http.ErrServerClosed {
+			logger.Errorf("serving metrics: %v", err)
+		}
+	}()
+	logger.Infof("serving metrics at %s", l.Addr())
+	return nil
+}
+
+func closeMetrics(app Application) error {
+	if server, ok := app.Get("metrics.server").(*http.Server); ok {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		return server.Shutdown(ctx)
+	}
+	return nil
+}
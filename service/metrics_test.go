@@ -0,0 +1,84 @@
+package service
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	cfg "github.com/silentred/toolkit/config"
+	"github.com/stretchr/testify/assert"
+	redis "gopkg.in/redis.v5"
+)
+
+func metricsText(app Application) string {
+	rec := httptest.NewRecorder()
+	MetricsHandler(app).ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	return rec.Body.String()
+}
+
+func TestMySQLMetrics(t *testing.T) {
+	// the statements of apps in one process are recorded by their own registries
+	var apps []*App
+	for i := 0; i < 2; i++ {
+		app := newTestApp(t, &cfg.AppConfig{Mysql: cfg.MysqlConfig{
+			InitMySQL: true,
+			Metrics:   true,
+			Instances: []cfg.MysqlInstance{
+				{Name: "master", Driver: "sqlite3", Db: fmt.Sprintf("file:metrics_%d?mode=memory&cache=shared", i)},
+				{Name: "replica", Driver: "sqlite3", Db: fmt.Sprintf("file:metrics_%d?mode=memory&cache=shared", i), ReadOnly: true},
+			},
+		}})
+		if !assert.NoError(t, initMySQL(app)) {
+			return
+		}
+		mm := app.Get("mysql").(*MysqlManager)
+		defer mm.Close()
+		apps = append(apps, app)
+	}
+
+	mm := apps[0].Get("mysql").(*MysqlManager)
+	_, err := mm.W().Exec("CREATE TABLE t (id INTEGER)")
+	assert.NoError(t, err)
+	_, err = mm.R().QueryString("SELECT 1")
+	assert.NoError(t, err)
+
+	body := metricsText(apps[0])
+	assert.Contains(t, body, `mysql_query_duration_seconds_count{instance="master",operation="create",role="master"} 1`)
+	assert.Contains(t, body, `mysql_query_duration_seconds_count{instance="replica",operation="select",role="replica"} 1`)
+	assert.Contains(t, body, `mysql_open_connections{instance="replica",role="replica"}`)
+	assert.NotContains(t, metricsText(apps[1]), `mysql_query_duration_seconds_count`)
+}
+
+func TestRedisMetrics(t *testing.T) {
+	mr, err := miniredis.Run()
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer mr.Close()
+
+	var port int
+	fmt.Sscanf(mr.Port(), "%d", &port)
+	app := newTestApp(t, &cfg.AppConfig{Redis: cfg.RedisConfig{
+		InitRedis:     true,
+		Metrics:       true,
+		RedisInstance: cfg.RedisInstance{Name: "cache", Host: mr.Host(), Port: port, ReadOnly: true},
+	}})
+	if !assert.NoError(t, initRedis(app)) {
+		return
+	}
+	client := app.Get("redis").(*redis.Client)
+	defer client.Close()
+	assert.NoError(t, client.Ping().Err())
+
+	assert.Contains(t, metricsText(app), `redis_pool_requests_total{instance="cache",role="replica"}`)
+}
+
+func TestRegisterCollector(t *testing.T) {
+	app := newTestApp(t, &cfg.AppConfig{})
+	c := NewMySQLQueryDuration()
+	assert.NoError(t, registerCollector(app, c))
+	assert.NoError(t, registerCollector(app, c))
+	// another collector of the same metrics is not dropped silently
+	assert.Error(t, registerCollector(app, NewMySQLQueryDuration()))
+}
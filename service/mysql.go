@@ -8,9 +8,9 @@ import (
 	"os"
 
 	_ "github.com/go-sql-driver/mysql"
-	"xorm.io/core"
 	"github.com/go-xorm/xorm"
 	"github.com/silentred/toolkit/config"
+	"xorm.io/core"
 )
 
 var (
@@ -79,13 +79,70 @@ func NewMysqlManager(app Application, config config.MysqlConfig) (*MysqlManager,
 func (mm *MysqlManager) newORM(mysql config.MysqlInstance) (*xorm.Engine, error) {
 	writer := mm.App.DefaultLogger().Output()
 	debug := mm.App.GetConfig().Mode == config.ModeDev
-	return NewXormEngine(mysql, writer, MySQLMaxIdle, MySQLMaxOpen, debug, mm.Config.Ping)
+	hooks, err := mm.queryHooks(mysql)
+	if err != nil {
+		return nil, err
+	}
+	return NewXormEngineWithHooks(mysql, writer, MySQLMaxIdle, MySQLMaxOpen, debug, mm.Config.Ping, hooks...)
+}
+
+// queryHooks returns the hooks of instance enabled by config
+func (mm *MysqlManager) queryHooks(instance config.MysqlInstance) ([]QueryHook, error) {
+	var hooks []QueryHook
+	if mm.Config.Metrics {
+		duration, err := mysqlQueryDuration(mm.App)
+		if err != nil {
+			return nil, err
+		}
+		hooks = append(hooks, MetricsQueryHook{Duration: duration})
+	}
+	if mm.Config.Trace {
+		hooks = append(hooks, TraceQueryHook{})
+	}
+	if mm.App.GetConfig().Otel.Enable {
+		hooks = append(hooks, OtelQueryHook{System: instance.DriverName()})
+	}
+	if mm.Config.SlowThreshold > 0 {
+		hooks = append(hooks, &SlowQueryHook{
+			Logger:     mm.App.DefaultLogger(),
+			Threshold:  mm.Config.SlowThreshold,
+			RedactArgs: mm.Config.RedactArgs,
+		})
+	}
+	return hooks, nil
+}
+
+// role returns the role of instance name in config
+func (mm *MysqlManager) role(name string) string {
+	for _, instance := range mm.Config.Instances {
+		if instance.Name == name {
+			return instance.Role()
+		}
+	}
+	return "unknown"
 }
 
+// NewXormEngine returns a xorm.Engine of the mysql instance
 func NewXormEngine(mysql config.MysqlInstance, logWriter io.Writer, idle, open int, debug, ping bool) (*xorm.Engine, error) {
+	return newXormEngine(mysql.DriverName(), mysql, logWriter, idle, open, debug, ping)
+}
+
+// NewXormEngineWithHooks returns a xorm.Engine of the mysql instance, whose statements run through hooks
+func NewXormEngineWithHooks(mysql config.MysqlInstance, logWriter io.Writer, idle, open int, debug, ping bool, hooks ...QueryHook) (*xorm.Engine, error) {
+	if len(hooks) == 0 {
+		return NewXormEngine(mysql, logWriter, idle, open, debug, ping)
+	}
+	driverName, err := HookDriver(mysql.DriverName(), mysql.Name, mysql.Role(), hooks...)
+	if err != nil {
+		return nil, err
+	}
+	return newXormEngine(driverName, mysql, logWriter, idle, open, debug, ping)
+}
+
+func newXormEngine(driverName string, mysql config.MysqlInstance, logWriter io.Writer, idle, open int, debug, ping bool) (*xorm.Engine, error) {
 	var output io.Writer = os.Stdout
 
-	orm, err := xorm.NewEngine("mysql", mysql.String())
+	orm, err := xorm.NewEngine(driverName, mysql.DSN())
 	if err != nil {
 		return nil, err
 	}
@@ -118,6 +175,17 @@ func NewXormEngine(mysql config.MysqlInstance, logWriter io.Writer, idle, open i
 	return orm, nil
 }
 
+// Close closes all the databases
+func (mm *MysqlManager) Close() error {
+	var err error
+	for _, engine := range mm.databases {
+		if e := engine.Close(); e != nil {
+			err = e
+		}
+	}
+	return err
+}
+
 // DB gets databases by name
 func (mm *MysqlManager) DB(name string) *xorm.Engine {
 	if engine, ok := mm.databases[name]; ok {
@@ -159,6 +227,12 @@ func initMySQL(app Application) error {
 			return err
 		}
 		app.Set("mysql", mm, nil)
+
+		if mm.Config.Metrics {
+			if err = registerCollector(app, NewMySQLCollector(mm)); err != nil {
+				return err
+			}
+		}
 	}
 	return nil
 }
@@ -0,0 +1,182 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	cfg "github.com/silentred/toolkit/config"
+	"github.com/silentred/toolkit/util"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	semconv "go.opentelemetry.io/otel/semconv/v1.4.0"
+	"go.opentelemetry.io/otel/trace"
+	redis "gopkg.in/redis.v5"
+)
+
+var (
+	// OtelShutdownTimeout is the timeout of flushing spans on shutdown
+	OtelShutdownTimeout = 5 * time.Second
+)
+
+// initOtel sets the global tracer provider configured by [otel], if it is enabled. An exporter
+// set as "otel.exporter" before initialization is used instead of the configured one.
+func initOtel(app Application) error {
+	config := app.GetConfig().Otel
+	if !config.Enable {
+		return nil
+	}
+
+	exporter, ok := app.Get("otel.exporter").(sdktrace.SpanExporter)
+	if !ok {
+		var (
+			file *os.File
+			err  error
+		)
+		if exporter, file, err = newSpanExporter(config); err != nil {
+			return err
+		}
+		app.Set("otel.exporter", exporter, new(sdktrace.SpanExporter))
+		if file != nil {
+			app.Set("otel.file", file, nil)
+		}
+	}
+
+	name := config.ServiceName
+	if len(name) == 0 {
+		name = app.GetConfig().Name
+	}
+	sampler := newSampler(config.SampleRatio)
+
+	opts := []sdktrace.TracerProviderOption{
+		sdktrace.WithResource(resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceNameKey.String(name))),
+		sdktrace.WithSampler(sdktrace.ParentBased(sampler)),
+	}
+	if _, ok := exporter.(*tracetest.InMemoryExporter); ok {
+		// spans are visible to tests as soon as they end
+		opts = append(opts, sdktrace.WithSyncer(exporter))
+	} else {
+		opts = append(opts, sdktrace.WithBatcher(exporter))
+	}
+	provider := sdktrace.NewTracerProvider(opts...)
+	otel.SetTracerProvider(provider)
+	app.Set("otel.provider", provider, nil)
+
+	return nil
+}
+
+// newSampler samples all the traces if ratio is nil or at least 1, and none if it is 0
+func newSampler(ratio *float64) sdktrace.Sampler {
+	switch {
+	case ratio == nil || *ratio >= 1:
+		return sdktrace.AlwaysSample()
+	case *ratio <= 0:
+		return sdktrace.NeverSample()
+	}
+	return sdktrace.TraceIDRatioBased(*ratio)
+}
+
+// shutdownOtel flushes the spans, shuts down the tracer provider and closes the file of spans
+func shutdownOtel(app Application) error {
+	provider, ok := app.Get("otel.provider").(*sdktrace.TracerProvider)
+	if !ok {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), OtelShutdownTimeout)
+	defer cancel()
+	err := provider.Shutdown(ctx)
+	if f, ok := app.Get("otel.file").(*os.File); ok {
+		if e := f.Close(); e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
+// newSpanExporter returns the exporter of config, and the file it writes to if there is one
+func newSpanExporter(config cfg.OtelConfig) (sdktrace.SpanExporter, *os.File, error) {
+	switch config.Exporter {
+	case "", cfg.ExporterStdout:
+		var (
+			w    io.Writer = os.Stdout
+			file *os.File
+		)
+		if len(config.File) > 0 {
+			f, err := os.OpenFile(config.File, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+			if err != nil {
+				return nil, nil, err
+			}
+			w, file = f, f
+		}
+		exporter, err := stdouttrace.New(stdouttrace.WithWriter(w))
+		if err != nil && file != nil {
+			file.Close()
+		}
+		return exporter, file, err
+	case cfg.ExporterMemory:
+		return tracetest.NewInMemoryExporter(), nil, nil
+	}
+	return nil, nil, fmt.Errorf("unknown otel exporter %q", config.Exporter)
+}
+
+// OtelQueryHook starts a span for every statement
+type OtelQueryHook struct {
+	// System is the db.system of spans, as mysql
+	System string
+}
+
+// BeforeQuery implements QueryHook
+func (h OtelQueryHook) BeforeQuery(ctx context.Context, event *QueryEvent) context.Context {
+	ctx, _ = util.StartSpan(ctx, "sql "+event.Operation, trace.SpanKindClient,
+		semconv.DBSystemKey.String(h.System),
+		semconv.DBNameKey.String(event.Instance),
+		semconv.DBOperationKey.String(event.Operation),
+		semconv.DBStatementKey.String(event.Query))
+	return ctx
+}
+
+// AfterQuery implements QueryHook
+func (OtelQueryHook) AfterQuery(ctx context.Context, event *QueryEvent) {
+	util.EndSpan(trace.SpanFromContext(ctx), event.Err)
+}
+
+// RedisWithContext returns a copy of client whose commands are traced as children of the span of ctx.
+// Commands of the copy run through the default process of redis, not the wrapped one of client.
+func RedisWithContext(ctx context.Context, client *redis.Client) *redis.Client {
+	c := client.WithContext(ctx)
+	c.WrapProcess(redisTracing(ctx))
+	return c
+}
+
+func redisTracing(ctx context.Context) func(func(redis.Cmder) error) func(redis.Cmder) error {
+	return func(process func(redis.Cmder) error) func(redis.Cmder) error {
+		return func(cmd redis.Cmder) error {
+			name := redisCommandName(cmd)
+			_, span := util.StartSpan(ctx, "redis "+name, trace.SpanKindClient,
+				semconv.DBSystemRedis,
+				semconv.DBOperationKey.String(name))
+			err := process(cmd)
+			if err == redis.Nil {
+				util.EndSpan(span, nil)
+			} else {
+				util.EndSpan(span, err)
+			}
+			return err
+		}
+	}
+}
+
+// redisCommandName returns the name of cmd, the first word of its string as "get foo: "
+func redisCommandName(cmd redis.Cmder) string {
+	fields := strings.Fields(cmd.String())
+	if len(fields) == 0 {
+		return ""
+	}
+	return strings.ToLower(strings.TrimSuffix(fields[0], ":"))
+}
@@ -0,0 +1,83 @@
+package service
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	cfg "github.com/silentred/toolkit/config"
+	"github.com/silentred/toolkit/util"
+	"github.com/stretchr/testify/assert"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	redis "gopkg.in/redis.v5"
+)
+
+func TestSampler(t *testing.T) {
+	ratio := func(r float64) *float64 { return &r }
+	assert.Equal(t, sdktrace.AlwaysSample().Description(), newSampler(nil).Description())
+	assert.Equal(t, sdktrace.NeverSample().Description(), newSampler(ratio(0)).Description())
+	assert.Equal(t, sdktrace.TraceIDRatioBased(0.5).Description(), newSampler(ratio(0.5)).Description())
+	assert.Equal(t, sdktrace.AlwaysSample().Description(), newSampler(ratio(1)).Description())
+}
+
+func TestOtelFile(t *testing.T) {
+	// the file of spans is closed on shutdown
+	file := filepath.Join(t.TempDir(), "spans.log")
+	app := newTestApp(t, &cfg.AppConfig{Otel: cfg.OtelConfig{Enable: true, File: file}})
+	assert.NoError(t, initOtel(app))
+	f, ok := app.Get("otel.file").(*os.File)
+	assert.True(t, ok)
+
+	assert.NoError(t, shutdownOtel(app))
+	_, err := f.Write([]byte("span"))
+	assert.ErrorIs(t, err, os.ErrClosed)
+}
+
+func TestTracing(t *testing.T) {
+	mr, err := miniredis.Run()
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer mr.Close()
+
+	app := newTestApp(t, &cfg.AppConfig{
+		Otel: cfg.OtelConfig{Enable: true, Exporter: cfg.ExporterMemory},
+		Mysql: cfg.MysqlConfig{
+			InitMySQL: true,
+			Instances: []cfg.MysqlInstance{{Name: "master", Driver: "sqlite3", Db: "file:tracing?mode=memory&cache=shared"}},
+		},
+	})
+	if !assert.NoError(t, initOtel(app)) || !assert.NoError(t, initMySQL(app)) {
+		return
+	}
+	defer shutdownOtel(app)
+	mm := app.Get("mysql").(*MysqlManager)
+	defer mm.Close()
+	spans := app.Get("otel.exporter").(*tracetest.InMemoryExporter)
+	cli := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	defer cli.Close()
+
+	ctx, span := util.StartSpan(context.Background(), "test", trace.SpanKindInternal)
+	_, err = mm.W().Context(ctx).Exec("CREATE TABLE t (id INTEGER)")
+	assert.NoError(t, err)
+	assert.NoError(t, RedisWithContext(ctx, cli).Set("foo", "bar", 0).Err())
+	span.End()
+	// commands without context are not traced
+	assert.NoError(t, cli.Get("foo").Err())
+
+	names := make(map[string]tracetest.SpanStub)
+	for _, s := range spans.GetSpans() {
+		assert.Equal(t, span.SpanContext().TraceID(), s.SpanContext.TraceID(), s.Name)
+		names[s.Name] = s
+	}
+	assert.Len(t, names, 3)
+	for _, name := range []string{"test", "sql create", "redis set"} {
+		if assert.Contains(t, names, name) && name != "test" {
+			assert.Equal(t, span.SpanContext().SpanID(), names[name].Parent.SpanID(), name)
+		}
+	}
+}
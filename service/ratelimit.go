@@ -0,0 +1,56 @@
+package service
+
+import (
+	"fmt"
+
+	cfg "github.com/silentred/toolkit/config"
+	"github.com/silentred/toolkit/ratelimit"
+	redis "gopkg.in/redis.v5"
+)
+
+// RateLimiter returns the limiter configured by [ratelimit]
+func RateLimiter(app Application) (ratelimit.Limiter, error) {
+	if l, ok := app.Get("ratelimit.limiter").(ratelimit.Limiter); ok {
+		return l, nil
+	}
+	l, err := NewRateLimiter(app, app.GetConfig().RateLimit)
+	if err != nil {
+		return nil, err
+	}
+	app.Set("ratelimit.limiter", l, new(ratelimit.Limiter))
+	return l, nil
+}
+
+// NewRateLimiter returns a limiter of config. The redis backend uses the redis of app.
+func NewRateLimiter(app Application, config cfg.RateLimitConfig) (ratelimit.Limiter, error) {
+	if config.Limit <= 0 || config.Period <= 0 {
+		return nil, fmt.Errorf("invalid rate limit %d per %v", config.Limit, config.Period)
+	}
+	rate := ratelimit.Rate{Limit: config.Limit, Period: config.Period, Burst: config.Burst}
+
+	algorithm := config.Algorithm
+	if len(algorithm) == 0 {
+		algorithm = cfg.LimiterTokenBucket
+	}
+	if algorithm != cfg.LimiterTokenBucket && algorithm != cfg.LimiterSlidingWindow {
+		return nil, fmt.Errorf("unknown rate limit algorithm %q", config.Algorithm)
+	}
+
+	switch config.Backend {
+	case "", cfg.LimiterLocal:
+		if algorithm == cfg.LimiterSlidingWindow {
+			return ratelimit.NewLocalSlidingWindow(rate), nil
+		}
+		return ratelimit.NewLocalTokenBucket(rate), nil
+	case cfg.LimiterRedis:
+		client, ok := app.Get("redis").(*redis.Client)
+		if !ok {
+			return nil, fmt.Errorf("redis is not initialized for rate limit")
+		}
+		if algorithm == cfg.LimiterSlidingWindow {
+			return ratelimit.NewRedisSlidingWindow(client, config.Prefix, rate), nil
+		}
+		return ratelimit.NewRedisTokenBucket(client, config.Prefix, rate), nil
+	}
+	return nil, fmt.Errorf("unknown rate limit backend %q", config.Backend)
+}
@@ -0,0 +1,46 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	cfg "github.com/silentred/toolkit/config"
+	"github.com/stretchr/testify/assert"
+	redis "gopkg.in/redis.v5"
+)
+
+func TestRateLimiter(t *testing.T) {
+	config := cfg.RateLimitConfig{Algorithm: cfg.LimiterSlidingWindow, Backend: cfg.LimiterRedis, Limit: 2, Period: time.Minute}
+	app := newTestApp(t, &cfg.AppConfig{RateLimit: config})
+	_, err := RateLimiter(app)
+	assert.Error(t, err)
+
+	mr, err := miniredis.Run()
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer mr.Close()
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	defer client.Close()
+	app.Set("redis", client, nil)
+
+	limiter, err := RateLimiter(app)
+	if !assert.NoError(t, err) {
+		return
+	}
+	same, _ := RateLimiter(app)
+	assert.True(t, limiter == same)
+	for i := 0; i < 2; i++ {
+		res, err := limiter.Allow("route")
+		assert.NoError(t, err)
+		assert.True(t, res.Allowed)
+	}
+	res, err := limiter.Allow("route")
+	assert.NoError(t, err)
+	assert.False(t, res.Allowed)
+
+	config.Limit = 0
+	_, err = NewRateLimiter(app, config)
+	assert.Error(t, err)
+}
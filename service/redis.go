@@ -26,8 +26,26 @@ func NewRedisClient(cfg config.RedisConfig) *redis.Client {
 
 func initRedis(app Application) error {
 	if app.GetConfig().Redis.InitRedis {
+		// commands are traced by the clients of RedisWithContext only, not as root spans
 		redis := NewRedisClient(app.GetConfig().Redis)
 		app.Set("redis", redis, nil)
+
+		if app.GetConfig().Redis.Metrics {
+			collector := NewRedisCollector()
+			instance := app.GetConfig().Redis.RedisInstance
+			collector.Add(redisInstanceName(instance), instance.Role(), redis)
+			if err := registerCollector(app, collector); err != nil {
+				return err
+			}
+		}
 	}
 	return nil
 }
+
+// redisInstanceName returns the name of instance, "default" if it is not named
+func redisInstanceName(inst config.RedisInstance) string {
+	if len(inst.Name) == 0 {
+		return "default"
+	}
+	return inst.Name
+}
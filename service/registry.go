@@ -0,0 +1,170 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"net"
+
+	cfg "github.com/silentred/toolkit/config"
+	"github.com/silentred/toolkit/service/discovery"
+	"github.com/silentred/toolkit/util"
+)
+
+var (
+	// DefaultDiscoveryTTL in second of the registered key
+	DefaultDiscoveryTTL = 10
+)
+
+// registrar keeps the app registered until it is stopped
+type registrar struct {
+	publisher discovery.Publisher
+	service   *discovery.Service
+	// store is closed after unregistering if it is dialed by the registrar
+	store discovery.Store
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// registerService registers the app at registry once the listener is up, if discovery is enabled
+func registerService(app Application) error {
+	config := app.GetConfig().Discovery
+	if !config.Enable {
+		return nil
+	}
+
+	l, ok := app.Get("listener").(net.Listener)
+	if !ok {
+		return fmt.Errorf("registering service: listener is not present")
+	}
+
+	var store, owned discovery.Store
+	if config.BackendName() == cfg.BackendEtcd {
+		var ok bool
+		if store, ok = app.Get("etcd.store").(discovery.Store); !ok {
+			etcdStore, err := discovery.NewEtcdStore(config.Endpoints)
+			if err != nil {
+				return err
+			}
+			store, owned = etcdStore, etcdStore
+		}
+	}
+	closeOwned := func() {
+		if owned != nil {
+			owned.Close()
+		}
+	}
+
+	if config.TTL <= 0 {
+		config.TTL = DefaultDiscoveryTTL
+	}
+	publisher, err := discovery.NewPublisherFromConfig(config, store)
+	if err != nil {
+		closeOwned()
+		return err
+	}
+	if err := app.Inject(publisher); err != nil {
+		closeOwned()
+		return err
+	}
+	if ep, ok := publisher.(*discovery.EtcdPublisher); ok {
+		logger := app.DefaultLogger()
+		ep.OnStateChange = func(ev discovery.StateEvent) {
+			logger.Infof("service %s at %s is %s", ev.Service.Name, ev.Service.Addr(), ev.State)
+		}
+	}
+
+	srv, err := newDiscoveryService(app.GetConfig(), l.Addr())
+	if err != nil {
+		closeOwned()
+		return err
+	}
+	if err = publisher.Register(srv); err != nil {
+		closeOwned()
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	r := &registrar{
+		publisher: publisher,
+		service:   srv,
+		store:     owned,
+		ctx:       ctx,
+		cancel:    cancel,
+		done:      make(chan struct{}),
+	}
+	app.Set("discovery.registrar", r, nil)
+	app.Set("discovery.service", srv, nil)
+	go r.keepalive()
+
+	return nil
+}
+
+// unregisterService removes the app from registry, before the server stops. Failures are logged
+// only, so that the server still stops gracefully; the lease of the app expires anyway.
+func unregisterService(app Application) error {
+	r, ok := app.Get("discovery.registrar").(*registrar)
+	if !ok {
+		return nil
+	}
+	r.cancel()
+	if err := r.publisher.Unregister(r.service); err != nil {
+		app.DefaultLogger().Errorf("unregistering service %s: %v", r.service.Name, err)
+	}
+	<-r.done
+	if r.store != nil {
+		if err := r.store.Close(); err != nil {
+			app.DefaultLogger().Errorf("closing the store of discovery: %v", err)
+		}
+	}
+	return nil
+}
+
+// keepalive keeps the service registered until it is unregistered. The HeartBeat of publishers
+// which are not KeepAlivers is not waited for.
+func (r *registrar) keepalive() {
+	defer close(r.done)
+	if ka, ok := r.publisher.(discovery.KeepAliver); ok {
+		ka.KeepAlive(r.ctx, r.service)
+		return
+	}
+	go r.publisher.HeartBeat(r.service)
+}
+
+// newDiscoveryService makes the Service to register from config and the address of listener
+func newDiscoveryService(config *cfg.AppConfig, addr net.Addr) (*discovery.Service, error) {
+	dc := config.Discovery
+
+	name := dc.Name
+	if len(name) == 0 {
+		name = config.Name
+	}
+
+	host := dc.Host
+	if len(host) == 0 {
+		host = config.Host
+	}
+	if len(host) == 0 || host == "0.0.0.0" || host == "::" {
+		ip, err := util.LocalIP()
+		if err != nil {
+			return nil, err
+		}
+		host = ip
+	}
+
+	port := config.Port
+	if tcpAddr, ok := addr.(*net.TCPAddr); ok {
+		port = tcpAddr.Port
+	}
+
+	srv := discovery.NewService(name, host, port)
+	srv.Version = dc.Version
+	srv.Zone = dc.Zone
+	srv.Protocol = dc.Protocol
+	srv.Weight = dc.Weight
+	srv.Tags = dc.Tags
+	srv.Metadata = dc.Metadata
+
+	return srv, nil
+}
@@ -0,0 +1,85 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+
+	cfg "github.com/silentred/toolkit/config"
+	"github.com/silentred/toolkit/service/discovery"
+	"github.com/stretchr/testify/assert"
+)
+
+// registeredApp returns an app with discovery enabled by store, and listening
+func registeredApp(t *testing.T, store discovery.Store) (*App, net.Listener) {
+	app := newTestApp(t, &cfg.AppConfig{
+		Host:      "127.0.0.1",
+		Discovery: cfg.DiscoveryConfig{Enable: true, Name: "hello", Version: "v1"},
+	})
+	app.Set("etcd.store", store, new(discovery.Store))
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	app.Set("listener", l, new(net.Listener))
+	return app, l
+}
+
+func TestRegisterService(t *testing.T) {
+	store := discovery.NewMemoryStore()
+	app, l := registeredApp(t, store)
+
+	if !assert.NoError(t, registerService(app)) {
+		return
+	}
+	srv, ok := app.Get("discovery.service").(*discovery.Service)
+	if !assert.True(t, ok) {
+		return
+	}
+	assert.Equal(t, "v1", srv.Version)
+	assert.Equal(t, l.Addr().String(), srv.Addr())
+	_, ok = store.Get(discovery.DefaultPrefix + "/hello/1")
+	assert.True(t, ok)
+
+	assert.NoError(t, unregisterService(app))
+	_, ok = store.Get(discovery.DefaultPrefix + "/hello/1")
+	assert.False(t, ok)
+}
+
+type unreachableStore struct {
+	*discovery.MemoryStore
+}
+
+func (s unreachableStore) Revoke(ctx context.Context, id discovery.LeaseID) error {
+	return errors.New("unreachable")
+}
+
+func TestUnregisterServiceFailure(t *testing.T) {
+	// the shutdown goes on if the registry is unreachable
+	app, _ := registeredApp(t, unreachableStore{discovery.NewMemoryStore()})
+	if assert.NoError(t, registerService(app)) {
+		assert.NoError(t, unregisterService(app))
+	}
+}
+
+// heartBeatPublisher implements Publisher only, as the publishers outside of this package
+type heartBeatPublisher struct {
+	beats chan *discovery.Service
+}
+
+func (p heartBeatPublisher) Register(*discovery.Service) error   { return nil }
+func (p heartBeatPublisher) Unregister(*discovery.Service) error { return nil }
+func (p heartBeatPublisher) HeartBeat(s *discovery.Service)      { p.beats <- s }
+
+func TestRegistrarHeartBeat(t *testing.T) {
+	p := heartBeatPublisher{beats: make(chan *discovery.Service, 1)}
+	srv := discovery.NewService("hello", "127.0.0.1", 8080)
+	r := &registrar{publisher: p, service: srv, ctx: context.Background(), done: make(chan struct{})}
+
+	r.keepalive()
+	<-r.done
+	assert.Equal(t, srv, <-p.beats)
+}
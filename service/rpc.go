@@ -54,12 +54,15 @@ func (app *GrpcApp) ListenAndServe() {
 		log.Fatalf("grpc server has to register service first. %v", info)
 	}
 
+	app.Set("listener", l, new(net.Listener))
+
 	go func() {
-		err = app.server.Serve(l)
+		err := app.server.Serve(l)
 		if err != nil {
 			log.Fatalf("failed to serve: %v", err)
 		}
 	}()
+	runHooks(StartHook, app)
 
 	app.handleSignal()
 }
@@ -88,6 +91,7 @@ func (app *GrpcApp) handleSignal() {
 		log.Printf("get a signal %s \n", s.String())
 		switch s {
 		case syscall.SIGQUIT, syscall.SIGTERM, syscall.SIGSTOP, syscall.SIGINT:
+			runHooks(PreShutdownHook, app)
 			app.server.GracefulStop()
 			runHooks(ShutdownHook, app)
 			return
@@ -0,0 +1,88 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/labstack/gommon/log"
+	"github.com/silentred/toolkit/util"
+	"golang.org/x/net/trace"
+)
+
+// SlowQueryHook logs statements taking longer than Threshold
+type SlowQueryHook struct {
+	Logger    util.Logger
+	Threshold time.Duration
+	// RedactArgs logs the types of args instead of the values
+	RedactArgs bool
+}
+
+// BeforeQuery implements QueryHook
+func (h *SlowQueryHook) BeforeQuery(ctx context.Context, event *QueryEvent) context.Context {
+	return ctx
+}
+
+// AfterQuery implements QueryHook
+func (h *SlowQueryHook) AfterQuery(ctx context.Context, event *QueryEvent) {
+	if event.Duration < h.Threshold {
+		return
+	}
+
+	args := event.Args
+	if h.RedactArgs {
+		args = redactArgs(args)
+	}
+
+	json := log.JSON{
+		"slow_query":  true,
+		"instance":    event.Instance,
+		"role":        event.Role,
+		"operation":   event.Operation,
+		"sql":         event.Query,
+		"args":        args,
+		"latency":     int64(event.Duration),
+		"latency_str": event.Duration.String(),
+		"request_id":  util.RequestIDFromContext(ctx),
+	}
+	if event.Err != nil {
+		json["err"] = event.Err.Error()
+	}
+
+	h.Logger.Warnj(json)
+}
+
+func redactArgs(args []interface{}) []interface{} {
+	redacted := make([]interface{}, len(args))
+	for i, arg := range args {
+		redacted[i] = fmt.Sprintf("<%T>", arg)
+	}
+	return redacted
+}
+
+// TraceQueryHook emits a golang.org/x/net/trace span for every statement,
+// which could be inspected at /debug/requests
+type TraceQueryHook struct{}
+
+// BeforeQuery implements QueryHook
+func (TraceQueryHook) BeforeQuery(ctx context.Context, event *QueryEvent) context.Context {
+	tr := trace.New("sql."+event.Instance, event.Operation)
+	tr.LazyPrintf("%s", event.Query)
+	if id := util.RequestIDFromContext(ctx); len(id) > 0 {
+		tr.LazyPrintf("request_id: %s", id)
+	}
+	return trace.NewContext(ctx, tr)
+}
+
+// AfterQuery implements QueryHook
+func (TraceQueryHook) AfterQuery(ctx context.Context, event *QueryEvent) {
+	tr, ok := trace.FromContext(ctx)
+	if !ok {
+		return
+	}
+	if event.Err != nil {
+		tr.LazyPrintf("%s", event.Err)
+		tr.SetError()
+	}
+	tr.Finish()
+}
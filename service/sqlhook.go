@@ -0,0 +1,284 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"xorm.io/core"
+)
+
+// QueryHook observes every statement sent through an instrumented driver
+type QueryHook interface {
+	// BeforeQuery is called before the statement is sent. The returned context is passed to AfterQuery.
+	BeforeQuery(ctx context.Context, event *QueryEvent) context.Context
+	// AfterQuery is called when the statement returns, with Duration and Err filled.
+	AfterQuery(ctx context.Context, event *QueryEvent)
+}
+
+// QueryEvent describes a single statement
+type QueryEvent struct {
+	Instance  string
+	Role      string
+	Operation string
+	Query     string
+	Args      []interface{}
+	Start     time.Time
+	Duration  time.Duration
+	Err       error
+}
+
+// hookedDriver wraps a database/sql driver and runs hooks around queries and execs
+type hookedDriver struct {
+	driver.Driver
+	instance string
+	role     string
+	hooks    []QueryHook
+}
+
+var hookedDriverSeq uint64
+
+// HookDriver registers an instrumented copy of the driver named base for the given instance,
+// and returns the new driver name, which could be used by sql.Open and xorm.NewEngine.
+// Every call registers a driver of its own, so the hooks of engines are never shared.
+// Drivers could not be unregistered, it should be called once per engine.
+func HookDriver(base, instance, role string, hooks ...QueryHook) (string, error) {
+	name := fmt.Sprintf("%s-hooked-%s-%d", base, instance, atomic.AddUint64(&hookedDriverSeq, 1))
+
+	// sql.Open does not connect, it is only used to get the registered driver
+	db, err := sql.Open(base, "")
+	if err != nil {
+		return "", err
+	}
+	d := &hookedDriver{Driver: db.Driver(), instance: instance, role: role, hooks: hooks}
+	db.Close()
+
+	sql.Register(name, d)
+	// xorm looks up the dialect by driver name
+	if xd := core.QueryDriver(base); xd != nil {
+		core.RegisterDriver(name, xd)
+	}
+
+	return name, nil
+}
+
+// Open implements driver.Driver
+func (d *hookedDriver) Open(dsn string) (driver.Conn, error) {
+	conn, err := d.Driver.Open(dsn)
+	if err != nil {
+		return nil, err
+	}
+	return &hookedConn{Conn: conn, driver: d}, nil
+}
+
+func (d *hookedDriver) run(ctx context.Context, query string, args []driver.NamedValue, fn func(context.Context) error) error {
+	hooks := d.hooks
+	if len(hooks) == 0 {
+		return fn(ctx)
+	}
+
+	event := &QueryEvent{
+		Instance:  d.instance,
+		Role:      d.role,
+		Operation: SQLOperation(query),
+		Query:     query,
+		Args:      namedValues(args),
+		Start:     time.Now(),
+	}
+	ctxs := make([]context.Context, len(hooks))
+	for i, h := range hooks {
+		ctx = h.BeforeQuery(ctx, event)
+		ctxs[i] = ctx
+	}
+
+	err := fn(ctx)
+	event.Duration = time.Since(event.Start)
+	if err != driver.ErrSkip {
+		event.Err = err
+		for i := len(hooks) - 1; i >= 0; i-- {
+			hooks[i].AfterQuery(ctxs[i], event)
+		}
+	}
+
+	return err
+}
+
+type hookedConn struct {
+	driver.Conn
+	driver *hookedDriver
+}
+
+// Prepare implements driver.Conn
+func (c *hookedConn) Prepare(query string) (driver.Stmt, error) {
+	return c.PrepareContext(context.Background(), query)
+}
+
+// PrepareContext implements driver.ConnPrepareContext
+func (c *hookedConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	var stmt driver.Stmt
+	var err error
+	if p, ok := c.Conn.(driver.ConnPrepareContext); ok {
+		stmt, err = p.PrepareContext(ctx, query)
+	} else {
+		stmt, err = c.Conn.Prepare(query)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &hookedStmt{Stmt: stmt, conn: c, query: query}, nil
+}
+
+// BeginTx implements driver.ConnBeginTx
+func (c *hookedConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if b, ok := c.Conn.(driver.ConnBeginTx); ok {
+		return b.BeginTx(ctx, opts)
+	}
+	return c.Conn.Begin()
+}
+
+// QueryContext implements driver.QueryerContext
+func (c *hookedConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	q, ok := c.Conn.(driver.QueryerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	var rows driver.Rows
+	err := c.driver.run(ctx, query, args, func(ctx context.Context) (err error) {
+		rows, err = q.QueryContext(ctx, query, args)
+		return
+	})
+	return rows, err
+}
+
+// ExecContext implements driver.ExecerContext
+func (c *hookedConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	e, ok := c.Conn.(driver.ExecerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	var res driver.Result
+	err := c.driver.run(ctx, query, args, func(ctx context.Context) (err error) {
+		res, err = e.ExecContext(ctx, query, args)
+		return
+	})
+	return res, err
+}
+
+// Ping implements driver.Pinger
+func (c *hookedConn) Ping(ctx context.Context) error {
+	if p, ok := c.Conn.(driver.Pinger); ok {
+		return p.Ping(ctx)
+	}
+	return nil
+}
+
+// ResetSession implements driver.SessionResetter
+func (c *hookedConn) ResetSession(ctx context.Context) error {
+	if r, ok := c.Conn.(driver.SessionResetter); ok {
+		return r.ResetSession(ctx)
+	}
+	return nil
+}
+
+// CheckNamedValue implements driver.NamedValueChecker
+func (c *hookedConn) CheckNamedValue(nv *driver.NamedValue) error {
+	if checker, ok := c.Conn.(driver.NamedValueChecker); ok {
+		return checker.CheckNamedValue(nv)
+	}
+	return driver.ErrSkip
+}
+
+type hookedStmt struct {
+	driver.Stmt
+	conn  *hookedConn
+	query string
+}
+
+// QueryContext implements driver.StmtQueryContext
+func (s *hookedStmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	var rows driver.Rows
+	err := s.conn.driver.run(ctx, s.query, args, func(ctx context.Context) (err error) {
+		if q, ok := s.Stmt.(driver.StmtQueryContext); ok {
+			rows, err = q.QueryContext(ctx, args)
+			return
+		}
+		values, err := plainValues(args)
+		if err != nil {
+			return err
+		}
+		rows, err = s.Stmt.Query(values)
+		return
+	})
+	return rows, err
+}
+
+// ExecContext implements driver.StmtExecContext
+func (s *hookedStmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	var res driver.Result
+	err := s.conn.driver.run(ctx, s.query, args, func(ctx context.Context) (err error) {
+		if e, ok := s.Stmt.(driver.StmtExecContext); ok {
+			res, err = e.ExecContext(ctx, args)
+			return
+		}
+		values, err := plainValues(args)
+		if err != nil {
+			return err
+		}
+		res, err = s.Stmt.Exec(values)
+		return
+	})
+	return res, err
+}
+
+// CheckNamedValue implements driver.NamedValueChecker, falling back to the ColumnConverter of the
+// wrapped statement and then to the connection.
+func (s *hookedStmt) CheckNamedValue(nv *driver.NamedValue) (err error) {
+	if checker, ok := s.Stmt.(driver.NamedValueChecker); ok {
+		return checker.CheckNamedValue(nv)
+	}
+	if cc, ok := s.Stmt.(driver.ColumnConverter); ok {
+		nv.Value, err = cc.ColumnConverter(nv.Ordinal - 1).ConvertValue(nv.Value)
+		return err
+	}
+	return s.conn.CheckNamedValue(nv)
+}
+
+func namedValues(args []driver.NamedValue) []interface{} {
+	if len(args) == 0 {
+		return nil
+	}
+	values := make([]interface{}, len(args))
+	for i, arg := range args {
+		values[i] = arg.Value
+	}
+	return values
+}
+
+func plainValues(args []driver.NamedValue) ([]driver.Value, error) {
+	values := make([]driver.Value, len(args))
+	for i, arg := range args {
+		if len(arg.Name) > 0 {
+			return nil, fmt.Errorf("sql: driver does not support the use of Named Parameters")
+		}
+		values[i] = arg.Value
+	}
+	return values, nil
+}
+
+// SQLOperation returns the lower-cased leading keyword of the query, such as select or insert
+func SQLOperation(query string) string {
+	query = strings.TrimLeft(query, " \t\r\n(")
+	if idx := strings.IndexAny(query, " \t\r\n("); idx > 0 {
+		query = query[:idx]
+	}
+	op := strings.ToLower(query)
+	switch op {
+	case "select", "insert", "update", "delete", "replace", "begin", "commit", "rollback", "show", "create", "alter", "drop", "truncate", "set":
+		return op
+	}
+	return "other"
+}
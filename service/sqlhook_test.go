@@ -0,0 +1,65 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+type recordingHook struct {
+	events []QueryEvent
+}
+
+func (h *recordingHook) BeforeQuery(ctx context.Context, event *QueryEvent) context.Context {
+	return ctx
+}
+
+func (h *recordingHook) AfterQuery(ctx context.Context, event *QueryEvent) {
+	h.events = append(h.events, *event)
+}
+
+func TestHookDriver(t *testing.T) {
+	// engines of the same instance name, as of two apps, keep their own hooks and roles
+	var hooks []*recordingHook
+	var dbs []*sql.DB
+	for _, role := range []string{"master", "replica"} {
+		h := &recordingHook{}
+		name, err := HookDriver("sqlite3", "master", role, h)
+		if !assert.NoError(t, err) {
+			return
+		}
+		db, err := sql.Open(name, ":memory:")
+		if !assert.NoError(t, err) {
+			return
+		}
+		defer db.Close()
+		hooks = append(hooks, h)
+		dbs = append(dbs, db)
+	}
+
+	_, err := dbs[0].Exec("CREATE TABLE t (id INTEGER)")
+	assert.NoError(t, err)
+	rows, err := dbs[1].Query("SELECT 1")
+	if assert.NoError(t, err) {
+		rows.Close()
+	}
+
+	if assert.Len(t, hooks[0].events, 1) {
+		assert.Equal(t, "create", hooks[0].events[0].Operation)
+		assert.Equal(t, "master", hooks[0].events[0].Role)
+	}
+	if assert.Len(t, hooks[1].events, 1) {
+		assert.Equal(t, "select", hooks[1].events[0].Operation)
+		assert.Equal(t, "replica", hooks[1].events[0].Role)
+	}
+}
+
+func TestSQLOperation(t *testing.T) {
+	assert.Equal(t, "select", SQLOperation("  (SELECT 1)"))
+	assert.Equal(t, "insert", SQLOperation("insert into t values (1)"))
+	assert.Equal(t, "other", SQLOperation("WITH x AS (SELECT 1) SELECT * FROM x"))
+}
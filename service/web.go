@@ -4,8 +4,11 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"net"
+	"net/http"
 	"os"
 	"os/signal"
+	"syscall"
 	"time"
 
 	"github.com/labstack/echo/v4"
@@ -62,18 +65,27 @@ func (app *WebApp) ListenAndServe() {
 }
 
 func graceStart(app *WebApp) error {
+	l, err := net.Listen("tcp", fmt.Sprintf("%s:%d", app.Config.Host, app.Config.Port))
+	if err != nil {
+		log.Fatal(err)
+	}
+	app.Router.Listener = l
+	app.Set("listener", l, new(net.Listener))
+
 	// Start server
 	go func() {
-		if err := app.Router.Start(fmt.Sprintf("%s:%d", app.Config.Host, app.Config.Port)); err != nil {
+		if err := app.Router.Start(""); err != nil && err != http.ErrServerClosed {
 			log.Fatal(err)
 		}
 	}()
+	runHooks(StartHook, app)
 
-	// Wait for interrupt signal to gracefully shutdown the server with
+	// Wait for interrupt or termination signal to gracefully shutdown the server with
 	// a timeout of 3 seconds.
-	quit := make(chan os.Signal)
-	signal.Notify(quit, os.Interrupt)
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, os.Interrupt, syscall.SIGTERM)
 	<-quit
+	runHooks(PreShutdownHook, app)
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 	if err := app.Router.Shutdown(ctx); err != nil {
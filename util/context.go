@@ -0,0 +1,35 @@
+package util
+
+import (
+	"context"
+
+	"github.com/labstack/gommon/log"
+)
+
+type requestIDKey struct{}
+
+// WithRequestID returns a copy of ctx carrying the request ID
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestIDFromContext returns the request ID in ctx, or empty string if there is none
+func RequestIDFromContext(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	if id, ok := ctx.Value(requestIDKey{}).(string); ok {
+		return id
+	}
+	return ""
+}
+
+// AddRequestID adds the request ID and trace ID in ctx to the log fields
+func AddRequestID(fields log.JSON, ctx context.Context) {
+	if id := RequestIDFromContext(ctx); len(id) > 0 {
+		fields["request_id"] = id
+	}
+	if tc, ok := TraceContextFromContext(ctx); ok {
+		fields["trace_id"] = tc.TraceID
+	}
+}
@@ -2,15 +2,23 @@ package util
 
 import (
 	"bytes"
+	"context"
 	"crypto/tls"
 	"crypto/x509"
 	"fmt"
 	"io"
 	"io/ioutil"
+	"net"
 	"net/http"
+	"net/url"
 	"strconv"
 	"sync"
 	"time"
+
+	"github.com/silentred/toolkit/breaker"
+	cfg "github.com/silentred/toolkit/config"
+	semconv "go.opentelemetry.io/otel/semconv/v1.4.0"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type HTTPClientIface interface {
@@ -23,25 +31,176 @@ type Response struct {
 	Err      error
 }
 
+// RequestSigner signs outgoing requests, as auth.HMACSigner
+type RequestSigner interface {
+	Sign(*http.Request) error
+}
+
 type HTTPClient struct {
-	Timeout int
-	client  *http.Client
+	Timeout  int
+	client   *http.Client
+	signer   RequestSigner
+	breakers *breaker.Group
+	retry    *HTTPRetryPolicy
 }
 
-func NewHTTPClient(timeout int, client *http.Client) *HTTPClient {
-	var c = http.DefaultClient
+// HTTPClientOption configures an HTTPClient
+type HTTPClientOption func(*HTTPClient)
+
+// WithSigner signs every request by signer
+func WithSigner(signer RequestSigner) HTTPClientOption {
+	return func(hc *HTTPClient) {
+		hc.signer = signer
+	}
+}
+
+// WithBreakers stops requests to hosts whose circuit is open in breakers, and returns breaker.ErrOpen
+// instead. Network errors and 5xx responses are failures.
+func WithBreakers(breakers *breaker.Group) HTTPClientOption {
+	return func(hc *HTTPClient) {
+		hc.breakers = breakers
+	}
+}
+
+// WithTransport sends requests by transport, as the one of NewTransport
+func WithTransport(transport http.RoundTripper) HTTPClientOption {
+	return func(hc *HTTPClient) {
+		hc.client.Transport = transport
+	}
+}
+
+// NewHTTPClient returns an HTTPClient with timeout in second. It uses a copy of client, or a new
+// client of http.DefaultTransport if it is nil, so the timeout does not change the client of caller.
+func NewHTTPClient(timeout int, client *http.Client, opts ...HTTPClientOption) *HTTPClient {
+	var c http.Client
 	if client != nil {
-		c = client
+		c = *client
 	}
+	c.Timeout = time.Duration(timeout) * time.Second
 	hc := &HTTPClient{
 		Timeout: timeout,
-		client:  c,
+		client:  &c,
+	}
+	for _, opt := range opts {
+		opt(hc)
 	}
-	hc.client.Timeout = time.Duration(timeout) * time.Second
 
 	return hc
 }
 
+// NewHTTPClientFromConfig returns an HTTPClient with its own transport of config
+func NewHTTPClientFromConfig(config cfg.HTTPClientConfig, opts ...HTTPClientOption) (*HTTPClient, error) {
+	transport, err := NewTransport(config)
+	if err != nil {
+		return nil, err
+	}
+	hc := &HTTPClient{
+		Timeout: int(config.Timeout / time.Second),
+		client:  &http.Client{Transport: transport, Timeout: config.Timeout},
+	}
+	if config.MaxAttempts > 1 {
+		hc.retry = &HTTPRetryPolicy{MaxAttempts: config.MaxAttempts, Backoff: config.RetryBackoff, Jitter: 0.2}
+	}
+	for _, opt := range opts {
+		opt(hc)
+	}
+	return hc, nil
+}
+
+// NewTransport returns a transport of config. Zero fields take the defaults of http.DefaultTransport.
+func NewTransport(config cfg.HTTPClientConfig) (*http.Transport, error) {
+	dialer := &net.Dialer{
+		Timeout:   durationOr(config.DialTimeout, 30*time.Second),
+		KeepAlive: durationOr(config.KeepAlive, 30*time.Second),
+	}
+	transport := &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           dialer.DialContext,
+		MaxIdleConns:          100,
+		MaxIdleConnsPerHost:   config.MaxIdleConnsPerHost,
+		MaxConnsPerHost:       config.MaxConnsPerHost,
+		IdleConnTimeout:       durationOr(config.IdleConnTimeout, 90*time.Second),
+		TLSHandshakeTimeout:   durationOr(config.TLSHandshakeTimeout, 10*time.Second),
+		ResponseHeaderTimeout: config.ResponseHeaderTimeout,
+		ExpectContinueTimeout: time.Second,
+		ForceAttemptHTTP2:     !config.DisableHTTP2,
+	}
+	if config.MaxIdleConns > 0 {
+		transport.MaxIdleConns = config.MaxIdleConns
+	}
+	if config.DisableHTTP2 {
+		// a non-nil empty map disables HTTP/2
+		transport.TLSNextProto = make(map[string]func(string, *tls.Conn) http.RoundTripper)
+	}
+
+	switch config.Proxy {
+	case "":
+	case "direct":
+		transport.Proxy = nil
+	default:
+		proxy, err := url.Parse(config.Proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy %q: %v", config.Proxy, err)
+		}
+		transport.Proxy = http.ProxyURL(proxy)
+	}
+
+	if len(config.CAFile) > 0 || len(config.CertFile) > 0 || config.InsecureSkipVerify {
+		tlsConfig, err := clientTLSConfig(config)
+		if err != nil {
+			return nil, err
+		}
+		transport.TLSClientConfig = tlsConfig
+	}
+	return transport, nil
+}
+
+// clientTLSConfig returns the config of GetTlsConfiguration if there are the client certificate
+// and CA, or a config of either of them. Servers are verified unless InsecureSkipVerify.
+func clientTLSConfig(config cfg.HTTPClientConfig) (*tls.Config, error) {
+	if len(config.CertFile) > 0 && len(config.KeyFile) > 0 && len(config.CAFile) > 0 {
+		tlsConfig, err := GetTlsConfiguration(config.KeyFile, config.CertFile, config.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.InsecureSkipVerify = config.InsecureSkipVerify
+		return tlsConfig, nil
+	}
+
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12, InsecureSkipVerify: config.InsecureSkipVerify}
+	if len(config.CertFile) > 0 || len(config.KeyFile) > 0 {
+		cert, err := tls.LoadX509KeyPair(config.CertFile, config.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	if len(config.CAFile) > 0 {
+		pem, err := ioutil.ReadFile(config.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificate in %s", config.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	return tlsConfig, nil
+}
+
+func durationOr(d, def time.Duration) time.Duration {
+	if d > 0 {
+		return d
+	}
+	return def
+}
+
+// CloseIdleConnections closes the idle connections of the transport
+func (hc *HTTPClient) CloseIdleConnections() {
+	hc.client.CloseIdleConnections()
+}
+
 // NewHTTPReqeust makes a http request
 func NewHTTPReqeust(method, url string, queries, headers map[string]string, body []byte) (*http.Request, error) {
 	req, err := http.NewRequest(method, url, nil)
@@ -64,7 +223,12 @@ func NewHTTPReqeust(method, url string, queries, headers map[string]string, body
 	}
 
 	if body != nil {
+		// the body is replayable by GetBody for retries
 		req.Body = ioutil.NopCloser(bytes.NewReader(body))
+		req.GetBody = func() (io.ReadCloser, error) {
+			return ioutil.NopCloser(bytes.NewReader(body)), nil
+		}
+		req.ContentLength = int64(len(body))
 	}
 
 	return req, nil
@@ -74,7 +238,7 @@ func (hc *HTTPClient) Do(req *http.Request) ([]byte, int, error) {
 	var err error
 	var b []byte
 
-	resp, err := hc.client.Do(req)
+	resp, err := hc.do(req)
 	if err != nil {
 		if resp != nil {
 			b, err = ioutil.ReadAll(resp.Body)
@@ -95,6 +259,9 @@ func (hc *HTTPClient) Do(req *http.Request) ([]byte, int, error) {
 }
 
 // DoParallel http requests, and get response list. Response could be nil
+//
+// Deprecated: the bodies of responses have to be closed by callers, and requests are not limited or
+// canceled. Use DoParallelContext or DoStream.
 func (hc *HTTPClient) DoParallel(reqs ...*http.Request) []*Response {
 	var reqNum = len(reqs)
 	var resps = make([]*Response, reqNum)
@@ -103,7 +270,7 @@ func (hc *HTTPClient) DoParallel(reqs ...*http.Request) []*Response {
 		wg.Add(1)
 		go func(idx int) {
 			var resp Response
-			resp.Response, resp.Err = hc.client.Do(reqs[idx])
+			resp.Response, resp.Err = hc.do(reqs[idx])
 			resps[idx] = &resp
 			wg.Done()
 		}(i)
@@ -112,6 +279,49 @@ func (hc *HTTPClient) DoParallel(reqs ...*http.Request) []*Response {
 	return resps
 }
 
+// do sends req in a client span, with the request ID and trace-context of its context. Every attempt
+// is signed by the signer of hc.
+func (hc *HTTPClient) do(req *http.Request) (*http.Response, error) {
+	ctx, span := StartSpan(req.Context(), "HTTP "+req.Method, trace.SpanKindClient,
+		semconv.HTTPClientAttributesFromHTTPRequest(req)...)
+	// the header of caller is not modified, req may be sent in parallel
+	req = req.WithContext(ctx)
+	req.Header = req.Header.Clone()
+	if req.Header == nil {
+		req.Header = make(http.Header)
+	}
+	InjectHeader(ctx, req.Header)
+
+	resp, err := hc.sendWithRetry(req)
+	if err == nil {
+		span.SetAttributes(semconv.HTTPAttributesFromHTTPStatusCode(resp.StatusCode)...)
+		span.SetStatus(semconv.SpanStatusFromHTTPStatusCode(resp.StatusCode))
+	}
+	EndSpan(span, err)
+	return resp, err
+}
+
+// send sends req through the breaker of its host
+func (hc *HTTPClient) send(req *http.Request) (*http.Response, error) {
+	if hc.breakers == nil {
+		return hc.client.Do(req)
+	}
+
+	done, err := hc.breakers.Get(req.URL.Host).Allow()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", req.URL.Host, err)
+	}
+	resp, err := hc.client.Do(req)
+	switch {
+	case err != nil:
+		// requests canceled by callers are not failures of the host
+		done(req.Context().Err() == context.Canceled)
+	default:
+		done(resp.StatusCode < http.StatusInternalServerError)
+	}
+	return resp, err
+}
+
 // Get returns http response body in []byte, timeout in second
 // func (hc *HTTPClient) Get(req *http.Request) ([]byte, int, error) {
 // 	req.Method = "GET"
@@ -129,7 +339,7 @@ func (hc *HTTPClient) GetReadCloser(req *http.Request) (io.ReadCloser, string, i
 	var err error
 	var res *http.Response
 
-	res, err = hc.client.Do(req)
+	res, err = hc.do(req)
 	if err != nil {
 		return nil, "", 0, err
 	}
@@ -148,26 +358,47 @@ func (hc *HTTPClient) GetReadCloser(req *http.Request) (io.ReadCloser, string, i
 }
 
 func MustLoadCertificates(privateKeyFile, certificateFile, caFile string) (tls.Certificate, *x509.CertPool) {
-	mycert, err := tls.LoadX509KeyPair(certificateFile, privateKeyFile)
+	mycert, certPool, err := LoadCertificates(privateKeyFile, certificateFile, caFile)
 	if err != nil {
 		panic(err)
 	}
+	return mycert, certPool
+}
+
+// LoadCertificates is MustLoadCertificates returning errors
+func LoadCertificates(privateKeyFile, certificateFile, caFile string) (tls.Certificate, *x509.CertPool, error) {
+	mycert, err := tls.LoadX509KeyPair(certificateFile, privateKeyFile)
+	if err != nil {
+		return tls.Certificate{}, nil, err
+	}
 	pem, err := ioutil.ReadFile(caFile)
 	if err != nil {
-		panic(err)
+		return tls.Certificate{}, nil, err
 	}
 
 	certPool := x509.NewCertPool()
 	if !certPool.AppendCertsFromPEM(pem) {
-		panic("Failed appending certs")
+		return tls.Certificate{}, nil, fmt.Errorf("Failed appending certs")
 	}
 
-	return mycert, certPool
+	return mycert, certPool, nil
 }
 
 func MustGetTlsConfiguration(privateKeyFile, certificateFile, caFile string) *tls.Config {
+	config, err := GetTlsConfiguration(privateKeyFile, certificateFile, caFile)
+	if err != nil {
+		panic(err)
+	}
+	return config
+}
+
+// GetTlsConfiguration is MustGetTlsConfiguration returning errors
+func GetTlsConfiguration(privateKeyFile, certificateFile, caFile string) (*tls.Config, error) {
 	config := &tls.Config{}
-	mycert, certPool := MustLoadCertificates(privateKeyFile, certificateFile, caFile)
+	mycert, certPool, err := LoadCertificates(privateKeyFile, certificateFile, caFile)
+	if err != nil {
+		return nil, err
+	}
 	config.Certificates = make([]tls.Certificate, 1)
 	config.Certificates[0] = mycert
 
@@ -194,5 +425,5 @@ func MustGetTlsConfiguration(privateKeyFile, certificateFile, caFile string) *tl
 
 	//Don't allow session resumption
 	// config.SessionTicketsDisabled = true
-	return config
+	return config, nil
 }
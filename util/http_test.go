@@ -1,7 +1,27 @@
 package util
 
-import "testing"
-import "github.com/stretchr/testify/assert"
+import (
+	"context"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	cfg "github.com/silentred/toolkit/config"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
 
 func TestHTTP(t *testing.T) {
 	client := NewHTTPClient(60, nil)
@@ -23,3 +43,292 @@ func TestParallelHTTP(t *testing.T) {
 	}
 
 }
+
+func TestHTTPRequestID(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Header.Get(HeaderRequestID)))
+	}))
+	defer server.Close()
+
+	client := NewHTTPClient(5, &http.Client{})
+	req, _ := NewHTTPReqeust("GET", server.URL, nil, nil, nil)
+	req = req.WithContext(WithRequestID(context.Background(), "req-1"))
+	b, code, err := client.Do(req)
+	assert.NoError(t, err)
+	assert.Equal(t, 200, code)
+	assert.Equal(t, "req-1", string(b))
+}
+
+func TestHTTPRetry(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&calls, 1)
+		body, _ := ioutil.ReadAll(r.Body)
+		if n < 3 {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write(body)
+	}))
+	defer server.Close()
+
+	client := NewHTTPClient(5, &http.Client{}, WithRetry(HTTPRetryPolicy{MaxAttempts: 3, Backoff: time.Millisecond}))
+	req, _ := NewHTTPReqeust("PUT", server.URL, nil, nil, []byte("hello"))
+	b, code, err := client.Do(req)
+	assert.NoError(t, err)
+	assert.Equal(t, 200, code)
+	assert.Equal(t, "hello", string(b))
+	assert.EqualValues(t, 3, atomic.LoadInt32(&calls))
+
+	// bodies without GetBody are buffered
+	atomic.StoreInt32(&calls, 0)
+	req, _ = http.NewRequest("PUT", server.URL, ioutil.NopCloser(strings.NewReader("world")))
+	b, _, err = client.Do(req)
+	assert.NoError(t, err)
+	assert.Equal(t, "world", string(b))
+
+	// POST is not idempotent
+	atomic.StoreInt32(&calls, 0)
+	req, _ = NewHTTPReqeust("POST", server.URL, nil, nil, []byte("hello"))
+	_, code, _ = client.Do(req)
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.EqualValues(t, 1, atomic.LoadInt32(&calls))
+}
+
+func TestHTTPRetryAfter(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.Header().Set("Retry-After", "1")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+
+	// the Retry-After over the deadline ends retrying
+	client := NewHTTPClient(5, &http.Client{}, WithRetry(HTTPRetryPolicy{MaxAttempts: 5, Backoff: time.Millisecond}))
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+	req, _ := NewHTTPReqeust("GET", server.URL, nil, nil, nil)
+	start := time.Now()
+	_, code, err := client.Do(req.WithContext(ctx))
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusTooManyRequests, code)
+	assert.EqualValues(t, 1, atomic.LoadInt32(&calls))
+	assert.True(t, time.Since(start) < 500*time.Millisecond)
+
+	after, ok := retryAfter(time.Now().Add(time.Minute).UTC().Format(http.TimeFormat))
+	assert.True(t, ok)
+	assert.InDelta(t, float64(time.Minute), float64(after), float64(2*time.Second))
+}
+
+func TestHTTPRetryCanceled(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer server.Close()
+
+	client := NewHTTPClient(5, &http.Client{}, WithRetry(HTTPRetryPolicy{MaxAttempts: 10, Backoff: time.Second}))
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	req, _ := NewHTTPReqeust("GET", server.URL, nil, nil, nil)
+	start := time.Now()
+	_, _, err := client.Do(req.WithContext(ctx))
+	assert.Equal(t, context.Canceled, err)
+	assert.True(t, time.Since(start) < time.Second)
+}
+
+func TestDoParallelContext(t *testing.T) {
+	var inFlight, maxInFlight int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&inFlight, 1)
+		defer atomic.AddInt32(&inFlight, -1)
+		for {
+			max := atomic.LoadInt32(&maxInFlight)
+			if n <= max || atomic.CompareAndSwapInt32(&maxInFlight, max, n) {
+				break
+			}
+		}
+		if r.URL.Path == "/slow" {
+			select {
+			case <-time.After(time.Second):
+			case <-r.Context().Done():
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+		w.Write([]byte(r.URL.Path))
+	}))
+	defer server.Close()
+
+	client := NewHTTPClient(5, &http.Client{})
+	var reqs []*http.Request
+	for _, path := range []string{"/a", "/b", "/c", "/d", "/e"} {
+		req, _ := NewHTTPReqeust("GET", server.URL+path, nil, nil, nil)
+		reqs = append(reqs, req)
+	}
+	results, err := client.DoParallelContext(context.Background(), ParallelOptions{Concurrency: 2}, reqs...)
+	assert.NoError(t, err)
+	for i, r := range results {
+		assert.Equal(t, i, r.Index)
+		assert.NoError(t, r.Err)
+		assert.Equal(t, reqs[i].URL.Path, string(r.Body))
+	}
+	assert.EqualValues(t, 2, atomic.LoadInt32(&maxInFlight))
+
+	// the deadline applies to all requests
+	slow, _ := NewHTTPReqeust("GET", server.URL+"/slow", nil, nil, nil)
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	results, err = client.DoParallelContext(ctx, ParallelOptions{}, reqs[0], slow)
+	assert.Equal(t, context.DeadlineExceeded, err)
+	assert.NoError(t, results[0].Err)
+	assert.Error(t, results[1].Err)
+
+	// the first error cancels the others
+	bad, _ := NewHTTPReqeust("GET", "http://127.0.0.1:1/", nil, nil, nil)
+	start := time.Now()
+	results, err = client.DoParallelContext(context.Background(), ParallelOptions{FailFast: true}, slow, bad)
+	assert.Error(t, err)
+	assert.Equal(t, results[1].Err, err)
+	assert.Error(t, results[0].Err)
+	assert.True(t, time.Since(start) < time.Second)
+}
+
+func TestDoStream(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			time.Sleep(50 * time.Millisecond)
+		}
+		w.Write([]byte(r.URL.Path))
+	}))
+	defer server.Close()
+
+	slow, _ := NewHTTPReqeust("GET", server.URL+"/slow", nil, nil, nil)
+	fast, _ := NewHTTPReqeust("GET", server.URL+"/fast", nil, nil, nil)
+	var bodies []string
+	for r := range NewHTTPClient(5, &http.Client{}).DoStream(context.Background(), ParallelOptions{}, slow, fast) {
+		assert.NoError(t, r.Err)
+		bodies = append(bodies, string(r.Body))
+	}
+	assert.Equal(t, []string{"/fast", "/slow"}, bodies)
+}
+
+func TestHTTPJSON(t *testing.T) {
+	type user struct {
+		ID   int    `json:"id"`
+		Name string `json:"name"`
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/users":
+			var u user
+			json.NewDecoder(r.Body).Decode(&u)
+			u.ID = 1
+			json.NewEncoder(w).Encode(u)
+		case "/denied":
+			w.WriteHeader(http.StatusForbidden)
+			json.NewEncoder(w).Encode(NewError(400403, "invalid token"))
+		default:
+			http.Error(w, "no such page", http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	client := NewHTTPClient(5, &http.Client{})
+	var u user
+	assert.NoError(t, client.PostJSON(context.Background(), server.URL+"/users", user{Name: "jason"}, &u))
+	assert.Equal(t, user{ID: 1, Name: "jason"}, u)
+
+	err := client.GetJSON(context.Background(), server.URL+"/denied", &u)
+	var httpErr *HTTPError
+	if assert.True(t, errors.As(err, &httpErr)) {
+		assert.Equal(t, http.StatusForbidden, httpErr.StatusCode)
+		assert.Equal(t, 400403, httpErr.Err.Code)
+		assert.Equal(t, "invalid token", httpErr.Err.Msg)
+	}
+
+	err = client.GetJSON(context.Background(), server.URL+"/missing", &u)
+	if assert.True(t, errors.As(err, &httpErr)) {
+		assert.Equal(t, http.StatusNotFound, httpErr.StatusCode)
+		assert.Equal(t, "no such page", httpErr.Body)
+		assert.Nil(t, httpErr.Err)
+	}
+}
+
+func TestHTTPClientTransport(t *testing.T) {
+	NewHTTPClient(3, nil)
+	assert.Equal(t, time.Duration(0), http.DefaultClient.Timeout)
+
+	transport, err := NewTransport(cfg.HTTPClientConfig{MaxConnsPerHost: 4, Proxy: "direct", DisableHTTP2: true})
+	if assert.NoError(t, err) {
+		assert.Equal(t, 4, transport.MaxConnsPerHost)
+		assert.Equal(t, 100, transport.MaxIdleConns)
+		assert.Equal(t, 90*time.Second, transport.IdleConnTimeout)
+		assert.Nil(t, transport.Proxy)
+		assert.False(t, transport.ForceAttemptHTTP2)
+		assert.NotNil(t, transport.TLSNextProto)
+	}
+	_, err = NewTransport(cfg.HTTPClientConfig{Proxy: "://proxy"})
+	assert.Error(t, err)
+
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "httpclient")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+	caFile := filepath.Join(dir, "ca.pem")
+	ca := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	assert.NoError(t, ioutil.WriteFile(caFile, ca, 0600))
+
+	// the server is verified by the CA of config
+	client, err := NewHTTPClientFromConfig(cfg.HTTPClientConfig{Timeout: 5 * time.Second, CAFile: caFile})
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer client.CloseIdleConnections()
+	req, _ := NewHTTPReqeust(http.MethodGet, server.URL, nil, nil, nil)
+	body, code, err := client.Do(req)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "ok", string(body))
+
+	req, _ = NewHTTPReqeust(http.MethodGet, server.URL, nil, nil, nil)
+	_, _, err = NewHTTPClient(5, &http.Client{}).Do(req)
+	assert.Error(t, err)
+}
+
+func TestHTTPTracing(t *testing.T) {
+	spans := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(spans))
+	defer provider.Shutdown(context.Background())
+	otel.SetTracerProvider(provider)
+	defer otel.SetTracerProvider(trace.NewNoopTracerProvider())
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Header.Get(HeaderTraceparent)))
+	}))
+	defer server.Close()
+
+	ctx, parent := StartSpan(context.Background(), "test", trace.SpanKindInternal)
+	req, _ := NewHTTPReqeust("GET", server.URL, nil, nil, nil)
+	b, _, err := NewHTTPClient(5, &http.Client{}).Do(req.WithContext(ctx))
+	parent.End()
+	assert.NoError(t, err)
+
+	// the client span is a child of the context, and the parent of the server
+	if got := spans.GetSpans(); assert.Len(t, got, 2) {
+		client := got[0]
+		assert.Equal(t, "HTTP GET", client.Name)
+		assert.Equal(t, parent.SpanContext().SpanID(), client.Parent.SpanID())
+		sent, ok := ParseTraceparent(string(b))
+		if assert.True(t, ok) {
+			assert.Equal(t, client.SpanContext.TraceID().String(), sent.TraceID)
+			assert.Equal(t, client.SpanContext.SpanID().String(), sent.SpanID)
+		}
+	}
+}
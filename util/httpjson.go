@@ -0,0 +1,102 @@
+package util
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+)
+
+// maxErrorBody is the length of the body kept in HTTPError
+const maxErrorBody = 512
+
+// HTTPError is returned by the JSON helpers of HTTPClient for non-2xx responses
+type HTTPError struct {
+	StatusCode int
+	// Body is the beginning of the response body
+	Body string
+	// Err is the {code,msg} envelope of the body, nil if the body is not one
+	Err *Error
+}
+
+func (e *HTTPError) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("http %d: code %d: %s", e.StatusCode, e.Err.Code, e.Err.Msg)
+	}
+	return fmt.Sprintf("http %d: %s", e.StatusCode, e.Body)
+}
+
+// newHTTPError returns the HTTPError of a response
+func newHTTPError(status int, body []byte) *HTTPError {
+	e := &HTTPError{StatusCode: status, Body: string(body)}
+	if len(body) > maxErrorBody {
+		e.Body = string(body[:maxErrorBody])
+	}
+
+	var envelope struct {
+		Code *int   `json:"code"`
+		Msg  string `json:"msg"`
+	}
+	if json.Unmarshal(body, &envelope) == nil && envelope.Code != nil {
+		err := NewError(*envelope.Code, envelope.Msg)
+		e.Err = &err
+	}
+	return e
+}
+
+// GetJSON gets url and decodes the JSON response into out
+func (hc *HTTPClient) GetJSON(ctx context.Context, url string, out interface{}) error {
+	return hc.DoJSON(ctx, http.MethodGet, url, nil, out)
+}
+
+// PostJSON posts in as JSON to url and decodes the JSON response into out
+func (hc *HTTPClient) PostJSON(ctx context.Context, url string, in, out interface{}) error {
+	return hc.DoJSON(ctx, http.MethodPost, url, in, out)
+}
+
+// PutJSON puts in as JSON to url and decodes the JSON response into out
+func (hc *HTTPClient) PutJSON(ctx context.Context, url string, in, out interface{}) error {
+	return hc.DoJSON(ctx, http.MethodPut, url, in, out)
+}
+
+// DoJSON sends in encoded as JSON, if it is not nil, and decodes the JSON response into out, if it
+// is not nil. Non-2xx responses are returned as *HTTPError.
+func (hc *HTTPClient) DoJSON(ctx context.Context, method, url string, in, out interface{}) error {
+	var body []byte
+	if in != nil {
+		var err error
+		if body, err = json.Marshal(in); err != nil {
+			return err
+		}
+	}
+	req, err := NewHTTPReqeust(method, url, nil, nil, body)
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Accept", "application/json")
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := hc.do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		b, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 64<<10))
+		return newHTTPError(resp.StatusCode, bytes.TrimSpace(b))
+	}
+	if out == nil || resp.StatusCode == http.StatusNoContent {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil && err != io.EOF {
+		return fmt.Errorf("decode response of %s %s: %w", method, url, err)
+	}
+	return nil
+}
@@ -0,0 +1,23 @@
+package util
+
+import (
+	"errors"
+	"net"
+)
+
+// LocalIP returns the first non-loopback IPv4 address of the host
+func LocalIP() (string, error) {
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return "", err
+	}
+
+	for _, addr := range addrs {
+		if ipNet, ok := addr.(*net.IPNet); ok && !ipNet.IP.IsLoopback() {
+			if ip := ipNet.IP.To4(); ip != nil {
+				return ip.String(), nil
+			}
+		}
+	}
+	return "", errors.New("no non-loopback IPv4 address found")
+}
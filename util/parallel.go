@@ -0,0 +1,123 @@
+package util
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"sync"
+)
+
+// ParallelOptions of DoParallelContext and DoStream
+type ParallelOptions struct {
+	// Concurrency is the max number of requests in flight, all of them if it is not positive
+	Concurrency int
+	// FailFast cancels the requests in flight and not sent yet on the first error. Responses of
+	// any status are not errors.
+	FailFast bool
+}
+
+// ParallelResult of a request sent in parallel, whose body is read and closed
+type ParallelResult struct {
+	// Index of the request
+	Index      int
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+	Err        error
+}
+
+// DoParallelContext sends reqs in parallel, at most Concurrency of them at once, and returns their
+// results by index. The context of requests is replaced by ctx, whose deadline applies to all of
+// them. The error is the first one with FailFast, or the error of ctx if it is done.
+func (hc *HTTPClient) DoParallelContext(ctx context.Context, opts ParallelOptions, reqs ...*http.Request) ([]ParallelResult, error) {
+	ch, cause := hc.parallel(ctx, opts, reqs)
+	results := make([]ParallelResult, len(reqs))
+	for r := range ch {
+		results[r.Index] = r
+	}
+	if err := cause(); err != nil {
+		return results, err
+	}
+	return results, ctx.Err()
+}
+
+// DoStream is DoParallelContext sending the results in the order they complete. The channel is
+// closed after a result of every request is sent.
+func (hc *HTTPClient) DoStream(ctx context.Context, opts ParallelOptions, reqs ...*http.Request) <-chan ParallelResult {
+	ch, _ := hc.parallel(ctx, opts, reqs)
+	return ch
+}
+
+// parallel sends reqs by a pool of workers, and returns the channel of results and the func
+// returning the first error with FailFast
+func (hc *HTTPClient) parallel(ctx context.Context, opts ParallelOptions, reqs []*http.Request) (<-chan ParallelResult, func() error) {
+	ctx, cancel := context.WithCancel(ctx)
+	// buffered for every result, workers never block on callers
+	results := make(chan ParallelResult, len(reqs))
+
+	var (
+		once  sync.Once
+		first error
+	)
+	fail := func(err error) {
+		once.Do(func() {
+			first = err
+			cancel()
+		})
+	}
+
+	indexes := make(chan int, len(reqs))
+	for i := range reqs {
+		indexes <- i
+	}
+	close(indexes)
+
+	workers := opts.Concurrency
+	if workers <= 0 || workers > len(reqs) {
+		workers = len(reqs)
+	}
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for w := 0; w < workers; w++ {
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				r := hc.fetch(ctx, i, reqs[i])
+				// errors caused by canceling the others are not the first one
+				if r.Err != nil && opts.FailFast && ctx.Err() == nil {
+					fail(r.Err)
+				}
+				results <- r
+			}
+		}()
+	}
+
+	go func() {
+		wg.Wait()
+		cancel()
+		close(results)
+	}()
+
+	// first is read after results are closed
+	return results, func() error { return first }
+}
+
+// fetch sends req with ctx and reads the body
+func (hc *HTTPClient) fetch(ctx context.Context, index int, req *http.Request) ParallelResult {
+	r := ParallelResult{Index: index}
+	if r.Err = ctx.Err(); r.Err != nil {
+		return r
+	}
+
+	resp, err := hc.do(req.WithContext(ctx))
+	if err != nil {
+		r.Err = err
+		return r
+	}
+	defer resp.Body.Close()
+
+	r.StatusCode = resp.StatusCode
+	r.Header = resp.Header
+	r.Body, r.Err = ioutil.ReadAll(resp.Body)
+	return r
+}
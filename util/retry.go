@@ -0,0 +1,209 @@
+package util
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/silentred/toolkit/breaker"
+)
+
+var (
+	// DefaultRetryStatusCodes are retried if HTTPRetryPolicy has no StatusCodes
+	DefaultRetryStatusCodes = []int{http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout}
+	// DefaultRetryMethods are the idempotent methods retried if HTTPRetryPolicy has no Methods
+	DefaultRetryMethods = []string{http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete}
+	// DefaultHTTPRetryBackoff is the first backoff if HTTPRetryPolicy has no Backoff
+	DefaultHTTPRetryBackoff = 100 * time.Millisecond
+	// DefaultMaxHTTPRetryBackoff is the limit of backoff if HTTPRetryPolicy has no MaxBackoff
+	DefaultMaxHTTPRetryBackoff = 10 * time.Second
+)
+
+// HTTPRetryPolicy of HTTPClient. Requests failing with network errors or StatusCodes are retried.
+// The backoff before the nth retry is Backoff * 2^(n-1), limited by MaxBackoff, and randomized by
+// ±Jitter of itself. A longer Retry-After of the response is waited instead, unless it is over
+// MaxBackoff or the deadline of the request, which ends retrying.
+type HTTPRetryPolicy struct {
+	// MaxAttempts including the first one
+	MaxAttempts int
+	StatusCodes []int
+	// Methods to retry, DefaultRetryMethods by default
+	Methods []string
+
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	// Jitter is a fraction in [0, 1]
+	Jitter float64
+}
+
+// WithRetry retries requests by policy
+func WithRetry(policy HTTPRetryPolicy) HTTPClientOption {
+	return func(hc *HTTPClient) {
+		hc.retry = &policy
+	}
+}
+
+// sendWithRetry sends req, and sends it again by the retry policy of hc. The body is buffered to
+// be sent again if req has no GetBody.
+func (hc *HTTPClient) sendWithRetry(req *http.Request) (*http.Response, error) {
+	policy := hc.retry
+	if policy == nil || policy.MaxAttempts <= 1 || !policy.retryMethod(req.Method) {
+		return hc.attempt(req)
+	}
+	if err := replayable(req); err != nil {
+		return nil, err
+	}
+
+	ctx := req.Context()
+	for n := 1; ; n++ {
+		resp, err := hc.attempt(req)
+		if n >= policy.MaxAttempts || !policy.retryable(ctx, resp, err) {
+			return resp, err
+		}
+
+		wait, ok := policy.wait(ctx, n, resp)
+		if !ok {
+			return resp, err
+		}
+		if resp != nil {
+			// the connection is reused if the body is read
+			io.Copy(ioutil.Discard, io.LimitReader(resp.Body, 4<<10))
+			resp.Body.Close()
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// attempt sends a copy of req with a new body, signed by the signer of hc
+func (hc *HTTPClient) attempt(req *http.Request) (*http.Response, error) {
+	if req.GetBody != nil && req.Body != nil && req.Body != http.NoBody {
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		r := *req
+		r.Header = req.Header.Clone()
+		r.Body = body
+		req = &r
+	}
+	if hc.signer != nil {
+		if err := hc.signer.Sign(req); err != nil {
+			return nil, err
+		}
+	}
+	return hc.send(req)
+}
+
+// replayable buffers the body of req into GetBody, if req has no GetBody
+func replayable(req *http.Request) error {
+	if req.Body == nil || req.Body == http.NoBody || req.GetBody != nil {
+		return nil
+	}
+	body, err := ioutil.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return err
+	}
+	req.GetBody = func() (io.ReadCloser, error) {
+		return ioutil.NopCloser(bytes.NewReader(body)), nil
+	}
+	req.Body, _ = req.GetBody()
+	req.ContentLength = int64(len(body))
+	return nil
+}
+
+func (p *HTTPRetryPolicy) retryMethod(method string) bool {
+	methods := p.Methods
+	if len(methods) == 0 {
+		methods = DefaultRetryMethods
+	}
+	for _, m := range methods {
+		if m == method {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *HTTPRetryPolicy) retryable(ctx context.Context, resp *http.Response, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	if err != nil {
+		// an open circuit is not retried
+		return !errors.Is(err, breaker.ErrOpen)
+	}
+	codes := p.StatusCodes
+	if len(codes) == 0 {
+		codes = DefaultRetryStatusCodes
+	}
+	for _, c := range codes {
+		if c == resp.StatusCode {
+			return true
+		}
+	}
+	return false
+}
+
+// wait returns the backoff before retry n, starting from 1, and false if retrying should end
+func (p *HTTPRetryPolicy) wait(ctx context.Context, n int, resp *http.Response) (time.Duration, bool) {
+	backoff, max := p.Backoff, p.MaxBackoff
+	if backoff <= 0 {
+		backoff = DefaultHTTPRetryBackoff
+	}
+	if max <= 0 {
+		max = DefaultMaxHTTPRetryBackoff
+	}
+	for i := 1; i < n && backoff < max; i++ {
+		backoff *= 2
+	}
+	if backoff > max {
+		backoff = max
+	}
+	if p.Jitter > 0 {
+		backoff += time.Duration(p.Jitter * (rand.Float64()*2 - 1) * float64(backoff))
+	}
+
+	if resp != nil {
+		if after, ok := retryAfter(resp.Header.Get("Retry-After")); ok && after > backoff {
+			if after > max {
+				return 0, false
+			}
+			backoff = after
+		}
+	}
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < backoff {
+		return 0, false
+	}
+	return backoff, true
+}
+
+// retryAfter parses Retry-After in seconds or an HTTP date
+func retryAfter(value string) (time.Duration, bool) {
+	if len(value) == 0 {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		if d := time.Until(t); d > 0 {
+			return d, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
@@ -0,0 +1,84 @@
+package util
+
+import (
+	"context"
+	"encoding/hex"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	// TracerName is the instrumentation name of the spans of the toolkit
+	TracerName = "github.com/silentred/toolkit"
+)
+
+// StartSpan starts a span of the global tracer provider. Its parent is the span in ctx, or the
+// TraceContext of ctx. The TraceContext of the returned ctx is the new span, so that it is
+// propagated to outgoing requests.
+func StartSpan(ctx context.Context, name string, kind trace.SpanKind, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	if !trace.SpanContextFromContext(ctx).IsValid() {
+		if tc, ok := TraceContextFromContext(ctx); ok {
+			if sc, ok := tc.spanContext(); ok {
+				ctx = trace.ContextWithRemoteSpanContext(ctx, sc)
+			}
+		}
+	}
+
+	ctx, span := otel.Tracer(TracerName).Start(ctx, name, trace.WithSpanKind(kind), trace.WithAttributes(attrs...))
+	if sc := span.SpanContext(); sc.IsValid() {
+		ctx = WithTraceContext(ctx, TraceContext{
+			TraceID: sc.TraceID().String(),
+			SpanID:  sc.SpanID().String(),
+			Flags:   sc.TraceFlags().String(),
+			State:   sc.TraceState().String(),
+		})
+	}
+	return ctx, span
+}
+
+// StartServerSpan starts the span of an incoming request, whose parent is the caller in traceparent
+func StartServerSpan(ctx context.Context, name, traceparent, tracestate string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	if tc, ok := ParseTraceparent(traceparent); ok {
+		tc.State = tracestate
+		ctx = WithTraceContext(ctx, tc)
+	}
+	return StartSpan(ctx, name, trace.SpanKindServer, attrs...)
+}
+
+// EndSpan records err if it is not nil, and ends span
+func EndSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// spanContext returns the remote trace.SpanContext of tc
+func (tc TraceContext) spanContext() (trace.SpanContext, bool) {
+	traceID, err := trace.TraceIDFromHex(tc.TraceID)
+	if err != nil {
+		return trace.SpanContext{}, false
+	}
+	spanID, err := trace.SpanIDFromHex(tc.SpanID)
+	if err != nil {
+		return trace.SpanContext{}, false
+	}
+	var flags trace.TraceFlags
+	if b, err := hex.DecodeString(tc.Flags); err == nil && len(b) == 1 {
+		flags = trace.TraceFlags(b[0])
+	}
+	// an invalid tracestate is dropped
+	state, _ := trace.ParseTraceState(tc.State)
+
+	return trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    traceID,
+		SpanID:     spanID,
+		TraceFlags: flags,
+		TraceState: state,
+		Remote:     true,
+	}), true
+}
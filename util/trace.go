@@ -0,0 +1,165 @@
+package util
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+const (
+	// HeaderRequestID is the header carrying the request ID
+	HeaderRequestID = "X-Request-ID"
+	// HeaderTraceparent is the W3C trace-context header, as "00-{trace-id}-{parent-id}-{flags}"
+	HeaderTraceparent = "traceparent"
+	// HeaderTracestate is the W3C trace-context header of vendor data, passed through as it is
+	HeaderTracestate = "tracestate"
+
+	traceVersion = "00"
+	// maxRequestIDLen is the max length of request IDs accepted from callers
+	maxRequestIDLen = 128
+)
+
+type traceContextKey struct{}
+
+// TraceContext is the W3C trace-context of a request
+type TraceContext struct {
+	// TraceID is 32 lowercase hex characters
+	TraceID string
+	// SpanID is 16 lowercase hex characters, the ID of the span of this service
+	SpanID string
+	// Flags are 2 hex characters, "01" if sampled
+	Flags string
+	State string
+}
+
+// NewTraceContext returns a sampled TraceContext with random IDs
+func NewTraceContext() TraceContext {
+	return TraceContext{TraceID: randomHex(16), SpanID: randomHex(8), Flags: "01"}
+}
+
+// ParseTraceparent parses the traceparent header
+func ParseTraceparent(s string) (TraceContext, bool) {
+	parts := strings.Split(strings.TrimSpace(s), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" {
+		return TraceContext{}, false
+	}
+	// versions after 00 may append fields
+	if parts[0] == traceVersion && len(parts) != 4 {
+		return TraceContext{}, false
+	}
+	tc := TraceContext{TraceID: parts[1], SpanID: parts[2], Flags: parts[3]}
+	if !isHex(parts[0]) || !isHex(tc.TraceID) || len(tc.TraceID) != 32 || !isHex(tc.SpanID) || len(tc.SpanID) != 16 ||
+		!isHex(tc.Flags) || len(tc.Flags) != 2 {
+		return TraceContext{}, false
+	}
+	if isZero(tc.TraceID) || isZero(tc.SpanID) {
+		return TraceContext{}, false
+	}
+	return tc, true
+}
+
+// Traceparent returns the traceparent header of tc
+func (tc TraceContext) Traceparent() string {
+	return fmt.Sprintf("%s-%s-%s-%s", traceVersion, tc.TraceID, tc.SpanID, tc.Flags)
+}
+
+// Child returns the TraceContext of a new span in the same trace
+func (tc TraceContext) Child() TraceContext {
+	tc.SpanID = randomHex(8)
+	return tc
+}
+
+// Valid reports whether tc has IDs
+func (tc TraceContext) Valid() bool {
+	return len(tc.TraceID) > 0 && len(tc.SpanID) > 0
+}
+
+// WithTraceContext returns a copy of ctx carrying tc
+func WithTraceContext(ctx context.Context, tc TraceContext) context.Context {
+	return context.WithValue(ctx, traceContextKey{}, tc)
+}
+
+// TraceContextFromContext returns the TraceContext in ctx
+func TraceContextFromContext(ctx context.Context) (TraceContext, bool) {
+	if ctx == nil {
+		return TraceContext{}, false
+	}
+	tc, ok := ctx.Value(traceContextKey{}).(TraceContext)
+	return tc, ok
+}
+
+// StartRequest returns a copy of ctx carrying the request ID and the TraceContext of an incoming request.
+// The span of the caller in traceparent becomes the parent of a new span, and a new trace is started if
+// traceparent is invalid. The TraceContext already in ctx, as the one of StartServerSpan, is kept.
+// The request ID is the trace ID if it is empty or invalid.
+func StartRequest(ctx context.Context, requestID, traceparent, tracestate string) context.Context {
+	tc, ok := TraceContextFromContext(ctx)
+	if !ok {
+		if tc, ok = ParseTraceparent(traceparent); ok {
+			tc = tc.Child()
+			tc.State = tracestate
+		} else {
+			tc = NewTraceContext()
+		}
+	}
+	if !validRequestID(requestID) {
+		requestID = tc.TraceID
+	}
+	return WithRequestID(WithTraceContext(ctx, tc), requestID)
+}
+
+// InjectHeader sets the request ID and trace-context of ctx into the header of an outgoing request,
+// unless they are set already
+func InjectHeader(ctx context.Context, header http.Header) {
+	if id := RequestIDFromContext(ctx); len(id) > 0 && len(header.Get(HeaderRequestID)) == 0 {
+		header.Set(HeaderRequestID, id)
+	}
+	if len(header.Get(HeaderTraceparent)) > 0 {
+		return
+	}
+	if tc, ok := TraceContextFromContext(ctx); ok && tc.Valid() {
+		header.Set(HeaderTraceparent, tc.Traceparent())
+		if len(tc.State) > 0 {
+			header.Set(HeaderTracestate, tc.State)
+		}
+	}
+}
+
+// validRequestID accepts printable ASCII without spaces, which is safe to log
+func validRequestID(id string) bool {
+	if len(id) == 0 || len(id) > maxRequestIDLen {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	for {
+		rand.Read(b)
+		if s := hex.EncodeToString(b); !isZero(s) {
+			return s
+		}
+	}
+}
+
+func isHex(s string) bool {
+	for _, c := range s {
+		if !(c >= '0' && c <= '9' || c >= 'a' && c <= 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+func isZero(s string) bool {
+	return strings.Trim(s, "0") == ""
+}
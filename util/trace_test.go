@@ -0,0 +1,67 @@
+package util
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseTraceparent(t *testing.T) {
+	tc, ok := ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	if assert.True(t, ok) {
+		assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", tc.TraceID)
+		assert.Equal(t, "00f067aa0ba902b7", tc.SpanID)
+		assert.Equal(t, "01", tc.Flags)
+		assert.Equal(t, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", tc.Traceparent())
+	}
+
+	for _, s := range []string{
+		"",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+		"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+	} {
+		_, ok := ParseTraceparent(s)
+		assert.False(t, ok, s)
+	}
+
+	// later versions may append fields
+	_, ok = ParseTraceparent("01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra")
+	assert.True(t, ok)
+}
+
+func TestStartRequest(t *testing.T) {
+	ctx := StartRequest(context.Background(), "", "", "")
+	tc, ok := TraceContextFromContext(ctx)
+	if assert.True(t, ok) {
+		assert.Len(t, tc.TraceID, 32)
+		assert.Len(t, tc.SpanID, 16)
+		assert.Equal(t, tc.TraceID, RequestIDFromContext(ctx))
+	}
+
+	// IDs unsafe to log are replaced
+	ctx = StartRequest(context.Background(), "bad\nid", "", "")
+	assert.NotEqual(t, "bad\nid", RequestIDFromContext(ctx))
+
+	ctx = StartRequest(context.Background(), "req-1", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", "vendor=1")
+	header := http.Header{}
+	InjectHeader(ctx, header)
+	assert.Equal(t, "req-1", header.Get(HeaderRequestID))
+	assert.Equal(t, "vendor=1", header.Get(HeaderTracestate))
+	sent, ok := ParseTraceparent(header.Get(HeaderTraceparent))
+	if assert.True(t, ok) {
+		assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", sent.TraceID)
+		assert.NotEqual(t, "00f067aa0ba902b7", sent.SpanID)
+	}
+
+	// headers set by the caller are kept
+	header = http.Header{}
+	header.Set(HeaderRequestID, "mine")
+	InjectHeader(ctx, header)
+	assert.Equal(t, "mine", header.Get(HeaderRequestID))
+}